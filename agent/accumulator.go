@@ -5,6 +5,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
 )
 
 type MetricMaker interface {
@@ -13,6 +14,23 @@ type MetricMaker interface {
 	Log() telegraf.Logger
 }
 
+// errorRecorder is implemented by a MetricMaker that keeps track of its
+// latest error.
+type errorRecorder interface {
+	RecordError(err error)
+}
+
+// originSetter is implemented by a MetricMaker that records the origin of its
+// metrics.
+type originSetter interface {
+	SetOrigin(m telegraf.Metric)
+}
+
+// tapper is implemented by a MetricMaker whose metrics can be tapped.
+type tapper interface {
+	Tap() *models.Tap
+}
+
 type accumulator struct {
 	maker     MetricMaker
 	metrics   chan<- telegraf.Metric
@@ -79,6 +97,12 @@ func (ac *accumulator) AddHistogram(
 func (ac *accumulator) AddMetric(m telegraf.Metric) {
 	m.SetTime(m.Time().Round(ac.precision))
 	if m := ac.maker.MakeMetric(m); m != nil {
+		if s, ok := ac.maker.(originSetter); ok {
+			s.SetOrigin(m)
+		}
+		if t, ok := ac.maker.(tapper); ok {
+			t.Tap().Publish(m)
+		}
 		ac.metrics <- m
 	}
 }
@@ -95,6 +119,12 @@ func (ac *accumulator) addFields(
 		return
 	}
 	if m := ac.maker.MakeMetric(m); m != nil {
+		if s, ok := ac.maker.(originSetter); ok {
+			s.SetOrigin(m)
+		}
+		if t, ok := ac.maker.(tapper); ok {
+			t.Tap().Publish(m)
+		}
 		ac.metrics <- m
 	}
 }
@@ -105,6 +135,9 @@ func (ac *accumulator) AddError(err error) {
 	if err == nil {
 		return
 	}
+	if r, ok := ac.maker.(errorRecorder); ok {
+		r.RecordError(err)
+	}
 	ac.maker.Log().Errorf("Error in plugin: %v", err)
 }
 
@@ -2,8 +2,10 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"runtime"
 	"sort"
@@ -20,17 +22,36 @@ import (
 // Agent runs a set of plugins.
 type Agent struct {
 	Config *config.Config
+
+	// RequestReload is called by the API to reload the configuration files,
+	// reloading is not available when nil.
+	RequestReload func()
+
+	reloadC chan *reloadRequest
+
+	// bufferMemory limits the memory used by the buffers of all outputs, it
+	// is nil when max_buffer_memory is not set.
+	bufferMemory *models.BufferMemory
+
+	// testWindow is the fast forwarded aggregation window of --test-pipeline
+	// mode, the inputs are gathered for each interval of the window.
+	testWindow time.Duration
 }
 
 // NewAgent returns an Agent for the given Config.
 func NewAgent(config *config.Config) (*Agent, error) {
 	a := &Agent{
-		Config: config,
+		Config:  config,
+		reloadC: make(chan *reloadRequest),
+	}
+	if limit := config.Agent.MaxBufferMemory.Size; limit > 0 {
+		a.bufferMemory = models.NewBufferMemory(limit)
 	}
 	return a, nil
 }
 
-// inputUnit is a group of input plugins and the shared channel they write to.
+// inputUnit is a group of input plugins and the router they write to.  Each
+// input writes to the channel of its pipeline.
 //
 // ┌───────┐
 // │ Input │───┐
@@ -38,12 +59,23 @@ func NewAgent(config *config.Config) (*Agent, error) {
 // ┌───────┐   │     ______
 // │ Input │───┼──▶ ()_____)
 // └───────┘   │
-// ┌───────┐   │
-// │ Input │───┘
+// ┌───────┐   │     ______
+// │ Input │───┴──▶ ()_____)
 // └───────┘
 type inputUnit struct {
-	dst    chan<- telegraf.Metric
+	sync.Mutex
+	router *pipelineRouter
 	inputs []*models.RunningInput
+
+	gatherers map[*models.RunningInput]*gatherer
+	stopped   bool
+	wg        sync.WaitGroup
+}
+
+// gatherer is the gather loop of a single input.
+type gatherer struct {
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 //  ______     ┌───────────┐     ______
@@ -77,8 +109,72 @@ type aggregatorUnit struct {
 	aggregators []*models.RunningAggregator
 }
 
+// pipelineChain is the chain of processors and aggregators of a pipeline.
+// Metrics written to the source channel are emitted on the destination
+// channel, which is closed once the source channel is closed and all metrics
+// have been processed.
+//
+//  ______     ┌────────────┐     ┌─────────────┐     ______
+// ()_____)──▶ │ Processors │──▶ │ Aggregators │──▶ ()_____)
+//             └────────────┘     └─────────────┘
+type pipelineChain struct {
+	name string
+	src  chan<- telegraf.Metric
+	dst  <-chan telegraf.Metric
+
+	pu  []*processorUnit
+	apu []*processorUnit
+	au  *aggregatorUnit
+}
+
+// pipelineUnit is the set of pipelines between the inputs and the outputs,
+// each pipeline has its own independent chain.
+type pipelineUnit struct {
+	chains map[string]*pipelineChain
+
+	processors    models.RunningProcessors
+	aggProcessors models.RunningProcessors
+	aggregators   []*models.RunningAggregator
+}
+
+// routedMetric is a metric along with the pipeline it was processed by.
+type routedMetric struct {
+	metric   telegraf.Metric
+	pipeline string
+}
+
+// pipelineRouter connects the inputs and the outputs to the current
+// pipelineUnit, which allows the pipelines to be replaced without restarting
+// the inputs or outputs.  Each pipeline has its own input channel, the
+// forwarder tags the metrics with their pipeline for the outputs.
+//
+//  ______     ┌────────┐     ┌──────────┐     ┌───────────┐     ______
+// ()_____)──▶ │ Router │──▶ │ Pipeline │──▶ │ Forwarder │──▶ ()_____)
+//             └────────┘     └──────────┘     └───────────┘
+type pipelineRouter struct {
+	sync.RWMutex
+	srcs   map[string]chan telegraf.Metric
+	dst    chan<- routedMetric
+	unit   *pipelineUnit
+	closed bool
+	wg     sync.WaitGroup
+
+	// inputsClosed is closed once the inputs are stopped, inputs tracks the
+	// goroutines reading the input channels.
+	inputsClosed chan struct{}
+	inputs       sync.WaitGroup
+}
+
+func newPipelineRouter(dst chan<- routedMetric) *pipelineRouter {
+	return &pipelineRouter{
+		srcs:         make(map[string]chan telegraf.Metric),
+		dst:          dst,
+		inputsClosed: make(chan struct{}),
+	}
+}
+
 // outputUnit is a group of Outputs and their source channel.  Metrics on the
-// channel are written to all outputs.
+// channel are written to all outputs receiving their pipeline.
 //
 //                            ┌────────┐
 //                       ┌──▶ │ Output │
@@ -90,8 +186,62 @@ type aggregatorUnit struct {
 //                       └──▶ │ Output │
 //                            └────────┘
 type outputUnit struct {
-	src     <-chan telegraf.Metric
+	sync.Mutex
+	src     <-chan routedMetric
 	outputs []*models.RunningOutput
+
+	flushers map[*models.RunningOutput]*flusher
+	stopped  bool
+
+	// groups route the metrics of their members, fan holds the groups
+	// followed by the outputs that are not in a group.
+	groups []*outputGroup
+	fan    []fanTarget
+}
+
+// metricAdder is an output or output group that receives metrics.
+type metricAdder interface {
+	AddMetric(telegraf.Metric)
+}
+
+// fanTarget is an output or output group along with the configuration that
+// selects the pipelines it receives.  The members of a group all receive the
+// same pipelines.
+type fanTarget struct {
+	metricAdder
+	config *models.OutputConfig
+}
+
+// updateFan rebuilds the fan after the outputs or groups changed.  The unit
+// must be locked.
+func (unit *outputUnit) updateFan() {
+	fan := make([]fanTarget, 0, len(unit.outputs))
+	for _, g := range unit.groups {
+		fan = append(fan, fanTarget{g, g.members[0].Config})
+	}
+	for _, output := range unit.outputs {
+		if unit.groupOf(output) == nil {
+			fan = append(fan, fanTarget{output, output.Config})
+		}
+	}
+	unit.fan = fan
+}
+
+// groupOf returns the group of the output or nil.  The unit must be locked.
+func (unit *outputUnit) groupOf(output *models.RunningOutput) *outputGroup {
+	for _, g := range unit.groups {
+		if g.contains(output) {
+			return g
+		}
+	}
+	return nil
+}
+
+// flusher is the flush loop of a single output.
+type flusher struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	flushNow chan struct{}
 }
 
 // Run starts and runs the Agent until the context is done.
@@ -102,46 +252,49 @@ func (a *Agent) Run(ctx context.Context) error {
 		a.Config.Agent.Hostname, a.Config.Agent.FlushInterval.Duration)
 
 	log.Printf("D! [agent] Initializing plugins")
-	err := a.initPlugins()
+	err := a.initPlugins(true)
 	if err != nil {
 		return err
 	}
 
+	var apiListener net.Listener
+	if a.Config.Agent.APIAddress != "" {
+		apiListener, err = listenAPI(a.Config.Agent.APIAddress)
+		if err != nil {
+			return fmt.Errorf("starting API: %w", err)
+		}
+	}
+	closeAPI := func() {
+		if apiListener != nil {
+			apiListener.Close()
+		}
+	}
+
 	startTime := time.Now()
 
 	log.Printf("D! [agent] Connecting outputs")
 	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
 	if err != nil {
+		closeAPI()
 		return err
 	}
 
-	var apu []*processorUnit
-	var au *aggregatorUnit
-	if len(a.Config.Aggregators) != 0 {
-		aggC := next
-		if len(a.Config.AggProcessors) != 0 {
-			aggC, apu, err = a.startProcessors(next, a.Config.AggProcessors)
-			if err != nil {
-				return err
-			}
-		}
-
-		next, au, err = a.startAggregators(aggC, next, a.Config.Aggregators)
-		if err != nil {
-			return err
-		}
+	pl, err := a.startPipeline(a.Config.Processors, a.Config.AggProcessors, a.Config.Aggregators)
+	if err != nil {
+		closeAPI()
+		return err
 	}
 
-	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
-		if err != nil {
-			return err
-		}
-	}
+	// Service inputs may write metrics as soon as they are started, the
+	// pipeline must be running before.
+	router := newPipelineRouter(next)
+	a.runPipeline(router, startTime, pl)
 
-	iu, err := a.startInputs(next, a.Config.Inputs)
+	iu, err := a.startInputs(router, a.Config.Inputs)
 	if err != nil {
+		router.closeInputs()
+		a.runRouter(router)
+		closeAPI()
 		return err
 	}
 
@@ -155,36 +308,11 @@ func (a *Agent) Run(ctx context.Context) error {
 		}
 	}()
 
-	if au != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runProcessors(apu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
-			}
-		}()
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runAggregators(startTime, au)
-			if err != nil {
-				log.Printf("E! [agent] Error running aggregators: %v", err)
-			}
-		}()
-	}
-
-	if pu != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runProcessors(pu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
-			}
-		}()
-	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.runRouter(router)
+	}()
 
 	wg.Add(1)
 	go func() {
@@ -195,14 +323,26 @@ func (a *Agent) Run(ctx context.Context) error {
 		}
 	}()
 
+	if apiListener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runAPI(ctx, apiListener, iu, router, ou)
+		}()
+	}
+
+	a.handleReloads(ctx, iu, router, ou)
+
 	wg.Wait()
 
 	log.Printf("D! [agent] Stopped Successfully")
 	return err
 }
 
-// initPlugins runs the Init function on plugins.
-func (a *Agent) initPlugins() error {
+// initPlugins runs the Init function on plugins.  The disk buffers of the
+// outputs are only opened if openBuffers is true, the test modes must not use
+// the buffers of a running agent.
+func (a *Agent) initPlugins(openBuffers bool) error {
 	for _, input := range a.Config.Inputs {
 		err := input.Init()
 		if err != nil {
@@ -232,7 +372,10 @@ func (a *Agent) initPlugins() error {
 		}
 	}
 	for _, output := range a.Config.Outputs {
-		err := output.Init()
+		err := output.InitOutput()
+		if err == nil && openBuffers {
+			err = output.OpenBuffer()
+		}
 		if err != nil {
 			return fmt.Errorf("could not initialize output %s: %v",
 				output.Config.Name, err)
@@ -242,37 +385,21 @@ func (a *Agent) initPlugins() error {
 }
 
 func (a *Agent) startInputs(
-	dst chan<- telegraf.Metric,
+	router *pipelineRouter,
 	inputs []*models.RunningInput,
 ) (*inputUnit, error) {
 	log.Printf("D! [agent] Starting service inputs")
 
 	unit := &inputUnit{
-		dst: dst,
+		router:    router,
+		gatherers: make(map[*models.RunningInput]*gatherer),
 	}
 
 	for _, input := range inputs {
-		if si, ok := input.Input.(telegraf.ServiceInput); ok {
-			// Service input plugins are not normally subject to timestamp
-			// rounding except for when precision is set on the input plugin.
-			//
-			// This only applies to the accumulator passed to Start(), the
-			// Gather() accumulator does apply rounding according to the
-			// precision and interval agent/plugin settings.
-			var interval time.Duration
-			var precision time.Duration
-			if input.Config.Precision != 0 {
-				precision = input.Config.Precision
-			}
-
-			acc := NewAccumulator(input, dst)
-			acc.SetPrecision(getPrecision(precision, interval))
-
-			err := si.Start(acc)
-			if err != nil {
-				stopServiceInputs(unit.inputs)
-				return nil, fmt.Errorf("starting input %s: %w", input.LogName(), err)
-			}
+		err := startServiceInput(input, router.input(input.Config.Pipeline))
+		if err != nil {
+			stopServiceInputs(unit.inputs)
+			return nil, err
 		}
 		unit.inputs = append(unit.inputs, input)
 	}
@@ -280,6 +407,35 @@ func (a *Agent) startInputs(
 	return unit, nil
 }
 
+// startServiceInput calls Start if the input is a service input.
+func startServiceInput(input *models.RunningInput, dst chan<- telegraf.Metric) error {
+	si, ok := input.Input.(telegraf.ServiceInput)
+	if !ok {
+		return nil
+	}
+
+	// Service input plugins are not normally subject to timestamp
+	// rounding except for when precision is set on the input plugin.
+	//
+	// This only applies to the accumulator passed to Start(), the
+	// Gather() accumulator does apply rounding according to the
+	// precision and interval agent/plugin settings.
+	var interval time.Duration
+	var precision time.Duration
+	if input.Config.Precision != 0 {
+		precision = input.Config.Precision
+	}
+
+	acc := NewAccumulator(input, dst)
+	acc.SetPrecision(getPrecision(precision, interval))
+
+	err := si.Start(acc)
+	if err != nil {
+		return fmt.Errorf("starting input %s: %w", input.LogName(), err)
+	}
+	return nil
+}
+
 // runInputs starts and triggers the periodic gather for Inputs.
 //
 // When the context is done the timers are stopped and this function returns
@@ -289,66 +445,108 @@ func (a *Agent) runInputs(
 	startTime time.Time,
 	unit *inputUnit,
 ) error {
-	var wg sync.WaitGroup
+	unit.Lock()
 	for _, input := range unit.inputs {
-		// Overwrite agent interval if this plugin has its own.
-		interval := a.Config.Agent.Interval.Duration
-		if input.Config.Interval != 0 {
-			interval = input.Config.Interval
-		}
+		a.startGather(ctx, startTime, unit, input)
+	}
+	unit.Unlock()
 
-		// Overwrite agent precision if this plugin has its own.
-		precision := a.Config.Agent.Precision.Duration
-		if input.Config.Precision != 0 {
-			precision = input.Config.Precision
-		}
+	<-ctx.Done()
 
-		// Overwrite agent collection_jitter if this plugin has its own.
-		jitter := a.Config.Agent.CollectionJitter.Duration
-		if input.Config.CollectionJitter != 0 {
-			jitter = input.Config.CollectionJitter
-		}
+	unit.Lock()
+	unit.stopped = true
+	unit.Unlock()
+	unit.wg.Wait()
 
-		var ticker Ticker
-		if a.Config.Agent.RoundInterval {
-			ticker = NewAlignedTicker(startTime, interval, jitter)
-		} else {
-			ticker = NewUnalignedTicker(interval, jitter)
-		}
-		defer ticker.Stop()
+	log.Printf("D! [agent] Stopping service inputs")
+	unit.Lock()
+	stopServiceInputs(unit.inputs)
+	unit.Unlock()
 
-		acc := NewAccumulator(input, unit.dst)
-		acc.SetPrecision(getPrecision(precision, interval))
+	unit.router.closeInputs()
+	log.Printf("D! [agent] Input channel closed")
 
-		wg.Add(1)
-		go func(input *models.RunningInput) {
-			defer wg.Done()
-			a.gatherLoop(ctx, acc, input, ticker, interval)
-		}(input)
+	return nil
+}
+
+// startGather starts the gather loop of an input.  The unit must be locked.
+func (a *Agent) startGather(
+	ctx context.Context,
+	startTime time.Time,
+	unit *inputUnit,
+	input *models.RunningInput,
+) {
+	if unit.stopped {
+		return
 	}
 
-	wg.Wait()
+	interval := a.inputInterval(input, startTime)
 
-	log.Printf("D! [agent] Stopping service inputs")
-	stopServiceInputs(unit.inputs)
+	// Overwrite agent precision if this plugin has its own.
+	precision := a.Config.Agent.Precision.Duration
+	if input.Config.Precision != 0 {
+		precision = input.Config.Precision
+	}
 
-	close(unit.dst)
-	log.Printf("D! [agent] Input channel closed")
+	// Overwrite agent collection_jitter if this plugin has its own.
+	jitter := a.Config.Agent.CollectionJitter.Duration
+	if input.Config.CollectionJitter != 0 {
+		jitter = input.Config.CollectionJitter
+	}
 
-	return nil
+	var ticker Ticker
+	if input.Config.Schedule != nil {
+		ticker = NewCronTicker(startTime, input.Config.Schedule, jitter)
+	} else if a.Config.Agent.RoundInterval {
+		ticker = NewAlignedTicker(startTime, interval, jitter)
+	} else {
+		ticker = NewUnalignedTicker(interval, jitter)
+	}
+
+	acc := NewAccumulator(input, unit.router.input(input.Config.Pipeline))
+	acc.SetPrecision(getPrecision(precision, interval))
+
+	ctx, cancel := context.WithCancel(ctx)
+	g := &gatherer{cancel: cancel, done: make(chan struct{})}
+	unit.gatherers[input] = g
+
+	unit.wg.Add(1)
+	go func() {
+		defer unit.wg.Done()
+		defer close(g.done)
+		defer ticker.Stop()
+		a.gatherLoop(ctx, acc, input, ticker, interval)
+	}()
+}
+
+// inputInterval returns the gather interval of the input.  Inputs with a
+// schedule use the time between their next two runs, it sets the default
+// precision and how long a gather runs before a slow collection is reported.
+func (a *Agent) inputInterval(input *models.RunningInput, now time.Time) time.Duration {
+	if schedule := input.Config.Schedule; schedule != nil {
+		next := schedule.Next(now)
+		return schedule.Next(next).Sub(next)
+	}
+
+	// Overwrite agent interval if this plugin has its own.
+	if input.Config.Interval != 0 {
+		return input.Config.Interval
+	}
+	return a.Config.Agent.Interval.Duration
 }
 
 // testStartInputs is a variation of startInputs for use in --test and --once
 // mode.  It differs by logging Start errors and returning only plugins
 // successfully started.
 func (a *Agent) testStartInputs(
-	dst chan<- telegraf.Metric,
+	router *pipelineRouter,
 	inputs []*models.RunningInput,
 ) (*inputUnit, error) {
 	log.Printf("D! [agent] Starting service inputs")
 
 	unit := &inputUnit{
-		dst: dst,
+		router:    router,
+		gatherers: make(map[*models.RunningInput]*gatherer),
 	}
 
 	for _, input := range inputs {
@@ -357,7 +555,7 @@ func (a *Agent) testStartInputs(
 			// This only applies to the accumulator passed to Start(), the
 			// Gather() accumulator does apply rounding according to the
 			// precision agent setting.
-			acc := NewAccumulator(input, dst)
+			acc := NewAccumulator(input, router.input(input.Config.Pipeline))
 			acc.SetPrecision(time.Nanosecond)
 
 			err := si.Start(acc)
@@ -393,11 +591,7 @@ func (a *Agent) testRunInputs(
 		go func(input *models.RunningInput) {
 			defer wg.Done()
 
-			// Overwrite agent interval if this plugin has its own.
-			interval := a.Config.Agent.Interval.Duration
-			if input.Config.Interval != 0 {
-				interval = input.Config.Interval
-			}
+			interval := a.inputInterval(input, time.Now())
 
 			// Overwrite agent precision if this plugin has its own.
 			precision := a.Config.Agent.Precision.Duration
@@ -418,11 +612,14 @@ func (a *Agent) testRunInputs(
 				time.Sleep(500 * time.Millisecond)
 			}
 
-			acc := NewAccumulator(input, unit.dst)
-			acc.SetPrecision(getPrecision(precision, interval))
-
-			if err := input.Input.Gather(acc); err != nil {
-				acc.AddError(err)
+			dst := unit.router.input(input.Config.Pipeline)
+			gathers := 1
+			if a.testWindow > interval {
+				gathers = int(a.testWindow / interval)
+			}
+			for i := 0; i < gathers; i++ {
+				offset := time.Duration(i) * interval
+				testGather(input, dst, getPrecision(precision, interval), offset)
 			}
 		}(input)
 	}
@@ -433,11 +630,44 @@ func (a *Agent) testRunInputs(
 	log.Printf("D! [agent] Stopping service inputs")
 	stopServiceInputs(unit.inputs)
 
-	close(unit.dst)
+	unit.router.closeInputs()
 	log.Printf("D! [agent] Input channel closed")
 	return nil
 }
 
+// testGather runs the Gather function of the input once.  The timestamps of
+// the metrics are moved forward by offset, which fast forwards the aggregation
+// window in --test-pipeline mode.
+func testGather(
+	input *models.RunningInput,
+	dst chan<- telegraf.Metric,
+	precision time.Duration,
+	offset time.Duration,
+) {
+	if offset == 0 {
+		acc := NewAccumulator(input, dst)
+		acc.SetPrecision(precision)
+		if err := input.Input.Gather(acc); err != nil {
+			acc.AddError(err)
+		}
+		return
+	}
+
+	shifted := make(chan telegraf.Metric, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range shifted {
+			m.SetTime(m.Time().Add(offset))
+			dst <- m
+		}
+	}()
+
+	testGather(input, shifted, precision, 0)
+	close(shifted)
+	<-done
+}
+
 // stopServiceInputs stops all service inputs.
 func stopServiceInputs(inputs []*models.RunningInput) {
 	for _, input := range inputs {
@@ -461,6 +691,9 @@ func (a *Agent) gatherLoop(
 	for {
 		select {
 		case <-ticker.Elapsed():
+			if input.Paused() {
+				continue
+			}
 			err := a.gatherOnce(acc, input, ticker, interval)
 			if err != nil {
 				acc.AddError(err)
@@ -472,7 +705,8 @@ func (a *Agent) gatherLoop(
 }
 
 // gatherOnce runs the input's Gather function once, logging a warning each
-// interval it fails to complete before.
+// interval it fails to complete before.  The skipped collections are counted
+// as overruns of the input.
 func (a *Agent) gatherOnce(
 	acc telegraf.Accumulator,
 	input *models.RunningInput,
@@ -493,11 +727,15 @@ func (a *Agent) gatherOnce(
 	for {
 		select {
 		case err := <-done:
+			if errors.Is(err, models.ErrGatherSkipped) {
+				input.GatherOverruns.Incr(1)
+			}
 			return err
 		case <-slowWarning.C:
 			log.Printf("W! [%s] Collection took longer than expected; not complete after interval of %s",
 				input.LogName(), interval)
 		case <-ticker.Elapsed():
+			input.GatherOverruns.Incr(1)
 			log.Printf("D! [%s] Previous collection has not completed; scheduled collection skipped",
 				input.LogName())
 		}
@@ -562,6 +800,7 @@ func (a *Agent) runProcessors(
 				}
 			}
 			unit.processor.Stop()
+			unit.processor.Tap().Close()
 			close(unit.dst)
 			log.Printf("D! [agent] Processor channel closed")
 		}(unit)
@@ -571,6 +810,318 @@ func (a *Agent) runProcessors(
 	return nil
 }
 
+// startPipeline sets up the processor and aggregator chain of each pipeline
+// and calls Start on all processors.
+func (a *Agent) startPipeline(
+	processors models.RunningProcessors,
+	aggProcessors models.RunningProcessors,
+	aggregators []*models.RunningAggregator,
+) (*pipelineUnit, error) {
+	unit := &pipelineUnit{
+		chains:        make(map[string]*pipelineChain),
+		processors:    processors,
+		aggProcessors: aggProcessors,
+		aggregators:   aggregators,
+	}
+
+	for _, name := range pipelineNames(processors, aggregators) {
+		chain, err := a.startChain(name,
+			pipelineProcessors(processors, name),
+			pipelineProcessors(aggProcessors, name),
+			pipelineAggregators(aggregators, name))
+		if err != nil {
+			for _, started := range unit.chains {
+				started.stop()
+			}
+			return nil, err
+		}
+		unit.chains[name] = chain
+	}
+	return unit, nil
+}
+
+// startChain sets up the processor and aggregator chain of a pipeline.
+func (a *Agent) startChain(
+	name string,
+	processors models.RunningProcessors,
+	aggProcessors models.RunningProcessors,
+	aggregators []*models.RunningAggregator,
+) (*pipelineChain, error) {
+	dst := make(chan telegraf.Metric, 100)
+	chain := &pipelineChain{name: name, dst: dst}
+
+	var err error
+	var next chan<- telegraf.Metric = dst
+	if len(aggregators) != 0 {
+		aggC := next
+		if len(aggProcessors) != 0 {
+			aggC, chain.apu, err = a.startProcessors(next, aggProcessors)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		next, chain.au, err = a.startAggregators(aggC, next, aggregators)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(processors) != 0 {
+		next, chain.pu, err = a.startProcessors(next, processors)
+		if err != nil {
+			chain.stop()
+			return nil, err
+		}
+	}
+
+	chain.src = next
+	return chain, nil
+}
+
+// stop stops the processors of a chain that is not run, when a later chain
+// of the pipeline fails to start.
+func (c *pipelineChain) stop() {
+	for _, units := range [][]*processorUnit{c.pu, c.apu} {
+		for _, pu := range units {
+			pu.processor.Stop()
+		}
+	}
+}
+
+// runPipeline runs the pipeline in the background and makes it the current
+// pipeline of the router.  The previous pipeline is closed and finishes
+// processing its metrics in the background.
+func (a *Agent) runPipeline(
+	router *pipelineRouter,
+	startTime time.Time,
+	unit *pipelineUnit,
+) {
+	router.Lock()
+	defer router.Unlock()
+
+	// If the router is already closed the pipeline is only run to stop the
+	// processors, any metrics it produces are discarded.
+	wg := &router.wg
+	dst := router.dst
+	if router.closed {
+		unit.close()
+		wg = &sync.WaitGroup{}
+		discard := make(chan routedMetric)
+		go func() {
+			for rm := range discard {
+				rm.metric.Drop()
+			}
+		}()
+		dst = discard
+		defer func() {
+			go func() {
+				wg.Wait()
+				close(discard)
+			}()
+		}()
+	}
+
+	for _, chain := range unit.chains {
+		a.runChain(wg, dst, startTime, chain)
+	}
+
+	if router.closed {
+		return
+	}
+
+	prev := router.unit
+	router.unit = unit
+	if prev != nil {
+		prev.close()
+	}
+}
+
+// runChain runs the processors and aggregators of a pipeline in the
+// background and forwards the processed metrics to dst.
+func (a *Agent) runChain(
+	wg *sync.WaitGroup,
+	dst chan<- routedMetric,
+	startTime time.Time,
+	chain *pipelineChain,
+) {
+	if chain.au != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := a.runProcessors(chain.apu)
+			if err != nil {
+				log.Printf("E! [agent] Error running processors: %v", err)
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := a.runAggregators(startTime, chain.au)
+			if err != nil {
+				log.Printf("E! [agent] Error running aggregators: %v", err)
+			}
+		}()
+	}
+
+	if chain.pu != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := a.runProcessors(chain.pu)
+			if err != nil {
+				log.Printf("E! [agent] Error running processors: %v", err)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for metric := range chain.dst {
+			dst <- routedMetric{metric: metric, pipeline: chain.name}
+		}
+	}()
+}
+
+// close closes the source channel of all chains.
+func (unit *pipelineUnit) close() {
+	for _, chain := range unit.chains {
+		close(chain.src)
+	}
+}
+
+// input returns the channel the inputs of a pipeline write to.
+func (router *pipelineRouter) input(pipeline string) chan<- telegraf.Metric {
+	name := models.PipelineName(pipeline)
+
+	router.Lock()
+	defer router.Unlock()
+
+	src, ok := router.srcs[name]
+	if !ok {
+		src = make(chan telegraf.Metric, 100)
+		router.srcs[name] = src
+		router.inputs.Add(1)
+		go func() {
+			defer router.inputs.Done()
+			router.route(name, src)
+		}()
+	}
+	return src
+}
+
+// route sends the metrics of the inputs of a pipeline to the chain of the
+// pipeline.  The read lock is held while sending so that the chain is not
+// closed by a reload, the pipelines do not wait for each other.
+func (router *pipelineRouter) route(name string, src <-chan telegraf.Metric) {
+	for metric := range src {
+		router.RLock()
+		chain, ok := router.unit.chains[name]
+		for !ok {
+			router.RUnlock()
+			router.Lock()
+			router.chain(name)
+			router.Unlock()
+			router.RLock()
+			chain, ok = router.unit.chains[name]
+		}
+		chain.src <- metric
+		router.RUnlock()
+	}
+}
+
+// chain returns the chain of the current pipeline unit.  Pipelines without
+// processors or aggregators have an empty chain that is added on first use.
+// The router must be locked.
+func (router *pipelineRouter) chain(name string) *pipelineChain {
+	if chain, ok := router.unit.chains[name]; ok {
+		return chain
+	}
+
+	c := make(chan telegraf.Metric, 100)
+	chain := &pipelineChain{name: name, src: c, dst: c}
+	router.unit.chains[name] = chain
+
+	router.wg.Add(1)
+	go func() {
+		defer router.wg.Done()
+		for metric := range chain.dst {
+			router.dst <- routedMetric{metric: metric, pipeline: name}
+		}
+	}()
+	return chain
+}
+
+// closeInputs closes the input channels once the inputs are stopped.
+func (router *pipelineRouter) closeInputs() {
+	router.Lock()
+	for _, src := range router.srcs {
+		close(src)
+	}
+	router.Unlock()
+	close(router.inputsClosed)
+}
+
+// runRouter sends the metrics from the inputs to the current pipeline until
+// the input channels are closed, and closes the output channel after all
+// pipelines are finished.
+func (a *Agent) runRouter(router *pipelineRouter) {
+	<-router.inputsClosed
+	router.inputs.Wait()
+
+	router.Lock()
+	router.closed = true
+	router.unit.close()
+	router.Unlock()
+
+	router.wg.Wait()
+	close(router.dst)
+	log.Printf("D! [agent] Pipeline channel closed")
+}
+
+// pipelineNames returns the names of the pipelines with processors or
+// aggregators.
+func pipelineNames(processors models.RunningProcessors, aggregators []*models.RunningAggregator) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(pipeline string) {
+		name := models.PipelineName(pipeline)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, processor := range processors {
+		add(processor.Config.Pipeline)
+	}
+	for _, aggregator := range aggregators {
+		add(aggregator.Config.Pipeline)
+	}
+	return names
+}
+
+func pipelineProcessors(processors models.RunningProcessors, name string) models.RunningProcessors {
+	var result models.RunningProcessors
+	for _, processor := range processors {
+		if models.PipelineName(processor.Config.Pipeline) == name {
+			result = append(result, processor)
+		}
+	}
+	return result
+}
+
+func pipelineAggregators(aggregators []*models.RunningAggregator, name string) []*models.RunningAggregator {
+	var result []*models.RunningAggregator
+	for _, aggregator := range aggregators {
+		if models.PipelineName(aggregator.Config.Pipeline) == name {
+			result = append(result, aggregator)
+		}
+	}
+	return result
+}
+
 // startAggregators sets up the aggregator unit and returns the source channel.
 func (a *Agent) startAggregators(
 	aggC chan<- telegraf.Metric,
@@ -597,8 +1148,11 @@ func (a *Agent) runAggregators(
 
 	// Before calling Add, initialize the aggregation window.  This ensures
 	// that any metric created after start time will be aggregated.
-	for _, agg := range a.Config.Aggregators {
+	for _, agg := range unit.aggregators {
 		since, until := updateWindow(startTime, a.Config.Agent.RoundInterval, agg.Period())
+		if a.testWindow != 0 {
+			until = startTime.Add(a.testWindow)
+		}
 		agg.UpdateWindow(since, until)
 	}
 
@@ -608,7 +1162,7 @@ func (a *Agent) runAggregators(
 		defer wg.Done()
 		for metric := range unit.src {
 			var dropOriginal bool
-			for _, agg := range a.Config.Aggregators {
+			for _, agg := range unit.aggregators {
 				if ok := agg.Add(metric); ok {
 					dropOriginal = true
 				}
@@ -623,7 +1177,7 @@ func (a *Agent) runAggregators(
 		cancel()
 	}()
 
-	for _, agg := range a.Config.Aggregators {
+	for _, agg := range unit.aggregators {
 		wg.Add(1)
 		go func(agg *models.RunningAggregator) {
 			defer wg.Done()
@@ -638,6 +1192,9 @@ func (a *Agent) runAggregators(
 	}
 
 	wg.Wait()
+	for _, agg := range unit.aggregators {
+		agg.Tap().Close()
+	}
 
 	// In the case that there are no processors, both aggC and outputC are the
 	// same channel.  If there are processors, we close the aggC and the
@@ -682,7 +1239,7 @@ func (a *Agent) push(
 			aggregator.Push(acc)
 			break
 		case <-ctx.Done():
-			aggregator.Push(acc)
+			aggregator.PushAll(acc)
 			return
 		}
 	}
@@ -693,9 +1250,18 @@ func (a *Agent) push(
 func (a *Agent) startOutputs(
 	ctx context.Context,
 	outputs []*models.RunningOutput,
-) (chan<- telegraf.Metric, *outputUnit, error) {
-	src := make(chan telegraf.Metric, 100)
-	unit := &outputUnit{src: src}
+) (chan<- routedMetric, *outputUnit, error) {
+	groups, err := newOutputGroups(a.Config.OutputGroups, outputs, len(a.Config.OutputFilters) != 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	src := make(chan routedMetric, 100)
+	unit := &outputUnit{
+		src:      src,
+		flushers: make(map[*models.RunningOutput]*flusher),
+		groups:   groups,
+	}
 	for _, output := range outputs {
 		err := a.connectOutput(ctx, output)
 		if err != nil {
@@ -705,12 +1271,21 @@ func (a *Agent) startOutputs(
 			return nil, nil, fmt.Errorf("connecting output %s: %w", output.LogName(), err)
 		}
 
+		a.setBufferMemory(output)
 		unit.outputs = append(unit.outputs, output)
 	}
+	unit.updateFan()
 
 	return src, unit, nil
 }
 
+// setBufferMemory makes the output share the agent wide buffer memory limit.
+func (a *Agent) setBufferMemory(output *models.RunningOutput) {
+	if a.bufferMemory != nil {
+		output.SetBufferMemory(a.bufferMemory)
+	}
+}
+
 // connectOutputs connects to all outputs.
 func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput) error {
 	log.Printf("D! [agent] Attempting connection to [%s]", output.LogName())
@@ -739,65 +1314,112 @@ func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput)
 func (a *Agent) runOutputs(
 	unit *outputUnit,
 ) error {
-	var wg sync.WaitGroup
-
-	// Start flush loop
-	interval := a.Config.Agent.FlushInterval.Duration
-	jitter := a.Config.Agent.FlushJitter.Duration
-
-	ctx, cancel := context.WithCancel(context.Background())
-
+	unit.Lock()
 	for _, output := range unit.outputs {
-		interval := interval
-		// Overwrite agent flush_interval if this plugin has its own.
-		if output.Config.FlushInterval != 0 {
-			interval = output.Config.FlushInterval
+		a.startFlush(unit, output)
+	}
+	unit.Unlock()
+
+	for rm := range unit.src {
+		unit.Lock()
+		last := -1
+		for i, target := range unit.fan {
+			if target.config.ReceivesPipeline(rm.pipeline) {
+				last = i
+			}
 		}
-
-		jitter := jitter
-		// Overwrite agent flush_jitter if this plugin has its own.
-		if output.Config.FlushJitter != 0 {
-			jitter = output.Config.FlushJitter
+		if last < 0 {
+			rm.metric.Drop()
 		}
-
-		wg.Add(1)
-		go func(output *models.RunningOutput) {
-			defer wg.Done()
-
-			ticker := NewRollingTicker(interval, jitter)
-			defer ticker.Stop()
-
-			a.flushLoop(ctx, output, ticker)
-		}(output)
-	}
-
-	for metric := range unit.src {
-		for i, output := range unit.outputs {
-			if i == len(a.Config.Outputs)-1 {
-				output.AddMetric(metric)
+		for i, target := range unit.fan[:last+1] {
+			if !target.config.ReceivesPipeline(rm.pipeline) {
+				continue
+			}
+			if i == last {
+				target.AddMetric(rm.metric)
 			} else {
-				output.AddMetric(metric.Copy())
+				target.AddMetric(rm.metric.Copy())
 			}
 		}
+		unit.Unlock()
 	}
 
 	log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
-	cancel()
-	wg.Wait()
+	unit.Lock()
+	unit.stopped = true
+	for _, f := range unit.flushers {
+		f.cancel()
+	}
+	for _, f := range unit.flushers {
+		<-f.done
+	}
+	unit.Unlock()
+
+	log.Println("I! [agent] Stopping running outputs")
+	unit.Lock()
+	stopRunningOutputs(unit.outputs)
+	unit.Unlock()
 
 	return nil
 }
 
+// startFlush starts the flush loop of an output.  The unit must be locked.
+func (a *Agent) startFlush(unit *outputUnit, output *models.RunningOutput) {
+	// Overwrite agent flush_interval if this plugin has its own.
+	interval := a.Config.Agent.FlushInterval.Duration
+	if output.Config.FlushInterval != 0 {
+		interval = output.Config.FlushInterval
+	}
+
+	// Overwrite agent flush_jitter if this plugin has its own.
+	jitter := a.Config.Agent.FlushJitter.Duration
+	if output.Config.FlushJitter != 0 {
+		jitter = output.Config.FlushJitter
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &flusher{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		flushNow: make(chan struct{}, 1),
+	}
+	unit.flushers[output] = f
+
+	go func() {
+		defer close(f.done)
+
+		ticker := NewRollingTicker(interval, jitter)
+		defer ticker.Stop()
+
+		a.flushLoop(ctx, unit, output, ticker, f.flushNow)
+	}()
+}
+
+// stopRunningOutputs closes all outputs and their buffers.
+func stopRunningOutputs(outputs []*models.RunningOutput) {
+	for _, output := range outputs {
+		output.Close()
+	}
+}
+
 // flushLoop runs an output's flush function periodically until the context is
 // done.
 func (a *Agent) flushLoop(
 	ctx context.Context,
+	unit *outputUnit,
 	output *models.RunningOutput,
 	ticker Ticker,
+	flushNow <-chan struct{},
 ) {
 	logError := func(err error) {
 		if err != nil {
 			log.Printf("E! [agent] Error writing to %s: %v", output.LogName(), err)
+
+			// Buffered metrics are not moved during shutdown, as the other
+			// outputs may have already been flushed.
+			if ctx.Err() == nil {
+				a.writeFailed(unit, output)
+			}
 		}
 	}
 
@@ -823,6 +1445,8 @@ func (a *Agent) flushLoop(
 			logError(a.flushOnce(output, ticker, output.Write))
 		case <-flushRequested:
 			logError(a.flushOnce(output, ticker, output.Write))
+		case <-flushNow:
+			logError(a.flushOnce(output, ticker, output.Write))
 		case <-output.BatchReady:
 			// Favor the ticker over batch ready
 			select {
@@ -835,6 +1459,17 @@ func (a *Agent) flushLoop(
 	}
 }
 
+// writeFailed notifies the group of the output about a failed write.
+func (a *Agent) writeFailed(unit *outputUnit, output *models.RunningOutput) {
+	unit.Lock()
+	g := unit.groupOf(output)
+	unit.Unlock()
+
+	if g != nil {
+		g.writeFailed(output)
+	}
+}
+
 // flushOnce runs the output's Write function once, logging a warning each
 // interval it fails to complete before.
 func (a *Agent) flushOnce(
@@ -863,7 +1498,7 @@ func (a *Agent) flushOnce(
 // Test runs the inputs, processors and aggregators for a single gather and
 // writes the metrics to stdout.
 func (a *Agent) Test(ctx context.Context, wait time.Duration) error {
-	src := make(chan telegraf.Metric, 100)
+	src := make(chan routedMetric, 100)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -872,12 +1507,12 @@ func (a *Agent) Test(ctx context.Context, wait time.Duration) error {
 		s := influx.NewSerializer()
 		s.SetFieldSortOrder(influx.SortFields)
 
-		for metric := range src {
-			octets, err := s.Serialize(metric)
+		for rm := range src {
+			octets, err := s.Serialize(rm.metric)
 			if err == nil {
 				fmt.Print("> ", string(octets))
 			}
-			metric.Reject()
+			rm.metric.Reject()
 		}
 	}()
 
@@ -894,83 +1529,152 @@ func (a *Agent) Test(ctx context.Context, wait time.Duration) error {
 	return nil
 }
 
-// Test runs the agent and performs a single gather sending output to the
-// outputF.  After gathering pauses for the wait duration to allow service
-// inputs to run.
-func (a *Agent) test(ctx context.Context, wait time.Duration, outputC chan<- telegraf.Metric) error {
-	log.Printf("D! [agent] Initializing plugins")
-	err := a.initPlugins()
+// TestPipeline runs the inputs for a single gather through the processors
+// and aggregators, and writes the metrics each output would receive to stdout
+// grouped by output.  The members of output groups receive the metrics
+// according to the group mode.  When window is set, the inputs are gathered once per
+// interval of the window without waiting and the aggregators are pushed at the
+// end of the window.
+func (a *Agent) TestPipeline(ctx context.Context, wait time.Duration, window time.Duration) error {
+	received, err := a.testPipeline(ctx, wait, window)
 	if err != nil {
 		return err
 	}
 
-	startTime := time.Now()
-
-	next := outputC
+	groups := make(map[string]string)
+	for _, g := range a.Config.OutputGroups {
+		for _, member := range g.Outputs {
+			groups[member] = g.Name
+		}
+	}
 
-	var apu []*processorUnit
-	var au *aggregatorUnit
-	if len(a.Config.Aggregators) != 0 {
-		procC := next
-		if len(a.Config.AggProcessors) != 0 {
-			procC, apu, err = a.startProcessors(next, a.Config.AggProcessors)
-			if err != nil {
-				return err
+	s := influx.NewSerializer()
+	s.SetFieldSortOrder(influx.SortFields)
+	for i, output := range a.Config.Outputs {
+		if group, ok := groups[output.GroupMemberName()]; ok {
+			fmt.Printf("# %s in output group %q\n", output.LogName(), group)
+		} else {
+			fmt.Printf("# %s\n", output.LogName())
+		}
+		for _, m := range received[i] {
+			octets, err := s.Serialize(m)
+			if err == nil {
+				fmt.Print("> ", string(octets))
 			}
 		}
+	}
 
-		next, au, err = a.startAggregators(procC, next, a.Config.Aggregators)
-		if err != nil {
-			return err
+	if models.GlobalGatherErrors.Get() != 0 {
+		return fmt.Errorf("input plugins recorded %d errors", models.GlobalGatherErrors.Get())
+	}
+	return nil
+}
+
+// testPipeline runs the test and returns the metrics received by each output,
+// in the order of the outputs.  The outputs are not connected, the metrics are
+// only passed through their pipeline selection, output groups and filters.
+func (a *Agent) testPipeline(
+	ctx context.Context,
+	wait time.Duration,
+	window time.Duration,
+) ([][]telegraf.Metric, error) {
+	a.testWindow = window
+	defer func() {
+		a.testWindow = 0
+	}()
+
+	filtered := len(a.Config.OutputFilters) != 0
+	groups, err := newOutputGroups(a.Config.OutputGroups, a.Config.Outputs, filtered)
+	if err != nil {
+		return nil, err
+	}
+	unit := &outputUnit{outputs: a.Config.Outputs, groups: groups}
+	unit.updateFan()
+
+	src := make(chan routedMetric, 100)
+	var metrics []routedMetric
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for rm := range src {
+			metrics = append(metrics, rm)
+		}
+	}()
+
+	err = a.test(ctx, wait, src)
+	if err != nil {
+		return nil, err
+	}
+
+	wg.Wait()
+
+	index := make(map[*models.RunningOutput]int, len(a.Config.Outputs))
+	for i, output := range a.Config.Outputs {
+		index[output] = i
+	}
+	received := make([][]telegraf.Metric, len(a.Config.Outputs))
+	preview := func(output *models.RunningOutput, m telegraf.Metric) {
+		if m := output.Preview(m.Copy()); m != nil {
+			received[index[output]] = append(received[index[output]], m)
 		}
 	}
 
-	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
-		if err != nil {
-			return err
+	// The metrics are sent to the members of the groups as in runOutputs,
+	// with all members healthy.
+	for _, rm := range metrics {
+		for _, target := range unit.fan {
+			if !target.config.ReceivesPipeline(rm.pipeline) {
+				continue
+			}
+			switch t := target.metricAdder.(type) {
+			case *outputGroup:
+				for _, output := range t.receivers() {
+					preview(output, rm.metric)
+				}
+			case *models.RunningOutput:
+				preview(t, rm.metric)
+			}
 		}
+		rm.metric.Reject()
 	}
+	return received, nil
+}
 
-	iu, err := a.testStartInputs(next, a.Config.Inputs)
+// Test runs the agent and performs a single gather sending output to the
+// outputF.  After gathering pauses for the wait duration to allow service
+// inputs to run.
+func (a *Agent) test(ctx context.Context, wait time.Duration, outputC chan<- routedMetric) error {
+	log.Printf("D! [agent] Initializing plugins")
+	err := a.initPlugins(false)
 	if err != nil {
 		return err
 	}
 
-	var wg sync.WaitGroup
-
-	if au != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runProcessors(apu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
-			}
-		}()
+	startTime := time.Now()
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runAggregators(startTime, au)
-			if err != nil {
-				log.Printf("E! [agent] Error running aggregators: %v", err)
-			}
-		}()
+	pl, err := a.startPipeline(a.Config.Processors, a.Config.AggProcessors, a.Config.Aggregators)
+	if err != nil {
+		return err
 	}
 
-	if pu != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runProcessors(pu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
-			}
-		}()
+	router := newPipelineRouter(outputC)
+	a.runPipeline(router, startTime, pl)
+
+	iu, err := a.testStartInputs(router, a.Config.Inputs)
+	if err != nil {
+		return err
 	}
 
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.runRouter(router)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -1013,7 +1717,7 @@ func (a *Agent) Once(ctx context.Context, wait time.Duration) error {
 // inputs to run.
 func (a *Agent) once(ctx context.Context, wait time.Duration) error {
 	log.Printf("D! [agent] Initializing plugins")
-	err := a.initPlugins()
+	err := a.initPlugins(false)
 	if err != nil {
 		return err
 	}
@@ -1026,32 +1730,15 @@ func (a *Agent) once(ctx context.Context, wait time.Duration) error {
 		return err
 	}
 
-	var apu []*processorUnit
-	var au *aggregatorUnit
-	if len(a.Config.Aggregators) != 0 {
-		procC := next
-		if len(a.Config.AggProcessors) != 0 {
-			procC, apu, err = a.startProcessors(next, a.Config.AggProcessors)
-			if err != nil {
-				return err
-			}
-		}
-
-		next, au, err = a.startAggregators(procC, next, a.Config.Aggregators)
-		if err != nil {
-			return err
-		}
+	pl, err := a.startPipeline(a.Config.Processors, a.Config.AggProcessors, a.Config.Aggregators)
+	if err != nil {
+		return err
 	}
 
-	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
-		if err != nil {
-			return err
-		}
-	}
+	router := newPipelineRouter(next)
+	a.runPipeline(router, startTime, pl)
 
-	iu, err := a.testStartInputs(next, a.Config.Inputs)
+	iu, err := a.testStartInputs(router, a.Config.Inputs)
 	if err != nil {
 		return err
 	}
@@ -1066,36 +1753,11 @@ func (a *Agent) once(ctx context.Context, wait time.Duration) error {
 		}
 	}()
 
-	if au != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runProcessors(apu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
-			}
-		}()
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runAggregators(startTime, au)
-			if err != nil {
-				log.Printf("E! [agent] Error running aggregators: %v", err)
-			}
-		}()
-	}
-
-	if pu != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := a.runProcessors(pu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
-			}
-		}()
-	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.runRouter(router)
+	}()
 
 	wg.Add(1)
 	go func() {
@@ -1,12 +1,17 @@
 package agent
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
 	_ "github.com/influxdata/telegraf/plugins/outputs/all"
+	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -166,3 +171,176 @@ func TestWindow(t *testing.T) {
 		})
 	}
 }
+
+type suffixProcessor struct {
+	suffix string
+}
+
+func (p *suffixProcessor) SampleConfig() string {
+	return ""
+}
+
+func (p *suffixProcessor) Description() string {
+	return ""
+}
+
+func (p *suffixProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
+	for _, m := range in {
+		m.SetName(m.Name() + p.suffix)
+	}
+	return in
+}
+
+func TestAgent_Pipelines(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = internal.Duration{Duration: 10 * time.Millisecond}
+	c.Agent.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+
+	c.Inputs = append(c.Inputs,
+		models.NewRunningInput(&reloadInput{name: "x"},
+			&models.InputConfig{Name: "x"}),
+		models.NewRunningInput(&reloadInput{name: "y"},
+			&models.InputConfig{Name: "y", Pipeline: "p"}))
+	c.Processors = append(c.Processors, models.NewRunningProcessor(
+		processors.NewStreamingProcessorFromProcessor(&suffixProcessor{suffix: "_p"}),
+		&models.ProcessorConfig{Name: "suffix", Pipeline: "p"}))
+
+	newOutput := func(pipelines ...string) *reloadOutput {
+		output := &reloadOutput{names: make(map[string]bool)}
+		c.Outputs = append(c.Outputs, models.NewRunningOutput("test", output,
+			&models.OutputConfig{Name: "test", Pipelines: pipelines}, 0, 0))
+		return output
+	}
+	onlyP := newOutput("p")
+	onlyDefault := newOutput(models.DefaultPipeline)
+	all := newOutput()
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return all.received("x") && all.received("y_p") &&
+			onlyP.received("y_p") && onlyDefault.received("x")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// Processors only apply to their pipeline and outputs only receive the
+	// pipelines they selected.
+	require.False(t, all.received("x_p"))
+	require.False(t, all.received("y"))
+	require.False(t, onlyP.received("x"))
+	require.False(t, onlyDefault.received("y_p"))
+}
+
+type countAggregator struct {
+	count int
+}
+
+func (a *countAggregator) SampleConfig() string {
+	return ""
+}
+
+func (a *countAggregator) Description() string {
+	return ""
+}
+
+func (a *countAggregator) Add(in telegraf.Metric) {
+	a.count++
+}
+
+func (a *countAggregator) Push(acc telegraf.Accumulator) {
+	acc.AddFields("count", map[string]interface{}{"value": a.count}, nil)
+}
+
+func (a *countAggregator) Reset() {
+	a.count = 0
+}
+
+func TestAgent_TestPipeline(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = internal.Duration{Duration: 10 * time.Second}
+
+	c.Inputs = append(c.Inputs,
+		models.NewRunningInput(&reloadInput{name: "x"},
+			&models.InputConfig{Name: "x"}),
+		models.NewRunningInput(&reloadInput{name: "y"},
+			&models.InputConfig{Name: "y", Pipeline: "p"}))
+	c.Processors = append(c.Processors, models.NewRunningProcessor(
+		processors.NewStreamingProcessorFromProcessor(&suffixProcessor{suffix: "_p"}),
+		&models.ProcessorConfig{Name: "suffix", Pipeline: "p"}))
+	c.Aggregators = append(c.Aggregators, models.NewRunningAggregator(
+		&countAggregator{},
+		&models.AggregatorConfig{Name: "count", Period: time.Hour}))
+
+	filter := models.Filter{NamePass: []string{"count"}}
+	require.NoError(t, filter.Compile())
+	for _, oc := range []*models.OutputConfig{
+		{Name: "all"},
+		{Name: "only_p", Pipelines: []string{"p"}},
+		{Name: "filtered", Filter: filter, NamePrefix: "t_"},
+	} {
+		c.Outputs = append(c.Outputs, models.NewRunningOutput(oc.Name,
+			&reloadOutput{names: make(map[string]bool)}, oc, 0, 0))
+	}
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	// The inputs are gathered for each interval of the window without
+	// waiting and the aggregator is pushed at the end.
+	start := time.Now()
+	received, err := a.testPipeline(context.Background(), 0, time.Minute)
+	require.NoError(t, err)
+	require.Less(t, int64(time.Since(start)), int64(10*time.Second))
+
+	names := func(metrics []telegraf.Metric) map[string]int {
+		result := make(map[string]int)
+		for _, m := range metrics {
+			result[m.Name()]++
+		}
+		return result
+	}
+	require.Len(t, received, 3)
+	require.Equal(t, map[string]int{"x": 6, "y_p": 6, "count": 1}, names(received[0]))
+	require.Equal(t, map[string]int{"y_p": 6}, names(received[1]))
+	require.Equal(t, map[string]int{"t_count": 1}, names(received[2]))
+
+	v, ok := received[2][0].GetField("value")
+	require.True(t, ok)
+	require.Equal(t, int64(6), v)
+}
+
+func TestAgent_TestPipelineGroups(t *testing.T) {
+	c := config.NewConfig()
+	c.Agent.Interval = internal.Duration{Duration: 10 * time.Second}
+	c.Inputs = append(c.Inputs, models.NewRunningInput(&reloadInput{name: "x"},
+		&models.InputConfig{Name: "x"}))
+	for _, alias := range []string{"a", "b", "c", "d"} {
+		c.Outputs = append(c.Outputs, models.NewRunningOutput("test",
+			&reloadOutput{names: make(map[string]bool)},
+			&models.OutputConfig{Name: "test", Alias: alias}, 0, 0))
+	}
+	c.OutputGroups = []*models.OutputGroupConfig{
+		{Name: "failover", Mode: models.OutputGroupFailover, Outputs: []string{"a", "b"}},
+		{Name: "spread", Mode: models.OutputGroupRoundRobin, Outputs: []string{"c", "d"}},
+	}
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	received, err := a.testPipeline(context.Background(), 0, 40*time.Second)
+	require.NoError(t, err)
+	require.Len(t, received, 4)
+	require.Len(t, received[0], 4)
+	require.Empty(t, received[1])
+	require.Len(t, received[2], 2)
+	require.Len(t, received[3], 2)
+}
@@ -0,0 +1,372 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf/models"
+)
+
+// apiServer is the local HTTP API used to inspect and control the running
+// agent.
+//
+//	GET  /plugins               loaded plugins
+//	GET  /inputs                gather status of the inputs
+//	GET  /outputs               buffer status of the outputs
+//	POST /inputs/pause?name=    pause inputs, optionally filtered by &alias=
+//	POST /inputs/resume?name=   resume inputs
+//	POST /outputs/flush?name=   flush outputs now
+//	POST /reload                reload the configuration
+//	GET  /tap?stage=            stream the metrics of a pipeline stage
+//
+// Browsers can reach an API listening on the loopback interface, so requests
+// for another host, as sent after a DNS rebinding, are rejected on TCP and the
+// actions require a JSON content type, which a page cannot post to another
+// origin without a CORS preflight.
+type apiServer struct {
+	agent  *Agent
+	iu     *inputUnit
+	router *pipelineRouter
+	ou     *outputUnit
+
+	// checkHost rejects requests for hosts other than the loopback interface.
+	checkHost bool
+}
+
+type apiPlugin struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias,omitempty"`
+}
+
+type apiPlugins struct {
+	Inputs      []apiPlugin `json:"inputs"`
+	Processors  []apiPlugin `json:"processors"`
+	Aggregators []apiPlugin `json:"aggregators"`
+	Outputs     []apiPlugin `json:"outputs"`
+}
+
+type apiInput struct {
+	apiPlugin
+	Paused             bool       `json:"paused"`
+	LastGather         *time.Time `json:"last_gather,omitempty"`
+	LastGatherDuration int64      `json:"last_gather_duration_ns"`
+	LastError          string     `json:"last_error,omitempty"`
+	LastErrorTime      *time.Time `json:"last_error_time,omitempty"`
+}
+
+type apiOutput struct {
+	apiPlugin
+	BufferLength int    `json:"buffer_length"`
+	BufferLimit  int    `json:"buffer_limit"`
+	BreakerState string `json:"breaker_state"`
+}
+
+type apiResult struct {
+	Matched int    `json:"matched,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// listenAPI opens the listener of the API, the address is either "host:port"
+// or "unix:///path/to/socket".  The API has no authentication, TCP addresses
+// must be on the loopback interface.
+func listenAPI(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, "unix://") {
+		path := strings.TrimPrefix(address, "unix://")
+		// Remove a socket left behind by an unclean shutdown.
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", strings.TrimPrefix(address, "tcp://"))
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IP.IsLoopback() {
+		return nil, fmt.Errorf("api_address %q is not a loopback address, use a loopback address or a unix socket", address)
+	}
+	return net.ListenTCP("tcp", addr)
+}
+
+// runAPI serves the API until the context is done.
+func (a *Agent) runAPI(
+	ctx context.Context,
+	listener net.Listener,
+	iu *inputUnit,
+	router *pipelineRouter,
+	ou *outputUnit,
+) {
+	api := &apiServer{
+		agent:     a,
+		iu:        iu,
+		router:    router,
+		ou:        ou,
+		checkHost: listener.Addr().Network() == "tcp",
+	}
+	server := &http.Server{
+		Handler:     api.handler(),
+		ReadTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Printf("I! [agent] Listening for API requests on %s", listener.Addr())
+	err := server.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		log.Printf("E! [agent] Error serving API: %v", err)
+	}
+}
+
+func (api *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plugins", api.get(api.plugins))
+	mux.HandleFunc("/inputs", api.get(api.inputs))
+	mux.HandleFunc("/outputs", api.get(api.outputs))
+	mux.HandleFunc("/inputs/pause", api.post(api.pauseInputs))
+	mux.HandleFunc("/inputs/resume", api.post(api.resumeInputs))
+	mux.HandleFunc("/outputs/flush", api.post(api.flushOutputs))
+	mux.HandleFunc("/reload", api.post(api.reload))
+	mux.HandleFunc("/tap", api.tap)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if api.checkHost && !isLoopbackHost(req.Host) {
+			writeJSON(w, http.StatusForbidden,
+				apiResult{Error: fmt.Sprintf("host %q not allowed", req.Host)})
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
+
+// isLoopbackHost returns true if the host of the request, with an optional
+// port, is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func (api *apiServer) get(f func(*http.Request) (int, interface{})) http.HandlerFunc {
+	return api.method(http.MethodGet, f)
+}
+
+func (api *apiServer) post(f func(*http.Request) (int, interface{})) http.HandlerFunc {
+	return api.method(http.MethodPost, f)
+}
+
+func (api *apiServer) method(method string, f func(*http.Request) (int, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed,
+				apiResult{Error: fmt.Sprintf("method %s not allowed", req.Method)})
+			return
+		}
+		if method == http.MethodPost {
+			mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if mediaType != "application/json" {
+				writeJSON(w, http.StatusUnsupportedMediaType,
+					apiResult{Error: "actions require the application/json content type"})
+				return
+			}
+		}
+		status, body := f(req)
+		writeJSON(w, status, body)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("E! [agent] Error writing API response: %v", err)
+	}
+}
+
+func (api *apiServer) plugins(req *http.Request) (int, interface{}) {
+	result := apiPlugins{
+		Inputs:      []apiPlugin{},
+		Processors:  []apiPlugin{},
+		Aggregators: []apiPlugin{},
+		Outputs:     []apiPlugin{},
+	}
+
+	for _, input := range api.runningInputs() {
+		result.Inputs = append(result.Inputs, apiPlugin{input.Config.Name, input.Config.Alias})
+	}
+
+	api.router.RLock()
+	if unit := api.router.unit; unit != nil {
+		for _, processor := range unit.processors {
+			result.Processors = append(result.Processors, apiPlugin{processor.Config.Name, processor.Config.Alias})
+		}
+		for _, aggregator := range unit.aggregators {
+			result.Aggregators = append(result.Aggregators, apiPlugin{aggregator.Config.Name, aggregator.Config.Alias})
+		}
+	}
+	api.router.RUnlock()
+
+	for _, output := range api.runningOutputs() {
+		result.Outputs = append(result.Outputs, apiPlugin{output.Config.Name, output.Config.Alias})
+	}
+	return http.StatusOK, result
+}
+
+func (api *apiServer) inputs(req *http.Request) (int, interface{}) {
+	result := []apiInput{}
+	for _, input := range api.runningInputs() {
+		status := input.GatherStatus()
+		i := apiInput{
+			apiPlugin:          apiPlugin{input.Config.Name, input.Config.Alias},
+			Paused:             input.Paused(),
+			LastGatherDuration: status.LastGatherDuration.Nanoseconds(),
+			LastError:          status.LastError,
+		}
+		if !status.LastGather.IsZero() {
+			i.LastGather = &status.LastGather
+		}
+		if !status.LastErrorTime.IsZero() {
+			i.LastErrorTime = &status.LastErrorTime
+		}
+		result = append(result, i)
+	}
+	return http.StatusOK, result
+}
+
+func (api *apiServer) outputs(req *http.Request) (int, interface{}) {
+	result := []apiOutput{}
+	for _, output := range api.runningOutputs() {
+		result = append(result, apiOutput{
+			apiPlugin:    apiPlugin{output.Config.Name, output.Config.Alias},
+			BufferLength: output.BufferLength(),
+			BufferLimit:  output.MetricBufferLimit,
+			BreakerState: breakerStateName(output.BreakerState()),
+		})
+	}
+	return http.StatusOK, result
+}
+
+func (api *apiServer) pauseInputs(req *http.Request) (int, interface{}) {
+	return api.eachInput(req, func(input *models.RunningInput) {
+		log.Printf("I! [agent] Pausing input %s", input.LogName())
+		input.Pause()
+	})
+}
+
+func (api *apiServer) resumeInputs(req *http.Request) (int, interface{}) {
+	return api.eachInput(req, func(input *models.RunningInput) {
+		log.Printf("I! [agent] Resuming input %s", input.LogName())
+		input.Resume()
+	})
+}
+
+func (api *apiServer) flushOutputs(req *http.Request) (int, interface{}) {
+	name, alias, err := pluginQuery(req)
+	if err != nil {
+		return http.StatusBadRequest, apiResult{Error: err.Error()}
+	}
+
+	matched := 0
+	api.ou.Lock()
+	for _, output := range api.ou.outputs {
+		if !pluginMatches(output.Config.Name, output.Config.Alias, name, alias) {
+			continue
+		}
+		matched++
+		if f, ok := api.ou.flushers[output]; ok {
+			select {
+			case f.flushNow <- struct{}{}:
+			default:
+			}
+		}
+	}
+	api.ou.Unlock()
+
+	if matched == 0 {
+		return http.StatusNotFound, apiResult{Error: "no matching outputs"}
+	}
+	return http.StatusAccepted, apiResult{Matched: matched}
+}
+
+func (api *apiServer) reload(req *http.Request) (int, interface{}) {
+	if api.agent.RequestReload == nil {
+		return http.StatusNotImplemented, apiResult{Error: "reload is not supported"}
+	}
+	api.agent.RequestReload()
+	return http.StatusAccepted, apiResult{}
+}
+
+func (api *apiServer) eachInput(req *http.Request, f func(*models.RunningInput)) (int, interface{}) {
+	name, alias, err := pluginQuery(req)
+	if err != nil {
+		return http.StatusBadRequest, apiResult{Error: err.Error()}
+	}
+
+	matched := 0
+	for _, input := range api.runningInputs() {
+		if pluginMatches(input.Config.Name, input.Config.Alias, name, alias) {
+			f(input)
+			matched++
+		}
+	}
+
+	if matched == 0 {
+		return http.StatusNotFound, apiResult{Error: "no matching inputs"}
+	}
+	return http.StatusOK, apiResult{Matched: matched}
+}
+
+func (api *apiServer) runningInputs() []*models.RunningInput {
+	api.iu.Lock()
+	defer api.iu.Unlock()
+	return append([]*models.RunningInput(nil), api.iu.inputs...)
+}
+
+func (api *apiServer) runningOutputs() []*models.RunningOutput {
+	api.ou.Lock()
+	defer api.ou.Unlock()
+	return append([]*models.RunningOutput(nil), api.ou.outputs...)
+}
+
+// pluginQuery returns the plugin name and optional alias selected by the
+// request.
+func pluginQuery(req *http.Request) (string, string, error) {
+	query := req.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		return "", "", fmt.Errorf("name parameter is required")
+	}
+	return name, query.Get("alias"), nil
+}
+
+func pluginMatches(name, alias, queryName, queryAlias string) bool {
+	return name == queryName && (queryAlias == "" || alias == queryAlias)
+}
+
+func breakerStateName(state int) string {
+	switch state {
+	case models.BreakerOpen:
+		return "open"
+	case models.BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
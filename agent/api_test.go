@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/models"
+	"github.com/stretchr/testify/require"
+)
+
+type apiTestInput struct{}
+
+func (i *apiTestInput) SampleConfig() string {
+	return ""
+}
+
+func (i *apiTestInput) Description() string {
+	return ""
+}
+
+func (i *apiTestInput) Gather(acc telegraf.Accumulator) error {
+	return errors.New("gather failed")
+}
+
+func newTestAPI(t *testing.T) (*apiServer, *models.RunningInput, *models.RunningOutput) {
+	input := models.NewRunningInput(&apiTestInput{},
+		&models.InputConfig{Name: "test", Alias: "a"})
+	output, _ := newGroupOutput("b")
+
+	a, err := NewAgent(config.NewConfig())
+	require.NoError(t, err)
+
+	ou := &outputUnit{
+		outputs: []*models.RunningOutput{output},
+		flushers: map[*models.RunningOutput]*flusher{
+			output: {flushNow: make(chan struct{}, 1)},
+		},
+	}
+	api := &apiServer{
+		agent:  a,
+		iu:     &inputUnit{inputs: []*models.RunningInput{input}},
+		router: &pipelineRouter{unit: &pipelineUnit{}},
+		ou:     ou,
+	}
+	return api, input, output
+}
+
+func apiRequest(t *testing.T, api *apiServer, method, url string, body interface{}) int {
+	req := httptest.NewRequest(method, url, nil)
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	api.handler().ServeHTTP(w, req)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	if body != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), body))
+	}
+	return w.Code
+}
+
+func TestListenAPI(t *testing.T) {
+	listener, err := listenAPI("127.0.0.1:0")
+	require.NoError(t, err)
+	listener.Close()
+
+	_, err = listenAPI(":0")
+	require.Error(t, err)
+	_, err = listenAPI("0.0.0.0:0")
+	require.Error(t, err)
+}
+
+func TestAPI_BrowserRequests(t *testing.T) {
+	api, input, _ := newTestAPI(t)
+	api.checkHost = true
+
+	// Requests for another host name, as sent after a DNS rebinding.
+	for _, path := range []string{"/plugins", "/tap?stage=inputs.test"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		api.handler().ServeHTTP(w, req)
+		require.Equal(t, http.StatusForbidden, w.Code, path)
+	}
+
+	for _, host := range []string{"localhost:8008", "127.0.0.1:8008", "[::1]:8008"} {
+		req := httptest.NewRequest("GET", "/plugins", nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		api.handler().ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, host)
+	}
+
+	// Forms posted by a page of another origin.
+	req := httptest.NewRequest("POST", "/inputs/pause?name=test", nil)
+	req.Host = "localhost:8008"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	api.handler().ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	require.False(t, input.Paused())
+}
+
+func TestAPI_Plugins(t *testing.T) {
+	api, _, _ := newTestAPI(t)
+
+	var plugins apiPlugins
+	require.Equal(t, http.StatusOK, apiRequest(t, api, "GET", "/plugins", &plugins))
+	require.Equal(t, apiPlugins{
+		Inputs:      []apiPlugin{{Name: "test", Alias: "a"}},
+		Processors:  []apiPlugin{},
+		Aggregators: []apiPlugin{},
+		Outputs:     []apiPlugin{{Name: "test", Alias: "b"}},
+	}, plugins)
+
+	require.Equal(t, http.StatusMethodNotAllowed, apiRequest(t, api, "POST", "/plugins", nil))
+}
+
+func TestAPI_Inputs(t *testing.T) {
+	api, input, _ := newTestAPI(t)
+
+	acc := NewAccumulator(input, make(chan telegraf.Metric, 1))
+	acc.AddError(input.Gather(acc))
+
+	var inputs []apiInput
+	require.Equal(t, http.StatusOK, apiRequest(t, api, "GET", "/inputs", &inputs))
+	require.Len(t, inputs, 1)
+	require.Equal(t, "gather failed", inputs[0].LastError)
+	require.NotNil(t, inputs[0].LastGather)
+	require.NotNil(t, inputs[0].LastErrorTime)
+	require.False(t, inputs[0].Paused)
+
+	require.Equal(t, http.StatusOK, apiRequest(t, api, "POST", "/inputs/pause?name=test&alias=a", nil))
+	require.True(t, input.Paused())
+	require.Equal(t, http.StatusNotFound, apiRequest(t, api, "POST", "/inputs/resume?name=test&alias=x", nil))
+	require.True(t, input.Paused())
+	require.Equal(t, http.StatusOK, apiRequest(t, api, "POST", "/inputs/resume?name=test", nil))
+	require.False(t, input.Paused())
+	require.Equal(t, http.StatusBadRequest, apiRequest(t, api, "POST", "/inputs/pause", nil))
+}
+
+func TestAPI_Outputs(t *testing.T) {
+	api, _, output := newTestAPI(t)
+	output.AddMetric(groupTestMetric("a"))
+
+	var outputs []apiOutput
+	require.Equal(t, http.StatusOK, apiRequest(t, api, "GET", "/outputs", &outputs))
+	require.Equal(t, []apiOutput{{
+		apiPlugin:    apiPlugin{Name: "test", Alias: "b"},
+		BufferLength: 1,
+		BufferLimit:  models.DEFAULT_METRIC_BUFFER_LIMIT,
+		BreakerState: "closed",
+	}}, outputs)
+
+	require.Equal(t, http.StatusAccepted, apiRequest(t, api, "POST", "/outputs/flush?name=test", nil))
+	select {
+	case <-api.ou.flushers[output].flushNow:
+	case <-time.After(time.Second):
+		t.Fatal("flush not requested")
+	}
+}
+
+func TestAPI_Reload(t *testing.T) {
+	api, _, _ := newTestAPI(t)
+	require.Equal(t, http.StatusNotImplemented, apiRequest(t, api, "POST", "/reload", nil))
+
+	var requested bool
+	api.agent.RequestReload = func() {
+		requested = true
+	}
+	require.Equal(t, http.StatusAccepted, apiRequest(t, api, "POST", "/reload", nil))
+	require.True(t, requested)
+}
+
+func TestAPI_Tap(t *testing.T) {
+	api, input, output := newTestAPI(t)
+	server := httptest.NewServer(api.handler())
+	defer server.Close()
+
+	query := url.Values{"stage": {"inputs.test"}, "filter": {"fields.value > 1"}}
+	resp, err := http.Get(server.URL + "/tap?" + query.Encode())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	r := bufio.NewReader(resp.Body)
+
+	// Metrics emitted by the input are streamed once the response started,
+	// metrics of other stages or not matching the filter are not.
+	acc := NewAccumulator(input, make(chan telegraf.Metric, 10))
+	acc.AddFields("cpu", map[string]interface{}{"value": 1}, nil, time.Unix(0, 0))
+	output.AddMetric(groupTestMetric("mem"))
+	acc.AddFields("cpu", map[string]interface{}{"value": 2}, nil, time.Unix(0, 0))
+
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "cpu value=2i 0\n", line)
+
+	// The stream ends when the input is stopped.
+	input.Tap().Close()
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "# inputs.test stopped\n", line)
+	_, err = r.ReadString('\n')
+	require.Equal(t, io.EOF, err)
+}
+
+func TestAPI_TapOutput(t *testing.T) {
+	api, _, output := newTestAPI(t)
+	server := httptest.NewServer(api.handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tap?stage=outputs.test&alias=b")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	output.AddMetric(groupTestMetric("mem"))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "mem value=42i 0\n", line)
+}
+
+func TestAPI_TapErrors(t *testing.T) {
+	api, _, _ := newTestAPI(t)
+	require.Equal(t, http.StatusBadRequest, apiRequest(t, api, "GET", "/tap", nil))
+	require.Equal(t, http.StatusBadRequest, apiRequest(t, api, "GET", "/tap?stage=test", nil))
+	require.Equal(t, http.StatusBadRequest, apiRequest(t, api, "GET", "/tap?stage=parsers.test", nil))
+	require.Equal(t, http.StatusBadRequest, apiRequest(t, api, "GET", "/tap?stage=inputs.test&filter=name+%3D%3D", nil))
+	require.Equal(t, http.StatusNotFound, apiRequest(t, api, "GET", "/tap?stage=inputs.test&alias=x", nil))
+	require.Equal(t, http.StatusNotFound, apiRequest(t, api, "GET", "/tap?stage=processors.test", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, apiRequest(t, api, "POST", "/tap?stage=inputs.test", nil))
+}
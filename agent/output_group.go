@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/models"
+)
+
+// outputGroup routes the metrics sent to a group of outputs according to the
+// group mode.  Members that fail to write are avoided for the failback
+// interval and their buffered metrics are moved to the active member.
+type outputGroup struct {
+	sync.Mutex
+	config  *models.OutputGroupConfig
+	members []*models.RunningOutput
+
+	failedAt map[*models.RunningOutput]time.Time
+	active   *models.RunningOutput
+	next     int
+
+	now func() time.Time
+}
+
+func newOutputGroup(config *models.OutputGroupConfig, members []*models.RunningOutput) *outputGroup {
+	return &outputGroup{
+		config:   config,
+		members:  members,
+		failedAt: make(map[*models.RunningOutput]time.Time),
+		now:      time.Now,
+	}
+}
+
+// newOutputGroups builds the output groups, groups without any loaded member
+// are left out.
+func newOutputGroups(
+	configs []*models.OutputGroupConfig,
+	outputs []*models.RunningOutput,
+	filtered bool,
+) ([]*outputGroup, error) {
+	members, err := models.OutputGroupMembers(configs, outputs, filtered)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*outputGroup, 0, len(configs))
+	for i, config := range configs {
+		if len(members[i]) == 0 {
+			continue
+		}
+		groups = append(groups, newOutputGroup(config, members[i]))
+	}
+	return groups, nil
+}
+
+// AddMetric sends the metric to the group members according to the group
+// mode.
+//
+// Takes ownership of metric
+func (g *outputGroup) AddMetric(metric telegraf.Metric) {
+	if g.config.Mode == models.OutputGroupBroadcast {
+		for i, output := range g.members {
+			if i == len(g.members)-1 {
+				output.AddMetric(metric)
+			} else {
+				output.AddMetric(metric.Copy())
+			}
+		}
+		return
+	}
+
+	g.Lock()
+	output := g.pick()
+	g.Unlock()
+
+	output.AddMetric(metric)
+}
+
+// receivers returns the members that receive the next metric, picked as by
+// AddMetric.
+func (g *outputGroup) receivers() []*models.RunningOutput {
+	if g.config.Mode == models.OutputGroupBroadcast {
+		return g.members
+	}
+
+	g.Lock()
+	defer g.Unlock()
+	return []*models.RunningOutput{g.pick()}
+}
+
+// pick selects the member for the next metric.  The group must be locked.
+func (g *outputGroup) pick() *models.RunningOutput {
+	now := g.now()
+	if g.config.Mode == models.OutputGroupRoundRobin {
+		for i := range g.members {
+			output := g.members[(g.next+i)%len(g.members)]
+			if g.healthy(output, now) {
+				g.next = (g.next + i + 1) % len(g.members)
+				return output
+			}
+		}
+		output := g.members[g.next]
+		g.next = (g.next + 1) % len(g.members)
+		return output
+	}
+
+	output := g.preferred(now)
+	if output != g.active {
+		if g.active != nil {
+			log.Printf("I! [agent] Output group %q switched to %s", g.config.Name, output.LogName())
+		}
+		g.active = output
+	}
+	return output
+}
+
+// preferred returns the first healthy member, or the member whose failure is
+// the oldest if all members failed recently.  The group must be locked.
+func (g *outputGroup) preferred(now time.Time) *models.RunningOutput {
+	oldest := g.members[0]
+	for _, output := range g.members {
+		if g.healthy(output, now) {
+			return output
+		}
+		if g.failedAt[output].Before(g.failedAt[oldest]) {
+			oldest = output
+		}
+	}
+	return oldest
+}
+
+// healthy returns true if the member did not fail within the failback
+// interval.  The group must be locked.
+func (g *outputGroup) healthy(output *models.RunningOutput, now time.Time) bool {
+	failedAt, ok := g.failedAt[output]
+	return !ok || now.Sub(failedAt) >= g.config.FailbackInterval
+}
+
+// writeFailed marks the member as failed and moves its buffered metrics to the
+// member that replaces it.  It must be called from the flush loop of the
+// member so that the member is not writing.
+func (g *outputGroup) writeFailed(output *models.RunningOutput) {
+	if g.config.Mode == models.OutputGroupBroadcast {
+		return
+	}
+
+	g.Lock()
+	g.failedAt[output] = g.now()
+	target := g.pick()
+	g.Unlock()
+
+	if target == output {
+		return
+	}
+
+	metrics := output.Drain()
+	if len(metrics) == 0 {
+		return
+	}
+	log.Printf("I! [agent] Output group %q moved %d buffered metrics from %s to %s",
+		g.config.Name, len(metrics), output.LogName(), target.LogName())
+	target.AddBuffered(metrics)
+}
+
+// contains returns true if the output is a member of the group.
+func (g *outputGroup) contains(output *models.RunningOutput) bool {
+	for _, member := range g.members {
+		if member == output {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type groupOutput struct {
+	sync.Mutex
+	metrics   []telegraf.Metric
+	failWrite bool
+}
+
+func (o *groupOutput) SampleConfig() string {
+	return ""
+}
+
+func (o *groupOutput) Description() string {
+	return ""
+}
+
+func (o *groupOutput) Connect() error {
+	return nil
+}
+
+func (o *groupOutput) Close() error {
+	return nil
+}
+
+func (o *groupOutput) Write(metrics []telegraf.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.failWrite {
+		return errors.New("failed write")
+	}
+	o.metrics = append(o.metrics, metrics...)
+	return nil
+}
+
+func newGroupOutput(alias string) (*models.RunningOutput, *groupOutput) {
+	output := &groupOutput{}
+	ro := models.NewRunningOutput("test", output,
+		&models.OutputConfig{Name: "test", Alias: alias}, 0, 0)
+	return ro, output
+}
+
+func groupTestMetric(name string) telegraf.Metric {
+	return testutil.MustMetric(name,
+		map[string]string{},
+		map[string]interface{}{"value": 42},
+		time.Unix(0, 0))
+}
+
+func TestOutputGroup_Failover(t *testing.T) {
+	primary, p := newGroupOutput("primary")
+	secondary, s := newGroupOutput("secondary")
+
+	now := time.Unix(0, 0)
+	g := newOutputGroup(&models.OutputGroupConfig{
+		Name:             "influxdb",
+		Mode:             models.OutputGroupFailover,
+		Outputs:          []string{"primary", "secondary"},
+		FailbackInterval: time.Minute,
+	}, []*models.RunningOutput{primary, secondary})
+	g.now = func() time.Time { return now }
+
+	g.AddMetric(groupTestMetric("a"))
+	g.AddMetric(groupTestMetric("b"))
+	require.Equal(t, 2, primary.BufferLength())
+	require.Equal(t, 0, secondary.BufferLength())
+
+	// The buffered metrics move to the secondary when the primary fails.
+	p.failWrite = true
+	require.Error(t, primary.Write())
+	g.writeFailed(primary)
+	require.Equal(t, 0, primary.BufferLength())
+	require.Equal(t, 2, secondary.BufferLength())
+
+	g.AddMetric(groupTestMetric("c"))
+	require.NoError(t, secondary.Write())
+	require.Len(t, s.metrics, 3)
+
+	// The primary is used again after the failback interval.
+	now = now.Add(time.Minute)
+	g.AddMetric(groupTestMetric("d"))
+	require.Equal(t, 1, primary.BufferLength())
+	require.Equal(t, 0, secondary.BufferLength())
+}
+
+func TestOutputGroup_RoundRobin(t *testing.T) {
+	first, _ := newGroupOutput("first")
+	second, _ := newGroupOutput("second")
+	third, _ := newGroupOutput("third")
+
+	g := newOutputGroup(&models.OutputGroupConfig{
+		Name:             "spread",
+		Mode:             models.OutputGroupRoundRobin,
+		Outputs:          []string{"first", "second", "third"},
+		FailbackInterval: time.Minute,
+	}, []*models.RunningOutput{first, second, third})
+
+	for i := 0; i < 6; i++ {
+		g.AddMetric(groupTestMetric("a"))
+	}
+	require.Equal(t, 2, first.BufferLength())
+	require.Equal(t, 2, second.BufferLength())
+	require.Equal(t, 2, third.BufferLength())
+
+	// Failed members are skipped.
+	g.writeFailed(second)
+	require.Equal(t, 0, second.BufferLength())
+	for i := 0; i < 4; i++ {
+		g.AddMetric(groupTestMetric("a"))
+	}
+	require.Equal(t, 0, second.BufferLength())
+	require.Equal(t, 10, first.BufferLength()+third.BufferLength())
+}
+
+func TestOutputGroup_Broadcast(t *testing.T) {
+	first, _ := newGroupOutput("first")
+	second, _ := newGroupOutput("second")
+
+	g := newOutputGroup(&models.OutputGroupConfig{
+		Name:    "all",
+		Mode:    models.OutputGroupBroadcast,
+		Outputs: []string{"first", "second"},
+	}, []*models.RunningOutput{first, second})
+
+	g.AddMetric(groupTestMetric("a"))
+	g.writeFailed(first)
+	require.Equal(t, 1, first.BufferLength())
+	require.Equal(t, 1, second.BufferLength())
+}
+
+func TestNewOutputGroups(t *testing.T) {
+	first, _ := newGroupOutput("first")
+	second, _ := newGroupOutput("second")
+	outputs := []*models.RunningOutput{first, second}
+
+	groups, err := newOutputGroups([]*models.OutputGroupConfig{
+		{Name: "a", Mode: models.OutputGroupFailover, Outputs: []string{"second", "first"}},
+	}, outputs, false)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Equal(t, []*models.RunningOutput{second, first}, groups[0].members)
+
+	_, err = newOutputGroups([]*models.OutputGroupConfig{
+		{Name: "a", Mode: models.OutputGroupFailover, Outputs: []string{"first", "third"}},
+	}, outputs, false)
+	require.Error(t, err)
+
+	groups, err = newOutputGroups([]*models.OutputGroupConfig{
+		{Name: "a", Mode: models.OutputGroupFailover, Outputs: []string{"first", "third"}},
+	}, outputs, true)
+	require.NoError(t, err)
+	require.Equal(t, []*models.RunningOutput{first}, groups[0].members)
+
+	_, err = newOutputGroups([]*models.OutputGroupConfig{
+		{Name: "a", Mode: models.OutputGroupFailover, Outputs: []string{"first"}},
+		{Name: "b", Mode: models.OutputGroupFailover, Outputs: []string{"first", "second"}},
+	}, outputs, false)
+	require.Error(t, err)
+
+	// All members must receive the same pipelines.
+	second.Config.Pipelines = []string{"other"}
+	_, err = newOutputGroups([]*models.OutputGroupConfig{
+		{Name: "a", Mode: models.OutputGroupFailover, Outputs: []string{"first", "second"}},
+	}, outputs, false)
+	require.Error(t, err)
+
+	first.Config.Pipelines = []string{"other"}
+	_, err = newOutputGroups([]*models.OutputGroupConfig{
+		{Name: "a", Mode: models.OutputGroupFailover, Outputs: []string{"first", "second"}},
+	}, outputs, false)
+	require.NoError(t, err)
+}
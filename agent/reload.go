@@ -0,0 +1,447 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/models"
+)
+
+// ErrRestartRequired is returned by Reload when the new configuration cannot
+// be applied to the running agent, the agent must be restarted instead.
+var ErrRestartRequired = errors.New("configuration change requires a restart of the agent")
+
+type reloadRequest struct {
+	config *config.Config
+	err    chan error
+}
+
+// Reload applies a new configuration to the running agent.  Only the plugins
+// that were added, removed or changed are stopped and started, all other
+// plugins keep running along with their buffers and connections.  Changing
+// any processor or aggregator restarts all processors and aggregators.
+//
+// If the agent settings or the global tags changed, ErrRestartRequired is
+// returned and the running plugins are unchanged.
+func (a *Agent) Reload(ctx context.Context, c *config.Config) error {
+	req := &reloadRequest{config: c, err: make(chan error, 1)}
+	select {
+	case a.reloadC <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.err
+}
+
+// handleReloads applies reload requests until the context is done.
+func (a *Agent) handleReloads(
+	ctx context.Context,
+	iu *inputUnit,
+	router *pipelineRouter,
+	ou *outputUnit,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-a.reloadC:
+			req.err <- a.reload(ctx, req.config, iu, router, ou)
+		}
+	}
+}
+
+func (a *Agent) reload(
+	ctx context.Context,
+	c *config.Config,
+	iu *inputUnit,
+	router *pipelineRouter,
+	ou *outputUnit,
+) error {
+	if !reflect.DeepEqual(a.Config.Agent, c.Agent) || !reflect.DeepEqual(a.Config.Tags, c.Tags) {
+		return ErrRestartRequired
+	}
+
+	inputMatch := matchPlugins(inputKeys(a.Config.Inputs), inputKeys(c.Inputs))
+	outputMatch := matchPlugins(outputKeys(a.Config.Outputs), outputKeys(c.Outputs))
+
+	// The pipeline is kept only if the processors are identical and run in
+	// the same order.
+	pipelineChanged := !sameKeys(processorKeys(a.Config.Processors), processorKeys(c.Processors)) ||
+		!sameKeys(aggregatorKeys(a.Config.Aggregators), aggregatorKeys(c.Aggregators))
+
+	filtered := len(c.OutputFilters) != 0
+	if _, err := newOutputGroups(c.OutputGroups, c.Outputs, filtered); err != nil {
+		return err
+	}
+	groupsChanged := !reflect.DeepEqual(a.Config.OutputGroups, c.OutputGroups)
+
+	// Initialize the new plugins first, so that an invalid plugin leaves the
+	// running agent untouched.
+	for i, input := range c.Inputs {
+		if inputMatch[i] >= 0 {
+			continue
+		}
+		if err := input.Init(); err != nil {
+			return fmt.Errorf("could not initialize input %s: %v", input.LogName(), err)
+		}
+	}
+	for i, output := range c.Outputs {
+		if outputMatch[i] >= 0 {
+			continue
+		}
+		if err := output.InitOutput(); err != nil {
+			return fmt.Errorf("could not initialize output %s: %v", output.LogName(), err)
+		}
+	}
+	if pipelineChanged {
+		if err := initPipeline(c); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+
+	// Outputs are replaced before the inputs so that metrics from new inputs
+	// reach the new outputs.  Removed outputs are stopped before the buffers
+	// of the new outputs are opened as they may share a disk buffer.
+	var outputs []*models.RunningOutput
+	for i, output := range a.Config.Outputs {
+		if !isMatched(outputMatch, i) {
+			log.Printf("I! [agent] Stopping output %s", output.LogName())
+			a.stopOutput(ou, output)
+			groupsChanged = true
+		}
+	}
+	for i, output := range c.Outputs {
+		if m := outputMatch[i]; m >= 0 {
+			outputs = append(outputs, a.Config.Outputs[m])
+			continue
+		}
+
+		log.Printf("I! [agent] Starting output %s", output.LogName())
+		groupsChanged = true
+		if err := output.OpenBuffer(); err != nil {
+			errs = append(errs, fmt.Errorf("could not initialize output %s: %v", output.LogName(), err))
+			continue
+		}
+		if err := a.connectOutput(ctx, output); err != nil {
+			output.Close()
+			errs = append(errs, fmt.Errorf("connecting output %s: %w", output.LogName(), err))
+			continue
+		}
+		if err := a.addOutput(ou, output); err != nil {
+			output.Close()
+			errs = append(errs, err)
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	a.Config.Outputs = outputs
+
+	if groupsChanged {
+		// The members were validated above, only outputs that failed to
+		// start can be missing.
+		groups, err := newOutputGroups(c.OutputGroups, outputs, true)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			ou.Lock()
+			ou.groups = groups
+			ou.updateFan()
+			ou.Unlock()
+			a.Config.OutputGroups = c.OutputGroups
+		}
+	}
+
+	if pipelineChanged {
+		log.Printf("I! [agent] Restarting processors and aggregators")
+		pl, err := a.startPipeline(c.Processors, c.AggProcessors, c.Aggregators)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			a.runPipeline(router, time.Now(), pl)
+			a.Config.Processors = c.Processors
+			a.Config.AggProcessors = c.AggProcessors
+			a.Config.Aggregators = c.Aggregators
+		}
+	}
+
+	var inputs []*models.RunningInput
+	for i, input := range a.Config.Inputs {
+		if !isMatched(inputMatch, i) {
+			log.Printf("I! [agent] Stopping input %s", input.LogName())
+			a.stopInput(iu, input)
+		}
+	}
+	for i, input := range c.Inputs {
+		if m := inputMatch[i]; m >= 0 {
+			inputs = append(inputs, a.Config.Inputs[m])
+			continue
+		}
+
+		log.Printf("I! [agent] Starting input %s", input.LogName())
+		if err := a.addInput(ctx, iu, input); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		inputs = append(inputs, input)
+	}
+	a.Config.Inputs = inputs
+
+	if len(errs) != 0 {
+		return fmt.Errorf("reload incomplete: %v", errs)
+	}
+	return nil
+}
+
+// initPipeline runs the Init function on the processors and aggregators.
+func initPipeline(c *config.Config) error {
+	for _, processor := range c.Processors {
+		if err := processor.Init(); err != nil {
+			return fmt.Errorf("could not initialize processor %s: %v",
+				processor.Config.Name, err)
+		}
+	}
+	for _, aggregator := range c.Aggregators {
+		if err := aggregator.Init(); err != nil {
+			return fmt.Errorf("could not initialize aggregator %s: %v",
+				aggregator.Config.Name, err)
+		}
+	}
+	for _, processor := range c.AggProcessors {
+		if err := processor.Init(); err != nil {
+			return fmt.Errorf("could not initialize processor %s: %v",
+				processor.Config.Name, err)
+		}
+	}
+	return nil
+}
+
+// addInput starts a new input of the running agent.
+func (a *Agent) addInput(ctx context.Context, unit *inputUnit, input *models.RunningInput) error {
+	unit.Lock()
+	defer unit.Unlock()
+
+	// The input channel is closed once the inputs are stopped.
+	if unit.stopped || ctx.Err() != nil {
+		return fmt.Errorf("starting input %s: agent is stopping", input.LogName())
+	}
+
+	if err := startServiceInput(input, unit.router.input(input.Config.Pipeline)); err != nil {
+		return err
+	}
+
+	unit.inputs = append(unit.inputs, input)
+	a.startGather(ctx, time.Now(), unit, input)
+	return nil
+}
+
+// stopInput stops an input of the running agent and waits for any ongoing
+// Gather to complete.
+func (a *Agent) stopInput(unit *inputUnit, input *models.RunningInput) {
+	unit.Lock()
+	if unit.stopped {
+		// The input is stopped along with all other inputs.
+		unit.Unlock()
+		return
+	}
+	g := unit.gatherers[input]
+	delete(unit.gatherers, input)
+	unit.inputs = removeInput(unit.inputs, input)
+	unit.Unlock()
+
+	if g != nil {
+		g.cancel()
+		<-g.done
+	}
+
+	if si, ok := input.Input.(telegraf.ServiceInput); ok {
+		si.Stop()
+	}
+	input.Tap().Close()
+}
+
+// addOutput starts the flush loop of a connected output and begins sending
+// metrics to it.
+func (a *Agent) addOutput(unit *outputUnit, output *models.RunningOutput) error {
+	unit.Lock()
+	defer unit.Unlock()
+
+	if unit.stopped {
+		return fmt.Errorf("starting output %s: agent is stopping", output.LogName())
+	}
+
+	a.setBufferMemory(output)
+	unit.outputs = append(unit.outputs, output)
+	unit.updateFan()
+	a.startFlush(unit, output)
+	return nil
+}
+
+// stopOutput stops sending metrics to an output, flushes its buffer one last
+// time and closes it.
+func (a *Agent) stopOutput(unit *outputUnit, output *models.RunningOutput) {
+	unit.Lock()
+	if unit.stopped {
+		// The output is closed along with all other outputs.
+		unit.Unlock()
+		return
+	}
+	f := unit.flushers[output]
+	delete(unit.flushers, output)
+	unit.outputs = removeOutput(unit.outputs, output)
+	unit.groups = removeGroupMember(unit.groups, output)
+	unit.updateFan()
+	unit.Unlock()
+
+	if f != nil {
+		f.cancel()
+		<-f.done
+	}
+	output.Close()
+	output.Tap().Close()
+}
+
+func removeInput(inputs []*models.RunningInput, input *models.RunningInput) []*models.RunningInput {
+	result := make([]*models.RunningInput, 0, len(inputs))
+	for _, i := range inputs {
+		if i != input {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// removeGroupMember removes the output from its group, groups without members
+// are removed.
+func removeGroupMember(groups []*outputGroup, output *models.RunningOutput) []*outputGroup {
+	result := make([]*outputGroup, 0, len(groups))
+	for _, g := range groups {
+		if g.contains(output) {
+			members := removeOutput(g.members, output)
+			if len(members) == 0 {
+				continue
+			}
+			g = newOutputGroup(g.config, members)
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
+func removeOutput(outputs []*models.RunningOutput, output *models.RunningOutput) []*models.RunningOutput {
+	result := make([]*models.RunningOutput, 0, len(outputs))
+	for _, o := range outputs {
+		if o != output {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// matchPlugins pairs the plugins of the new configuration with identical
+// running plugins.  For each new plugin the index of the matching running
+// plugin is returned, or -1 if the plugin is new or changed.  Plugins with an
+// empty key never match.
+func matchPlugins(running, next []string) []int {
+	used := make([]bool, len(running))
+	match := make([]int, len(next))
+	for i, key := range next {
+		match[i] = -1
+		if key == "" {
+			continue
+		}
+		for j, runningKey := range running {
+			if !used[j] && runningKey == key {
+				used[j] = true
+				match[i] = j
+				break
+			}
+		}
+	}
+	return match
+}
+
+// isMatched returns true if the running plugin at index is kept.
+func isMatched(match []int, index int) bool {
+	for _, m := range match {
+		if m == index {
+			return true
+		}
+	}
+	return false
+}
+
+// sameKeys returns true if the plugins are identical and in the same order.
+func sameKeys(running, next []string) bool {
+	if len(running) != len(next) {
+		return false
+	}
+	for i, key := range next {
+		if key == "" || key != running[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pluginKey(name, fingerprint string) string {
+	if fingerprint == "" {
+		return ""
+	}
+	return name + "/" + fingerprint
+}
+
+func inputKeys(inputs []*models.RunningInput) []string {
+	keys := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		keys = append(keys, pluginKey(input.Config.Name, input.Config.Fingerprint))
+	}
+	return keys
+}
+
+func outputKeys(outputs []*models.RunningOutput) []string {
+	keys := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		keys = append(keys, pluginKey(output.Config.Name, output.Config.Fingerprint))
+	}
+	return keys
+}
+
+// processorKeys returns the keys of the processors in the order they run.
+// The configuration does not define the order of processors of different
+// plugins with the same order setting, these are sorted by name.
+func processorKeys(processors models.RunningProcessors) []string {
+	sorted := make(models.RunningProcessors, len(processors))
+	copy(sorted, processors)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Config.Order != sorted[j].Config.Order {
+			return sorted[i].Config.Order < sorted[j].Config.Order
+		}
+		return sorted[i].Config.Name < sorted[j].Config.Name
+	})
+
+	keys := make([]string, 0, len(sorted))
+	for _, processor := range sorted {
+		keys = append(keys, pluginKey(processor.Config.Name, processor.Config.Fingerprint))
+	}
+	return keys
+}
+
+// aggregatorKeys returns the sorted keys of the aggregators, the aggregators
+// run side by side so their order does not matter.
+func aggregatorKeys(aggregators []*models.RunningAggregator) []string {
+	keys := make([]string, 0, len(aggregators))
+	for _, aggregator := range aggregators {
+		keys = append(keys, pluginKey(aggregator.Config.Name, aggregator.Config.Fingerprint))
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPlugins(t *testing.T) {
+	tests := []struct {
+		name     string
+		running  []string
+		next     []string
+		expected []int
+	}{
+		{
+			name:     "unchanged",
+			running:  []string{"cpu/a", "mem/b"},
+			next:     []string{"cpu/a", "mem/b"},
+			expected: []int{0, 1},
+		},
+		{
+			name:     "reordered",
+			running:  []string{"cpu/a", "mem/b"},
+			next:     []string{"mem/b", "cpu/a"},
+			expected: []int{1, 0},
+		},
+		{
+			name:     "changed",
+			running:  []string{"cpu/a", "mem/b"},
+			next:     []string{"cpu/a", "mem/c"},
+			expected: []int{0, -1},
+		},
+		{
+			name:     "duplicates",
+			running:  []string{"cpu/a", "cpu/a"},
+			next:     []string{"cpu/a", "cpu/a", "cpu/a"},
+			expected: []int{0, 1, -1},
+		},
+		{
+			name:     "no fingerprint",
+			running:  []string{""},
+			next:     []string{""},
+			expected: []int{-1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, matchPlugins(tt.running, tt.next))
+		})
+	}
+}
+
+func TestProcessorKeys(t *testing.T) {
+	processor := func(name string, order int64) *models.RunningProcessor {
+		return &models.RunningProcessor{Config: &models.ProcessorConfig{
+			Name:        name,
+			Order:       order,
+			Fingerprint: name + "-fingerprint",
+		}}
+	}
+
+	running := processorKeys(models.RunningProcessors{
+		processor("a", 1), processor("b", 2), processor("c", 2),
+	})
+	// Plugins are loaded in an undefined order.
+	require.True(t, sameKeys(running, processorKeys(models.RunningProcessors{
+		processor("c", 2), processor("a", 1), processor("b", 2),
+	})))
+	require.False(t, sameKeys(running, processorKeys(models.RunningProcessors{
+		processor("a", 3), processor("b", 2), processor("c", 2),
+	})))
+	require.False(t, sameKeys(running, processorKeys(models.RunningProcessors{
+		processor("a", 1), processor("b", 2),
+	})))
+}
+
+type reloadInput struct {
+	name string
+}
+
+func (i *reloadInput) SampleConfig() string {
+	return ""
+}
+
+func (i *reloadInput) Description() string {
+	return ""
+}
+
+func (i *reloadInput) Gather(acc telegraf.Accumulator) error {
+	acc.AddFields(i.name, map[string]interface{}{"value": 42}, nil)
+	return nil
+}
+
+type reloadOutput struct {
+	sync.Mutex
+	names  map[string]bool
+	closed bool
+}
+
+func (o *reloadOutput) SampleConfig() string {
+	return ""
+}
+
+func (o *reloadOutput) Description() string {
+	return ""
+}
+
+func (o *reloadOutput) Connect() error {
+	return nil
+}
+
+func (o *reloadOutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+	o.closed = true
+	return nil
+}
+
+func (o *reloadOutput) Write(metrics []telegraf.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+	for _, m := range metrics {
+		o.names[m.Name()] = true
+	}
+	return nil
+}
+
+func (o *reloadOutput) received(name string) bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.names[name]
+}
+
+func newReloadConfig(inputs ...string) (*config.Config, *reloadOutput) {
+	c := config.NewConfig()
+	c.Agent.Interval = internal.Duration{Duration: 10 * time.Millisecond}
+	c.Agent.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+
+	for _, name := range inputs {
+		c.Inputs = append(c.Inputs, models.NewRunningInput(
+			&reloadInput{name: name},
+			&models.InputConfig{Name: "reload", Fingerprint: name}))
+	}
+
+	output := &reloadOutput{names: make(map[string]bool)}
+	c.Outputs = append(c.Outputs, models.NewRunningOutput("reload", output,
+		&models.OutputConfig{Name: "reload", Fingerprint: "output"}, 0, 0))
+	return c, output
+}
+
+func TestAgent_Reload(t *testing.T) {
+	c, output := newReloadConfig("a")
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return output.received("a") },
+		5*time.Second, 10*time.Millisecond)
+
+	inputA := a.Config.Inputs[0]
+	outputA := a.Config.Outputs[0]
+
+	next, nextOutput := newReloadConfig("a", "b")
+	require.NoError(t, a.Reload(ctx, next))
+
+	// Unchanged plugins keep running, only the new input is started.
+	require.Len(t, a.Config.Inputs, 2)
+	require.Same(t, inputA, a.Config.Inputs[0])
+	require.Same(t, outputA, a.Config.Outputs[0])
+	require.Eventually(t, func() bool { return output.received("b") },
+		5*time.Second, 10*time.Millisecond)
+	require.False(t, nextOutput.received("b"))
+
+	// An invalid new plugin leaves the running agent untouched.
+	next, _ = newReloadConfig("a")
+	next.Outputs = append(next.Outputs, models.NewRunningOutput("reload", &reloadOutput{},
+		&models.OutputConfig{Name: "reload", Fingerprint: "invalid", BufferStrategy: "invalid"}, 0, 0))
+	require.Error(t, a.Reload(ctx, next))
+	require.Len(t, a.Config.Inputs, 2)
+	require.Len(t, a.Config.Outputs, 1)
+	require.Same(t, outputA, a.Config.Outputs[0])
+
+	next, _ = newReloadConfig("a")
+	next.Agent.Interval = internal.Duration{Duration: time.Second}
+	require.Equal(t, ErrRestartRequired, a.Reload(ctx, next))
+	require.Len(t, a.Config.Inputs, 2)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	output.Lock()
+	require.True(t, output.closed)
+	output.Unlock()
+}
@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/parsers/influx"
+)
+
+// replayer writes the metrics read from files to the pipeline and keeps track
+// of their delivery.
+type replayer struct {
+	dst  chan<- telegraf.Metric
+	rate float64
+
+	// undelivered limits the metrics in flight to the size of the output
+	// buffers, so that replayed metrics are not dropped by a full buffer.
+	undelivered chan struct{}
+	wg          sync.WaitGroup
+	rejected    int64
+	next        time.Time
+}
+
+// Replay reads the metrics from the files and writes them through the
+// processors to the outputs, at most rate metrics per second if rate is set.
+// The timestamps of the metrics are preserved, aggregators are not run.  It
+// returns once every metric has been acknowledged by the outputs.
+func (a *Agent) Replay(ctx context.Context, files []string, parser parsers.Parser, rate float64) error {
+	log.Printf("D! [agent] Initializing plugins")
+	err := a.initPlugins(true)
+	if err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+
+	log.Printf("D! [agent] Connecting outputs")
+	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
+	if err != nil {
+		return err
+	}
+
+	pl, err := a.startPipeline(a.Config.Processors, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	router := newPipelineRouter(next)
+	a.runPipeline(router, startTime, pl)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := a.runOutputs(ou)
+		if err != nil {
+			log.Printf("E! [agent] Error running outputs: %v", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.runRouter(router)
+	}()
+
+	limit := models.DEFAULT_METRIC_BUFFER_LIMIT
+	for i, output := range a.Config.Outputs {
+		if i == 0 || output.MetricBufferLimit < limit {
+			limit = output.MetricBufferLimit
+		}
+	}
+
+	r := &replayer{
+		dst:         router.input(""),
+		rate:        rate,
+		undelivered: make(chan struct{}, limit),
+		next:        time.Now(),
+	}
+
+	for _, file := range files {
+		log.Printf("I! [agent] Replaying %s", file)
+		err = r.replayFile(ctx, file, parser)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = r.wait(ctx)
+	}
+
+	router.closeInputs()
+	wg.Wait()
+
+	log.Printf("D! [agent] Stopped Successfully")
+
+	if err != nil {
+		return err
+	}
+	if rejected := atomic.LoadInt64(&r.rejected); rejected != 0 {
+		return fmt.Errorf("output plugins rejected %d metrics", rejected)
+	}
+	return nil
+}
+
+// replayFile writes the metrics of the file to the pipeline.  Line protocol is
+// parsed as a stream, other data formats are parsed as a whole.
+func (r *replayer) replayFile(ctx context.Context, file string, parser parsers.Parser) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, ok := parser.(*influx.Parser); ok {
+		sp := influx.NewStreamParser(f)
+		for {
+			m, err := sp.Next()
+			if err == influx.EOF {
+				return nil
+			}
+			if err != nil {
+				if _, ok := err.(*influx.ParseError); ok {
+					log.Printf("E! [agent] Error parsing %s: %v", file, err)
+					continue
+				}
+				return fmt.Errorf("reading %s: %w", file, err)
+			}
+			if err := r.add(ctx, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	octets, err := ioutil.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", file, err)
+	}
+	metrics, err := parser.Parse(octets)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", file, err)
+	}
+	for _, m := range metrics {
+		if err := r.add(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add writes a tracked metric to the pipeline once the rate and the
+// undelivered metrics allow.
+func (r *replayer) add(ctx context.Context, m telegraf.Metric) error {
+	if r.rate > 0 {
+		if d := time.Until(r.next); d > 0 {
+			if err := internal.SleepContext(ctx, d); err != nil {
+				return err
+			}
+		} else {
+			r.next = time.Now()
+		}
+		r.next = r.next.Add(time.Duration(float64(time.Second) / r.rate))
+	}
+
+	select {
+	case r.undelivered <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	r.wg.Add(1)
+	m, _ = metric.WithTracking(m, func(info telegraf.DeliveryInfo) {
+		if !info.Delivered() {
+			atomic.AddInt64(&r.rejected, 1)
+		}
+		<-r.undelivered
+		r.wg.Done()
+	})
+	r.dst <- m
+	return nil
+}
+
+// wait waits until all metrics are acknowledged by the outputs.
+func (r *replayer) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d replayed metrics not acknowledged: %w", len(r.undelivered), ctx.Err())
+	}
+}
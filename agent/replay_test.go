@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/processors"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type replayOutput struct {
+	sync.Mutex
+	metrics []telegraf.Metric
+}
+
+func (o *replayOutput) SampleConfig() string {
+	return ""
+}
+
+func (o *replayOutput) Description() string {
+	return ""
+}
+
+func (o *replayOutput) Connect() error {
+	return nil
+}
+
+func (o *replayOutput) Close() error {
+	return nil
+}
+
+func (o *replayOutput) Write(metrics []telegraf.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+	o.metrics = append(o.metrics, metrics...)
+	return nil
+}
+
+func TestAgent_Replay(t *testing.T) {
+	f, err := ioutil.TempFile("", "replay")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("cpu,host=a value=1 1600000000000000000\n" +
+		"cpu,host=a value=2 1600000010000000000\n" +
+		"invalid line\n" +
+		"mem,host=a used=3i 1600000020000000000\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := config.NewConfig()
+	c.Agent.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+	c.Processors = append(c.Processors, models.NewRunningProcessor(
+		processors.NewStreamingProcessorFromProcessor(&suffixProcessor{suffix: "_p"}),
+		&models.ProcessorConfig{Name: "suffix"}))
+
+	output := &replayOutput{}
+	c.Outputs = append(c.Outputs, models.NewRunningOutput("replay", output,
+		&models.OutputConfig{Name: "replay"}, 0, 0))
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	parser, err := parsers.NewParser(&parsers.Config{DataFormat: "influx"})
+	require.NoError(t, err)
+
+	// The metrics are written at the given rate through the processors and
+	// keep their timestamps.
+	start := time.Now()
+	err = a.Replay(context.Background(), []string{f.Name()}, parser, 100)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("cpu_p", map[string]string{"host": "a"},
+			map[string]interface{}{"value": 1.0}, time.Unix(1600000000, 0)),
+		testutil.MustMetric("cpu_p", map[string]string{"host": "a"},
+			map[string]interface{}{"value": 2.0}, time.Unix(1600000010, 0)),
+		testutil.MustMetric("mem_p", map[string]string{"host": "a"},
+			map[string]interface{}{"used": int64(3)}, time.Unix(1600000020, 0)),
+	}
+	output.Lock()
+	defer output.Unlock()
+	testutil.RequireMetricsEqual(t, expected, output.metrics)
+}
+
+func TestAgent_ReplayCanceled(t *testing.T) {
+	f, err := ioutil.TempFile("", "replay")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("cpu value=1 1600000000000000000\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := config.NewConfig()
+	c.Agent.FlushInterval = internal.Duration{Duration: time.Hour}
+	c.Outputs = append(c.Outputs, models.NewRunningOutput("replay", &replayOutput{},
+		&models.OutputConfig{Name: "replay"}, 0, 0))
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	parser, err := parsers.NewParser(&parsers.Config{DataFormat: "influx"})
+	require.NoError(t, err)
+
+	// The replay does not return before the metric is acknowledged.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = a.Replay(ctx, []string{f.Name()}, parser, 0)
+	require.EqualError(t, err, "1 replayed metrics not acknowledged: context deadline exceeded")
+}
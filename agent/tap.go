@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/expr"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/serializers/influx"
+)
+
+// tapBufferSize is the number of metrics buffered for a tap client, metrics
+// are dropped when the client does not keep up.
+const tapBufferSize = 1000
+
+// tap streams the metrics passing a stage of the pipeline in line protocol
+// until the client disconnects.  The stage is a plugin, "inputs.<name>",
+// "processors.<name>", "aggregators.<name>" or "outputs.<name>", optionally
+// selected by alias, the metrics of all matching plugins are streamed.  The
+// filter parameter is an expression the metrics must match.  Dropped metrics
+// are reported in comments, the stream ends when the plugins are stopped by a
+// reload.  The metrics may hold sensitive data, the tap is only served to local
+// clients as listenAPI only listens on unix sockets and loopback addresses.
+func (api *apiServer) tap(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed,
+			apiResult{Error: fmt.Sprintf("method %s not allowed", req.Method)})
+		return
+	}
+
+	query := req.URL.Query()
+	stage := query.Get("stage")
+	if stage == "" {
+		writeJSON(w, http.StatusBadRequest, apiResult{Error: "stage parameter is required"})
+		return
+	}
+
+	var filter *expr.Expression
+	if source := query.Get("filter"); source != "" {
+		var err error
+		filter, err = expr.Compile(source)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiResult{Error: fmt.Sprintf("invalid filter: %v", err)})
+			return
+		}
+	}
+
+	taps, err := api.stageTaps(stage, query.Get("alias"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiResult{Error: err.Error()})
+		return
+	}
+
+	subscriber := models.NewTapSubscriber(filter, tapBufferSize)
+	var attached []*models.Tap
+	for _, t := range taps {
+		if t.Attach(subscriber) {
+			attached = append(attached, t)
+		}
+	}
+	if len(attached) == 0 {
+		writeJSON(w, http.StatusNotFound, apiResult{Error: "no matching plugins"})
+		return
+	}
+	defer func() {
+		for _, t := range attached {
+			t.Detach(subscriber)
+		}
+		log.Printf("D! [agent] Detached tap of %s", stage)
+	}()
+	log.Printf("D! [agent] Attached tap of %s", stage)
+
+	// stopped is closed once all plugins of the stage are stopped.
+	ctx := req.Context()
+	stopped := make(chan struct{})
+	go func() {
+		for _, t := range attached {
+			select {
+			case <-t.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		close(stopped)
+	}()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	flush()
+
+	serializer := influx.NewSerializer()
+	serializer.SetFieldSortOrder(influx.SortFields)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopped:
+			for len(subscriber.C) != 0 {
+				writeTapMetric(w, serializer, <-subscriber.C)
+			}
+			fmt.Fprintf(w, "# %s stopped\n", stage)
+			flush()
+			return
+		case <-ticker.C:
+			if dropped := subscriber.Dropped(); dropped != 0 {
+				_, err = fmt.Fprintf(w, "# dropped %d metrics\n", dropped)
+				flush()
+			}
+		case m := <-subscriber.C:
+			err = writeTapMetric(w, serializer, m)
+			// Flush once the queued metrics are written.
+			if len(subscriber.C) == 0 {
+				flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeTapMetric(w http.ResponseWriter, serializer *influx.Serializer, m telegraf.Metric) error {
+	octets, err := serializer.Serialize(m)
+	if err != nil {
+		_, err = fmt.Fprintf(w, "# error serializing metric %s: %v\n", m.Name(), err)
+		return err
+	}
+	_, err = w.Write(octets)
+	return err
+}
+
+// stageTaps returns the taps of the running plugins of the stage.
+func (api *apiServer) stageTaps(stage, alias string) ([]*models.Tap, error) {
+	parts := strings.SplitN(stage, ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid stage %q, expected <plugin type>.<name>", stage)
+	}
+	kind, name := parts[0], parts[1]
+
+	var taps []*models.Tap
+	switch kind {
+	case "inputs":
+		for _, input := range api.runningInputs() {
+			if pluginMatches(input.Config.Name, input.Config.Alias, name, alias) {
+				taps = append(taps, input.Tap())
+			}
+		}
+	case "processors":
+		// The processors after the aggregators only run in pipelines with
+		// aggregators, the running processors are found in the chains.
+		api.router.RLock()
+		if unit := api.router.unit; unit != nil {
+			for _, chain := range unit.chains {
+				for _, units := range [][]*processorUnit{chain.pu, chain.apu} {
+					for _, pu := range units {
+						if pluginMatches(pu.processor.Config.Name, pu.processor.Config.Alias, name, alias) {
+							taps = append(taps, pu.processor.Tap())
+						}
+					}
+				}
+			}
+		}
+		api.router.RUnlock()
+	case "aggregators":
+		api.router.RLock()
+		if unit := api.router.unit; unit != nil {
+			for _, chain := range unit.chains {
+				if chain.au == nil {
+					continue
+				}
+				for _, aggregator := range chain.au.aggregators {
+					if pluginMatches(aggregator.Config.Name, aggregator.Config.Alias, name, alias) {
+						taps = append(taps, aggregator.Tap())
+					}
+				}
+			}
+		}
+		api.router.RUnlock()
+	case "outputs":
+		for _, output := range api.runningOutputs() {
+			if pluginMatches(output.Config.Name, output.Config.Alias, name, alias) {
+				taps = append(taps, output.Tap())
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid stage %q, the plugin type must be inputs, processors, aggregators or outputs", stage)
+	}
+	return taps, nil
+}
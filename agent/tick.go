@@ -7,6 +7,7 @@ import (
 
 	"github.com/benbjohnson/clock"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/cron"
 )
 
 type empty struct{}
@@ -273,3 +274,84 @@ func (t *RollingTicker) Stop() {
 	t.cancel()
 	t.wg.Wait()
 }
+
+// CronTicker delivers ticks at the times of a cron schedule plus an optional
+// jitter.  Each tick is rescheduled from the current time to avoid drift.
+//
+// The first tick is emitted at the next scheduled time.
+//
+// Ticks are dropped for slow consumers.
+type CronTicker struct {
+	schedule *cron.Schedule
+	jitter   time.Duration
+	ch       chan time.Time
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewCronTicker(now time.Time, schedule *cron.Schedule, jitter time.Duration) *CronTicker {
+	return newCronTicker(now, schedule, jitter, clock.New())
+}
+
+func newCronTicker(now time.Time, schedule *cron.Schedule, jitter time.Duration, clock clock.Clock) *CronTicker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &CronTicker{
+		schedule: schedule,
+		jitter:   jitter,
+		ch:       make(chan time.Time, 1),
+		cancel:   cancel,
+	}
+
+	scheduled := schedule.Next(now)
+	timer := clock.Timer(t.next(now, scheduled))
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.run(ctx, timer, scheduled)
+	}()
+
+	return t
+}
+
+// next returns the delay until the scheduled time plus the jitter.
+func (t *CronTicker) next(now, scheduled time.Time) time.Duration {
+	d := scheduled.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d + internal.RandomDuration(t.jitter)
+}
+
+func (t *CronTicker) run(ctx context.Context, timer *clock.Timer, scheduled time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			select {
+			case t.ch <- now:
+			default:
+			}
+
+			// Schedule from the later of the two times, a timer firing
+			// slightly early must not run the same scheduled time twice.
+			from := now
+			if scheduled.After(from) {
+				from = scheduled
+			}
+			scheduled = t.schedule.Next(from)
+			timer.Reset(t.next(now, scheduled))
+		}
+	}
+}
+
+func (t *CronTicker) Elapsed() <-chan time.Time {
+	return t.ch
+}
+
+func (t *CronTicker) Stop() {
+	t.cancel()
+	t.wg.Wait()
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/influxdata/telegraf/internal/cron"
 	"github.com/stretchr/testify/require"
 )
 
@@ -260,3 +261,34 @@ func simulatedDist(ticker Ticker, clock *clock.Mock) Distribution {
 
 	return dist
 }
+
+func TestCronTicker(t *testing.T) {
+	schedule, err := cron.Parse("CRON_TZ=UTC */15 * * * *")
+	require.NoError(t, err)
+
+	clock := clock.NewMock()
+	since := clock.Now()
+	until := since.Add(time.Hour)
+
+	ticker := newCronTicker(since, schedule, 0, clock)
+	defer ticker.Stop()
+
+	expected := []time.Time{
+		time.Unix(15*60, 0).UTC(),
+		time.Unix(30*60, 0).UTC(),
+		time.Unix(45*60, 0).UTC(),
+		time.Unix(60*60, 0).UTC(),
+	}
+
+	actual := []time.Time{}
+	for !clock.Now().After(until) {
+		select {
+		case tm := <-ticker.Elapsed():
+			actual = append(actual, tm.UTC())
+		default:
+		}
+		clock.Add(time.Minute)
+	}
+
+	require.Equal(t, expected, actual)
+}
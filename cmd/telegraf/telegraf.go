@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof" // Comment this line to disable pprof endpoint.
+	"net/url"
 	"os"
 	"os/signal"
 	"sort"
@@ -25,7 +30,9 @@ import (
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	_ "github.com/influxdata/telegraf/plugins/outputs/all"
+	"github.com/influxdata/telegraf/plugins/parsers"
 	_ "github.com/influxdata/telegraf/plugins/processors/all"
+	_ "github.com/influxdata/telegraf/plugins/secretstores/all"
 )
 
 // If you update these, update usage.go and usage_windows.go
@@ -37,9 +44,15 @@ var fQuiet = flag.Bool("quiet", false,
 	"run in quiet mode")
 var fTest = flag.Bool("test", false, "enable test mode: gather metrics, print them out, and exit. Note: Test mode only runs inputs, not processors, aggregators, or outputs")
 var fTestWait = flag.Int("test-wait", 0, "wait up to this many seconds for service inputs to complete in test mode")
+var fTestPipeline = flag.Bool("test-pipeline", false,
+	"gather metrics once, run them through the processors and aggregators, print the metrics each output would receive, and exit")
+var fTestPipelineWindow = flag.Duration("test-pipeline-window", 0,
+	"in test pipeline mode, gather the inputs once per interval of this aggregation window without waiting")
 var fConfig = flag.String("config", "", "configuration file to load")
 var fConfigDirectory = flag.String("config-directory", "",
 	"directory containing additional *.conf files")
+var fCheckConfig = flag.Bool("check-config", false,
+	"load the configuration and initialize the plugins, report all errors and exit")
 var fVersion = flag.Bool("version", false, "display the version and exit")
 var fSampleConfig = flag.Bool("sample-config", false,
 	"print out full sample configuration")
@@ -68,6 +81,11 @@ var fRunAsConsole = flag.Bool("console", false, "run as console application (win
 var fPlugins = flag.String("plugin-directory", "",
 	"path to directory containing external plugins")
 var fRunOnce = flag.Bool("once", false, "run one gather and exit")
+var fReplay = flag.Bool("replay", false,
+	"replay the metrics of the files given as arguments through the processors to the outputs and exit")
+var fReplayFormat = flag.String("replay-format", "",
+	"data format of the replayed files, overrides the data_format of the [replay] table")
+var fReplayRate = flag.Float64("replay-rate", 0, "maximum number of metrics replayed per second, unlimited if 0")
 
 var (
 	version string
@@ -90,68 +108,375 @@ func reloadLoop(
 
 		ctx, cancel := context.WithCancel(context.Background())
 
+		// restart stops the running agent and starts a new one.
+		restart := func() {
+			<-reload
+			reload <- true
+			cancel()
+		}
+
+		hup := make(chan struct{}, 1)
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt, syscall.SIGHUP,
 			syscall.SIGTERM, syscall.SIGINT)
 		go func() {
-			select {
-			case sig := <-signals:
-				if sig == syscall.SIGHUP {
-					log.Printf("I! Reloading Telegraf config")
-					<-reload
-					reload <- true
+			for {
+				select {
+				case sig := <-signals:
+					if sig == syscall.SIGHUP {
+						log.Printf("I! Reloading Telegraf config")
+						select {
+						case hup <- struct{}{}:
+						default:
+						}
+						continue
+					}
+					cancel()
+				case <-stop:
+					cancel()
+				case <-ctx.Done():
 				}
-				cancel()
-			case <-stop:
-				cancel()
+				signal.Stop(signals)
+				return
 			}
 		}()
 
-		err := runAgent(ctx, inputFilters, outputFilters)
+		err := runAgent(ctx, inputFilters, outputFilters, hup, restart)
 		if err != nil && err != context.Canceled {
 			log.Fatalf("E! [telegraf] Error running agent: %v", err)
 		}
 	}
 }
 
-func runAgent(ctx context.Context,
-	inputFilters []string,
-	outputFilters []string,
-) error {
-	log.Printf("I! Starting Telegraf %s", version)
-
-	// If no other options are specified, load the config file and run.
+// loadConfig loads the configuration files and checks that the agent can be
+// run with them.
+func loadConfig(inputFilters []string, outputFilters []string) (*config.Config, error) {
 	c := config.NewConfig()
 	c.OutputFilters = outputFilters
 	c.InputFilters = inputFilters
 	err := c.LoadConfig(*fConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if *fConfigDirectory != "" {
 		err = c.LoadDirectory(*fConfigDirectory)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	if !*fTest && len(c.Outputs) == 0 {
-		return errors.New("Error: no outputs found, did you provide a valid config file?")
+		return nil, errors.New("Error: no outputs found, did you provide a valid config file?")
 	}
-	if *fPlugins == "" && len(c.Inputs) == 0 {
-		return errors.New("Error: no inputs found, did you provide a valid config file?")
+	if *fPlugins == "" && !*fReplay && len(c.Inputs) == 0 {
+		return nil, errors.New("Error: no inputs found, did you provide a valid config file?")
 	}
 
 	if int64(c.Agent.Interval.Duration) <= 0 {
-		return fmt.Errorf("Agent interval must be positive, found %s",
+		return nil, fmt.Errorf("Agent interval must be positive, found %s",
 			c.Agent.Interval.Duration)
 	}
 
 	if int64(c.Agent.FlushInterval.Duration) <= 0 {
-		return fmt.Errorf("Agent flush_interval must be positive; found %s",
+		return nil, fmt.Errorf("Agent flush_interval must be positive; found %s",
 			c.Agent.Interval.Duration)
 	}
 
+	// The inputs are replaced when testing or replaying.
+	if !*fTest && !*fReplay {
+		if errs := c.CheckPipelines(); len(errs) != 0 {
+			return nil, fmt.Errorf("Error: misspelled pipelines: %v", errs)
+		}
+	}
+	return c, nil
+}
+
+// printPlugins prints the registered plugins, or with --json the schema of
+// their options.  It returns the exit code.
+func printPlugins(args []string) int {
+	flags := flag.NewFlagSet("plugins", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the schema of the plugin options as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	schema := config.PluginSchemas()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(schema); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, section := range []struct {
+		title   string
+		plugins []config.PluginSchema
+	}{
+		{"Inputs", schema.Inputs},
+		{"Outputs", schema.Outputs},
+		{"Processors", schema.Processors},
+		{"Aggregators", schema.Aggregators},
+	} {
+		fmt.Printf("%s:\n", section.title)
+		for _, plugin := range section.plugins {
+			fmt.Printf("  %-30s %s\n", plugin.Name, plugin.Description)
+		}
+	}
+	fmt.Printf("Parsers:\n  %s\n", strings.Join(schema.Parsers.DataFormats, " "))
+	fmt.Printf("Serializers:\n  %s\n", strings.Join(schema.Serializers.DataFormats, " "))
+	return 0
+}
+
+// tapStage streams the metrics of a stage of the running agent through its
+// API until interrupted.  The API address is read from the configuration when
+// not given.  It returns the exit code.
+func tapStage(args []string) int {
+	flags := flag.NewFlagSet("tap", flag.ContinueOnError)
+	address := flags.String("api-address", "", "address of the API of the running agent")
+	alias := flags.String("alias", "", "alias of the plugin")
+	filter := flags.String("filter", "", "expression the metrics must match")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: telegraf tap [--api-address address] [--alias alias] [--filter expression] <plugin type>.<name>")
+		return 1
+	}
+
+	if *address == "" {
+		c := config.NewConfig()
+		if err := c.LoadConfig(*fConfig); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if c.Agent.APIAddress == "" {
+			fmt.Fprintln(os.Stderr, "the API is not enabled, set api_address in the agent configuration or use --api-address")
+			return 1
+		}
+		*address = c.Agent.APIAddress
+	}
+
+	client := http.DefaultClient
+	host := strings.TrimPrefix(*address, "tcp://")
+	if strings.HasPrefix(*address, "unix://") {
+		path := strings.TrimPrefix(*address, "unix://")
+		client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}}
+		host = "unix"
+	}
+
+	query := url.Values{"stage": {flags.Arg(0)}}
+	if *alias != "" {
+		query.Set("alias", *alias)
+	}
+	if *filter != "" {
+		query.Set("filter", *filter)
+	}
+	resp, err := client.Get("http://" + host + "/tap?" + query.Encode())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Error == "" {
+			result.Error = resp.Status
+		}
+		fmt.Fprintln(os.Stderr, result.Error)
+		return 1
+	}
+
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// migrateConfig prints the configuration file with the deprecated plugins and
+// options replaced, the changes are reported on stderr.  It returns the exit
+// code.
+func migrateConfig(files []string) int {
+	path := *fConfig
+	switch {
+	case len(files) == 1:
+		path = files[0]
+	case len(files) > 1:
+		fmt.Fprintln(os.Stderr, "only one configuration file can be migrated at a time")
+		return 1
+	case path == "":
+		fmt.Fprintln(os.Stderr, "no configuration file to migrate, use --config or give the file as argument")
+		return 1
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	migrated, notes, err := config.Migrate(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating config file %s: %v\n", path, err)
+		return 1
+	}
+	os.Stdout.Write(migrated)
+
+	var converted, manual []config.MigrationNote
+	for _, note := range notes {
+		if note.Manual {
+			manual = append(manual, note)
+		} else {
+			converted = append(converted, note)
+		}
+	}
+	for _, section := range []struct {
+		title string
+		notes []config.MigrationNote
+	}{
+		{"Converted:", converted},
+		{"Not converted, review manually:", manual},
+	} {
+		if len(section.notes) == 0 {
+			continue
+		}
+		fmt.Fprintln(os.Stderr, section.title)
+		for _, note := range section.notes {
+			fmt.Fprintf(os.Stderr, "  %s:%d: %s: %s\n", path, note.Line, note.Plugin, note.Message)
+		}
+	}
+	if len(notes) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to migrate")
+	}
+	return 0
+}
+
+// checkConfig loads the configuration and initializes the plugins without
+// running them, every error found is printed.  It returns the exit code.
+func checkConfig(inputFilters []string, outputFilters []string) int {
+	c := config.NewConfig()
+	c.CollectErrors = true
+	c.OutputFilters = outputFilters
+	c.InputFilters = inputFilters
+	if err := c.LoadConfig(*fConfig); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *fConfigDirectory != "" {
+		if err := c.LoadDirectory(*fConfigDirectory); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	errs := c.Check()
+	if len(c.Outputs) == 0 {
+		errs = append(errs, errors.New("no outputs found"))
+	}
+	if *fPlugins == "" && len(c.Inputs) == 0 {
+		errs = append(errs, errors.New("no inputs found"))
+	}
+
+	if len(errs) == 0 {
+		fmt.Println("Configuration is valid")
+		return 0
+	}
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	fmt.Fprintf(os.Stderr, "Found %d error(s) in the configuration\n", len(errs))
+	return 1
+}
+
+// reloadAgent applies the configuration files to the running agent each time
+// a reload is requested.  Only the changed plugins are restarted, if this is
+// not possible the agent is restarted.  The remote configuration files of the
+// running configuration c are watched for changes.
+func reloadAgent(ctx context.Context,
+	ag *agent.Agent,
+	c *config.Config,
+	inputFilters []string,
+	outputFilters []string,
+	hup <-chan struct{},
+	restart func(),
+) {
+	stopWatch := watchRemote(ctx, c, ag.RequestReload)
+	defer func() { stopWatch() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		// The watch is started again after each reload, with the versions
+		// of the reloaded files if it succeeded, so that a failed reload is
+		// retried while the files differ from the running configuration.
+		stopWatch()
+
+		loaded, err := loadConfig(inputFilters, outputFilters)
+		if err != nil {
+			log.Printf("E! [telegraf] Error loading config, keeping current config: %v", err)
+			stopWatch = watchRemote(ctx, c, ag.RequestReload)
+			continue
+		}
+
+		err = ag.Reload(ctx, loaded)
+		switch {
+		case err == nil:
+			c = loaded
+			log.Printf("I! Loaded inputs: %s", strings.Join(c.InputNames(), " "))
+			log.Printf("I! Loaded aggregators: %s", strings.Join(c.AggregatorNames(), " "))
+			log.Printf("I! Loaded processors: %s", strings.Join(c.ProcessorNames(), " "))
+			log.Printf("I! Loaded outputs: %s", strings.Join(c.OutputNames(), " "))
+		case errors.Is(err, agent.ErrRestartRequired):
+			log.Printf("I! [telegraf] Restarting agent: %v", err)
+			restart()
+			return
+		case errors.Is(err, context.Canceled):
+			return
+		default:
+			log.Printf("E! [telegraf] Error reloading config: %v", err)
+		}
+		stopWatch = watchRemote(ctx, c, ag.RequestReload)
+	}
+}
+
+// watchRemote requests a reload when a remote configuration file of c changed
+// if polling is enabled, the returned function stops the watch.
+func watchRemote(ctx context.Context, c *config.Config, reload func()) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	if interval := c.Agent.ConfigPollInterval.Duration; interval > 0 && len(c.Remotes) > 0 {
+		go c.WatchRemote(ctx, interval, reload)
+	}
+	return cancel
+}
+
+func runAgent(ctx context.Context,
+	inputFilters []string,
+	outputFilters []string,
+	hup chan struct{},
+	restart func(),
+) error {
+	log.Printf("I! Starting Telegraf %s", version)
+
+	// If no other options are specified, load the config file and run.
+	c, err := loadConfig(inputFilters, outputFilters)
+	if err != nil {
+		return err
+	}
+
 	ag, err := agent.NewAgent(c)
 	if err != nil {
 		return err
@@ -162,6 +487,7 @@ func runAgent(ctx context.Context,
 		Debug:               ag.Config.Agent.Debug || *fDebug,
 		Quiet:               ag.Config.Agent.Quiet || *fQuiet,
 		LogTarget:           ag.Config.Agent.LogTarget,
+		LogFormat:           ag.Config.Agent.LogFormat,
 		Logfile:             ag.Config.Agent.Logfile,
 		RotationInterval:    ag.Config.Agent.LogfileRotationInterval,
 		RotationMaxSize:     ag.Config.Agent.LogfileRotationMaxSize,
@@ -170,11 +496,38 @@ func runAgent(ctx context.Context,
 
 	logger.SetupLogging(logConfig)
 
+	if *fReplay {
+		if len(flag.Args()) == 0 {
+			return errors.New("no files to replay")
+		}
+		parserConfig := ag.Config.Replay
+		if parserConfig == nil {
+			parserConfig = &parsers.Config{
+				DataFormat: "influx",
+				MetricName: "replay",
+				JSONStrict: true,
+			}
+		}
+		if *fReplayFormat != "" {
+			parserConfig.DataFormat = *fReplayFormat
+		}
+		parser, err := parsers.NewParser(parserConfig)
+		if err != nil {
+			return err
+		}
+		return ag.Replay(ctx, flag.Args(), parser, *fReplayRate)
+	}
+
 	if *fRunOnce {
 		wait := time.Duration(*fTestWait) * time.Second
 		return ag.Once(ctx, wait)
 	}
 
+	if *fTestPipeline {
+		wait := time.Duration(*fTestWait) * time.Second
+		return ag.TestPipeline(ctx, wait, *fTestPipelineWindow)
+	}
+
 	if *fTest || *fTestWait != 0 {
 		wait := time.Duration(*fTestWait) * time.Second
 		return ag.Test(ctx, wait)
@@ -204,6 +557,14 @@ func runAgent(ctx context.Context,
 		}
 	}
 
+	ag.RequestReload = func() {
+		select {
+		case hup <- struct{}{}:
+		default:
+		}
+	}
+	go reloadAgent(ctx, ag, c, inputFilters, outputFilters, hup, restart)
+
 	return ag.Run(ctx)
 }
 
@@ -291,7 +652,14 @@ func main() {
 		case "version":
 			fmt.Println(formatFullVersion())
 			return
+		case "plugins":
+			os.Exit(printPlugins(args[1:]))
+		case "tap":
+			os.Exit(tapStage(args[1:]))
 		case "config":
+			if len(args) > 1 && args[1] == "migrate" {
+				os.Exit(migrateConfig(args[2:]))
+			}
 			config.PrintSampleConfig(
 				sectionFilters,
 				inputFilters,
@@ -358,6 +726,10 @@ func main() {
 		log.Println("Telegraf version already configured to: " + internal.Version())
 	}
 
+	if *fCheckConfig {
+		os.Exit(checkConfig(inputFilters, outputFilters))
+	}
+
 	run(
 		inputFilters,
 		outputFilters,
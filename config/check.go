@@ -0,0 +1,213 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/toml/ast"
+)
+
+// CheckError is a problem found in the configuration, File and Line are the
+// location of the plugin table when known.
+type CheckError struct {
+	File   string
+	Line   int
+	Plugin string
+	Err    error
+}
+
+func (e *CheckError) Error() string {
+	msg := e.Err.Error()
+	if e.Plugin != "" {
+		msg = e.Plugin + ": " + msg
+	}
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, msg)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, msg)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	return msg
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// location is where a plugin is defined in the configuration.
+type location struct {
+	file string
+	line int
+}
+
+func (c *Config) location(tbl *ast.Table) location {
+	return location{file: c.file, line: tbl.Line}
+}
+
+// fileError handles an error loading a whole file.
+func (c *Config) fileError(path string, err error) error {
+	if !c.CollectErrors {
+		return fmt.Errorf("Error loading config file %s: %w", path, err)
+	}
+	c.loadErrs = append(c.loadErrs, &CheckError{File: path, Err: err})
+	return nil
+}
+
+// loadError handles the result of loading a plugin table.  The error is
+// returned as is unless errors are collected, then it is recorded along with
+// any unused fields of the table and loading continues.
+func (c *Config) loadError(tbl *ast.Table, plugin string, err error) error {
+	if !c.CollectErrors {
+		return err
+	}
+	if err == nil && len(c.UnusedFields) > 0 {
+		err = fmt.Errorf("configuration specified the fields %q, but they weren't used", keys(c.UnusedFields))
+	}
+	if err != nil {
+		c.loadErrs = append(c.loadErrs, &CheckError{
+			File:   c.file,
+			Line:   tbl.Line,
+			Plugin: plugin,
+			Err:    err,
+		})
+	}
+	c.errs = nil
+	c.UnusedFields = map[string]bool{}
+	return nil
+}
+
+// Check initializes the loaded plugins and returns all errors found in the
+// configuration, sorted by location.  Nothing is gathered or written and
+// outputs are not connected, but the plugins must not be run afterwards.
+//
+// Set CollectErrors before loading to get more than the first load error.
+func (c *Config) Check() []error {
+	errs := append([]*CheckError(nil), c.loadErrs...)
+	add := func(plugin interface{}, name string, err error) {
+		if err == nil {
+			return
+		}
+		loc := c.locations[plugin]
+		errs = append(errs, &CheckError{File: loc.file, Line: loc.line, Plugin: name, Err: err})
+	}
+
+	if c.Agent.Interval.Duration <= 0 {
+		add(nil, "agent", fmt.Errorf("interval must be positive, found %s", c.Agent.Interval.Duration))
+	}
+	if c.Agent.FlushInterval.Duration <= 0 {
+		add(nil, "agent", fmt.Errorf("flush_interval must be positive, found %s", c.Agent.FlushInterval.Duration))
+	}
+
+	// References to unknown secret stores are kept as text by the plugins,
+	// they are likely misspelled.
+	secrets := func(plugin, settings interface{}, name string) {
+		for _, ref := range c.SecretStores.Unknown(settings) {
+			add(plugin, name, fmt.Errorf("secret store of %s does not exist", ref))
+		}
+	}
+
+	for _, input := range c.Inputs {
+		secrets(input, input.Input, input.LogName())
+		add(input, input.LogName(), input.Init())
+	}
+	for _, processor := range c.Processors {
+		secrets(processor, processor.Processor, processor.LogName())
+		add(processor, processor.LogName(), processor.Init())
+	}
+	for _, aggregator := range c.Aggregators {
+		secrets(aggregator, aggregator.Aggregator, aggregator.LogName())
+		add(aggregator, aggregator.LogName(), aggregator.Init())
+	}
+	for _, output := range c.Outputs {
+		secrets(output, output.Output, output.LogName())
+		// RunningOutput.Init would open the disk buffer.
+		add(output, output.LogName(), output.InitOutput())
+	}
+
+	_, err := models.OutputGroupMembers(c.OutputGroups, c.Outputs, len(c.OutputFilters) > 0)
+	add(nil, "output_groups", err)
+
+	errs = append(errs, c.checkPipelines()...)
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File < errs[j].File
+		}
+		return errs[i].Line < errs[j].Line
+	})
+
+	result := make([]error, 0, len(errs))
+	for _, err := range errs {
+		result = append(result, err)
+	}
+	return result
+}
+
+// CheckPipelines returns an error for each pipeline name that is most likely
+// misspelled, see Check.
+func (c *Config) CheckPipelines() []error {
+	var result []error
+	for _, err := range c.checkPipelines() {
+		result = append(result, err)
+	}
+	return result
+}
+
+// checkPipelines reports the pipelines of the outputs that no input, processor
+// or aggregator uses, and the pipelines of the inputs that no output receives.
+// The checks are skipped when plugins are filtered on the command line, and
+// the inputs are not checked without outputs.
+func (c *Config) checkPipelines() []*CheckError {
+	var errs []*CheckError
+
+	if len(c.InputFilters) == 0 {
+		used := make(map[string]bool)
+		for _, input := range c.Inputs {
+			used[models.PipelineName(input.Config.Pipeline)] = true
+		}
+		for _, processor := range c.Processors {
+			used[models.PipelineName(processor.Config.Pipeline)] = true
+		}
+		for _, aggregator := range c.Aggregators {
+			used[models.PipelineName(aggregator.Config.Pipeline)] = true
+		}
+
+		for _, output := range c.Outputs {
+			for _, name := range output.Config.Pipelines {
+				if used[models.PipelineName(name)] {
+					continue
+				}
+				loc := c.locations[output]
+				errs = append(errs, &CheckError{File: loc.file, Line: loc.line, Plugin: output.LogName(),
+					Err: fmt.Errorf("no input, processor or aggregator uses the pipeline %q", models.PipelineName(name))})
+			}
+		}
+	}
+
+	if len(c.OutputFilters) == 0 && len(c.Outputs) != 0 {
+		reported := make(map[string]bool)
+		for _, input := range c.Inputs {
+			name := models.PipelineName(input.Config.Pipeline)
+			if reported[name] || receivesPipeline(c.Outputs, name) {
+				continue
+			}
+			reported[name] = true
+			loc := c.locations[input]
+			errs = append(errs, &CheckError{File: loc.file, Line: loc.line, Plugin: input.LogName(),
+				Err: fmt.Errorf("no output receives the pipeline %q", name)})
+		}
+	}
+	return errs
+}
+
+func receivesPipeline(outputs []*models.RunningOutput, pipeline string) bool {
+	for _, output := range outputs {
+		if output.Config.ReceivesPipeline(pipeline) {
+			return true
+		}
+	}
+	return false
+}
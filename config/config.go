@@ -2,10 +2,14 @@ package config
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -19,12 +23,15 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/cron"
+	"github.com/influxdata/telegraf/logger"
 	"github.com/influxdata/telegraf/models"
 	"github.com/influxdata/telegraf/plugins/aggregators"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/processors"
+	"github.com/influxdata/telegraf/plugins/secretstores"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/toml"
 	"github.com/influxdata/toml/ast"
@@ -42,8 +49,12 @@ var (
 	// Default output plugins
 	outputDefaults = []string{"influxdb"}
 
-	// envVarRe is a regex to find environment variables in the config file
-	envVarRe = regexp.MustCompile(`\$\{(\w+)\}|\$(\w+)`)
+	// envVarRe is a regex to find environment variables in the config file,
+	// ${VAR:-default}, ${VAR:?message} and ${file:path} included
+	envVarRe = regexp.MustCompile(`\$\{(\w+)(?::([-?])([^}]*))?\}|\$\{file:([^}]+)\}|\$(\w+)`)
+
+	// secretStoreIDRe matches the ids usable in secret references, @{id:key}
+	secretStoreIDRe = regexp.MustCompile(`^\w+$`)
 
 	envVarEscaper = strings.NewReplacer(
 		`"`, `\"`,
@@ -70,6 +81,23 @@ type Config struct {
 	// Processors have a slice wrapper type because they need to be sorted
 	Processors    models.RunningProcessors
 	AggProcessors models.RunningProcessors
+
+	OutputGroups []*models.OutputGroupConfig
+	SecretStores models.SecretStores
+
+	// Replay is the parser configuration of the replayed files, set by the
+	// [replay] table.
+	Replay *parsers.Config
+
+	// Remotes are the configuration files loaded from URLs.
+	Remotes []*RemoteConfig
+
+	// CollectErrors keeps loading the configuration after a plugin fails to
+	// load, the errors are reported by Check.
+	CollectErrors bool
+	loadErrs      []*CheckError
+	file          string // file being loaded
+	locations     map[interface{}]location
 }
 
 // NewConfig creates a new struct to hold the Telegraf config.
@@ -78,6 +106,8 @@ type Config struct {
 func NewConfig() *Config {
 	c := &Config{
 		UnusedFields: map[string]bool{},
+		locations:    make(map[interface{}]location),
+		SecretStores: make(models.SecretStores),
 
 		// Agent defaults:
 		Agent: &AgentConfig{
@@ -130,6 +160,13 @@ type AgentConfig struct {
 	// same time, which can have a measurable effect on the system.
 	CollectionJitter internal.Duration
 
+	// MetricMaxAge and MetricMaxFutureSkew are the default limits on the age
+	// of the metrics gathered by inputs, metrics outside of the limits are
+	// handled according to MetricTimeAction, either "drop" or "restamp".
+	MetricMaxAge        internal.Duration `toml:"metric_max_age"`
+	MetricMaxFutureSkew internal.Duration `toml:"metric_max_future_skew"`
+	MetricTimeAction    string            `toml:"metric_time_action"`
+
 	// FlushInterval is the Interval at which to flush data
 	FlushInterval internal.Duration
 
@@ -150,6 +187,11 @@ type AgentConfig struct {
 	// not be less than 2 times MetricBatchSize.
 	MetricBufferLimit int
 
+	// MaxBufferMemory is the limit on the approximate memory used by the
+	// memory buffers of all outputs, when exceeded the oldest metrics of the
+	// outputs with the lowest buffer_priority are dropped.
+	MaxBufferMemory internal.Size `toml:"max_buffer_memory"`
+
 	// FlushBufferWhenFull tells Telegraf to flush the metric buffer whenever
 	// it fills up, regardless of FlushInterval. Setting this option to true
 	// does _not_ deactivate FlushInterval.
@@ -171,6 +213,10 @@ type AgentConfig struct {
 	// is determined by the "logfile" setting.
 	LogTarget string `toml:"logtarget"`
 
+	// Log format is either "text" or "json", json writes one object per
+	// message with the level and the plugin it is from.
+	LogFormat string `toml:"logformat"`
+
 	// Name of the file to be logged to when using the "file" logtarget.  If set to
 	// the empty string then logs are written to stderr.
 	Logfile string `toml:"logfile"`
@@ -189,6 +235,16 @@ type AgentConfig struct {
 
 	Hostname     string
 	OmitHostname bool
+
+	// APIAddress is the address of the local control API, either
+	// "host:port" on the loopback interface or "unix:///path/to/socket".
+	// The API is disabled when empty.
+	APIAddress string `toml:"api_address"`
+
+	// ConfigPollInterval is the interval to poll the configuration files
+	// loaded from URLs, the agent is reloaded when they change.  Polling is
+	// disabled when zero.
+	ConfigPollInterval internal.Duration `toml:"config_poll_interval"`
 }
 
 // InputNames returns a list of strings of the configured inputs.
@@ -305,6 +361,11 @@ var agentConfig = `
   ## cost of higher maximum memory usage.
   metric_buffer_limit = 10000
 
+  ## Maximum approximate memory used by the unwritten metrics of all outputs.
+  ## When exceeded the oldest metrics of the outputs with the lowest
+  ## buffer_priority are dropped.  Not enforced when not set.
+  # max_buffer_memory = "256MiB"
+
   ## Collection jitter is used to jitter the collection by a random amount.
   ## Each plugin will sleep for a random time within jitter before collecting.
   ## This can be used to avoid many plugins querying things like sysfs at the
@@ -328,6 +389,14 @@ var agentConfig = `
   ## Valid time units are "ns", "us" (or "µs"), "ms", "s".
   precision = ""
 
+  ## Metrics gathered by inputs with a timestamp older than metric_max_age or
+  ## further in the future than metric_max_future_skew are dropped, or with
+  ## metric_time_action = "restamp" their timestamp is set to the current
+  ## time.  The limits are not enforced when not set.
+  # metric_max_age = "0s"
+  # metric_max_future_skew = "0s"
+  # metric_time_action = "drop"
+
   ## Log at debug level.
   # debug = false
   ## Log only error level messages.
@@ -338,6 +407,11 @@ var agentConfig = `
   ## is determined by the "logfile" setting.
   # logtarget = "file"
 
+  ## Log format is either "text" or "json", json writes one object per message
+  ## with the level and the plugin the message is from.  The eventlog target
+  ## ignores the format.
+  # logformat = "text"
+
   ## Name of the file to be logged to when using the "file" logtarget.  If set to
   ## the empty string then logs are written to stderr.
   # logfile = ""
@@ -360,6 +434,14 @@ var agentConfig = `
   ## If set to true, do no set the "host" tag in the telegraf agent.
   omit_hostname = false
 
+  ## Address of the local control API, either "host:port" on the loopback
+  ## interface or "unix:///path/to/socket".  The API is disabled when not set.
+  # api_address = "localhost:8008"
+
+  ## Interval to poll the configuration when loaded from an URL, Telegraf
+  ## reloads the configuration when it changed.  Not polled when not set.
+  # config_poll_interval = "0s"
+
 `
 
 var outputHeader = `
@@ -655,7 +737,8 @@ func PrintOutputConfig(name string) error {
 	return nil
 }
 
-// LoadDirectory loads all toml config files found in the specified path, recursively.
+// LoadDirectory loads all toml, yaml and json config files found in the
+// specified path, recursively.
 func (c *Config) LoadDirectory(path string) error {
 	walkfn := func(thispath string, info os.FileInfo, _ error) error {
 		if info == nil {
@@ -671,8 +754,7 @@ func (c *Config) LoadDirectory(path string) error {
 
 			return nil
 		}
-		name := info.Name()
-		if len(name) < 6 || name[len(name)-5:] != ".conf" {
+		if !isConfigFile(info.Name()) {
 			return nil
 		}
 		err := c.LoadConfig(thispath)
@@ -720,20 +802,29 @@ func (c *Config) LoadConfig(path string) error {
 			return err
 		}
 	}
-	data, err := loadConfig(path)
+	data, err := c.loadConfig(path)
 	if err != nil {
-		return fmt.Errorf("Error loading config file %s: %w", path, err)
+		return c.fileError(path, err)
 	}
 
-	if err = c.LoadConfigData(data); err != nil {
-		return fmt.Errorf("Error loading config file %s: %w", path, err)
+	c.file = path
+	defer func() { c.file = "" }()
+	if err = c.loadConfigData(data, configFormat(path)); err != nil {
+		return c.fileError(path, err)
 	}
 	return nil
 }
 
 // LoadConfigData loads TOML-formatted config data
 func (c *Config) LoadConfigData(data []byte) error {
-	tbl, err := parseConfig(data)
+	return c.loadConfigData(data, formatTOML)
+}
+
+// loadConfigData loads config data in the TOML, YAML or JSON format.
+func (c *Config) loadConfigData(data []byte, format string) error {
+	// The configurations loaded from URLs must not read the files of the
+	// host.
+	tbl, err := parseConfig(data, format, !isURL(c.file))
 	if err != nil {
 		return fmt.Errorf("Error parsing data: %s", err)
 	}
@@ -757,7 +848,7 @@ func (c *Config) LoadConfigData(data []byte) error {
 		if !ok {
 			return fmt.Errorf("invalid configuration, error parsing agent table")
 		}
-		if err = c.toml.UnmarshalTable(subTable, c.Agent); err != nil {
+		if err = c.loadError(subTable, "agent", c.toml.UnmarshalTable(subTable, c.Agent)); err != nil {
 			return fmt.Errorf("error parsing [agent]: %w", err)
 		}
 	}
@@ -779,8 +870,25 @@ func (c *Config) LoadConfigData(data []byte) error {
 		return fmt.Errorf("line %d: configuration specified the fields %q, but they weren't used", tbl.Line, keys(c.UnusedFields))
 	}
 
+	// Parse output groups:
+	if val, ok := tbl.Fields["output_groups"]; ok {
+		subTables, ok := val.([]*ast.Table)
+		if !ok {
+			return fmt.Errorf("invalid configuration, error parsing output_groups, expected [[output_groups]]")
+		}
+		for _, t := range subTables {
+			if err = c.loadError(t, "output_groups", c.addOutputGroup(t)); err != nil {
+				return fmt.Errorf("error parsing output_groups, %w", err)
+			}
+		}
+	}
+
 	// Parse all the rest of the plugins:
 	for name, val := range tbl.Fields {
+		if name == "output_groups" {
+			continue
+		}
+
 		subTable, ok := val.(*ast.Table)
 		if !ok {
 			return fmt.Errorf("invalid configuration, error parsing field %q as table", name)
@@ -793,12 +901,12 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [outputs.influxdb] support
 				case *ast.Table:
-					if err = c.addOutput(pluginName, pluginSubTable); err != nil {
+					if err = c.loadError(pluginSubTable, "outputs."+pluginName, c.addOutput(pluginName, pluginSubTable)); err != nil {
 						return fmt.Errorf("error parsing %s, %w", pluginName, err)
 					}
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addOutput(pluginName, t); err != nil {
+						if err = c.loadError(t, "outputs."+pluginName, c.addOutput(pluginName, t)); err != nil {
 							return fmt.Errorf("error parsing %s array, %w", pluginName, err)
 						}
 					}
@@ -815,12 +923,12 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [inputs.cpu] support
 				case *ast.Table:
-					if err = c.addInput(pluginName, pluginSubTable); err != nil {
+					if err = c.loadError(pluginSubTable, "inputs."+pluginName, c.addInput(pluginName, pluginSubTable)); err != nil {
 						return fmt.Errorf("error parsing %s, %w", pluginName, err)
 					}
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addInput(pluginName, t); err != nil {
+						if err = c.loadError(t, "inputs."+pluginName, c.addInput(pluginName, t)); err != nil {
 							return fmt.Errorf("error parsing %s, %w", pluginName, err)
 						}
 					}
@@ -837,7 +945,7 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addProcessor(pluginName, t); err != nil {
+						if err = c.loadError(t, "processors."+pluginName, c.addProcessor(pluginName, t)); err != nil {
 							return fmt.Errorf("error parsing %s, %w", pluginName, err)
 						}
 					}
@@ -854,7 +962,7 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addAggregator(pluginName, t); err != nil {
+						if err = c.loadError(t, "aggregators."+pluginName, c.addAggregator(pluginName, t)); err != nil {
 							return fmt.Errorf("Error parsing %s, %s", pluginName, err)
 						}
 					}
@@ -866,10 +974,34 @@ func (c *Config) LoadConfigData(data []byte) error {
 					return fmt.Errorf("plugin %s.%s: line %d: configuration specified the fields %q, but they weren't used", name, pluginName, subTable.Line, keys(c.UnusedFields))
 				}
 			}
+		case "replay":
+			if err = c.loadError(subTable, "replay", c.addReplay(subTable)); err != nil {
+				return fmt.Errorf("error parsing [replay]: %w", err)
+			}
+			if len(c.UnusedFields) > 0 {
+				return fmt.Errorf("[replay]: line %d: configuration specified the fields %q, but they weren't used", subTable.Line, keys(c.UnusedFields))
+			}
+		case "secretstores":
+			for pluginName, pluginVal := range subTable.Fields {
+				switch pluginSubTable := pluginVal.(type) {
+				case []*ast.Table:
+					for _, t := range pluginSubTable {
+						if err = c.loadError(t, "secretstores."+pluginName, c.addSecretStore(pluginName, t)); err != nil {
+							return fmt.Errorf("error parsing %s, %w", pluginName, err)
+						}
+					}
+				default:
+					return fmt.Errorf("Unsupported config format: %s",
+						pluginName)
+				}
+				if len(c.UnusedFields) > 0 {
+					return fmt.Errorf("plugin %s.%s: line %d: configuration specified the fields %q, but they weren't used", name, pluginName, subTable.Line, keys(c.UnusedFields))
+				}
+			}
 		// Assume it's an input input for legacy config file support if no other
 		// identifiers are present
 		default:
-			if err = c.addInput(name, subTable); err != nil {
+			if err = c.loadError(subTable, "inputs."+name, c.addInput(name, subTable)); err != nil {
 				return fmt.Errorf("Error parsing %s, %s", name, err)
 			}
 		}
@@ -894,7 +1026,9 @@ func escapeEnv(value string) string {
 	return envVarEscaper.Replace(value)
 }
 
-func loadConfig(config string) ([]byte, error) {
+// loadConfig reads the configuration from a file or an URL, the version of
+// the files loaded from URLs is kept to poll them for changes.
+func (c *Config) loadConfig(config string) ([]byte, error) {
 	u, err := url.Parse(config)
 	if err != nil {
 		return nil, err
@@ -902,7 +1036,13 @@ func loadConfig(config string) ([]byte, error) {
 
 	switch u.Scheme {
 	case "https", "http":
-		return fetchConfig(u)
+		remote := &RemoteConfig{URL: u.String()}
+		data, _, err := remote.fetch(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		c.Remotes = append(c.Remotes, remote)
+		return data, nil
 	default:
 		// If it isn't a https scheme, try it as a file.
 	}
@@ -910,59 +1050,173 @@ func loadConfig(config string) ([]byte, error) {
 
 }
 
-func fetchConfig(u *url.URL) ([]byte, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
+// parseConfig loads a TOML, YAML or JSON configuration from a provided path
+// and returns the AST produced from the TOML parser. When loading the file, it
+// will find environment variables and replace them, file references are only
+// replaced if files is true.
+func parseConfig(contents []byte, format string, files bool) (*ast.Table, error) {
+	contents = trimBOM(contents)
+
+	// The environment variables of YAML files are replaced in the parsed
+	// values, so that they cannot change the structure of the document.
+	if format == formatYAML {
+		return parseYAML(contents, format, files)
+	}
+
+	contents, err := substituteEnv(contents, format, files)
 	if err != nil {
 		return nil, err
 	}
 
-	if v, exists := os.LookupEnv("INFLUX_TOKEN"); exists {
-		req.Header.Add("Authorization", "Token "+v)
+	if format != formatTOML {
+		return parseYAML(contents, format, files)
 	}
-	req.Header.Add("Accept", "application/toml")
-	req.Header.Set("User-Agent", internal.ProductToken())
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	return toml.Parse(contents)
+}
+
+// substituteEnv replaces the environment variables and file references of the
+// configuration, the values are escaped for use within quotes.  The comments
+// of TOML configurations are left as they are.
+func substituteEnv(contents []byte, format string, files bool) ([]byte, error) {
+	var comments [][2]int
+	if format == formatTOML {
+		comments = tomlComments(contents)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to retrieve remote config: %s", resp.Status)
+	var result bytes.Buffer
+	var errs []string
+	expand := func(start, end int) {
+		result.WriteString(expandEnv(string(contents[start:end]), files, escapeEnv, func(offset int, msg string) {
+			line := bytes.Count(contents[:start+offset], []byte("\n")) + 1
+			errs = append(errs, fmt.Sprintf("line %d: %s", line, msg))
+		}))
+	}
+	last := 0
+	for _, comment := range comments {
+		expand(last, comment[0])
+		result.Write(contents[comment[0]:comment[1]])
+		last = comment[1]
 	}
+	expand(last, len(contents))
 
-	defer resp.Body.Close()
-	return ioutil.ReadAll(resp.Body)
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return result.Bytes(), nil
 }
 
-// parseConfig loads a TOML configuration from a provided path and
-// returns the AST produced from the TOML parser. When loading the file, it
-// will find environment variables and replace them.
-func parseConfig(contents []byte) (*ast.Table, error) {
-	contents = trimBOM(contents)
+// tomlComments returns the start and end offsets of the comments of the TOML
+// configuration, a comment starts with a hash outside of strings and ends
+// with the line.
+func tomlComments(contents []byte) [][2]int {
+	var comments [][2]int
+	// skip returns the offset after the end of the string starting at i with
+	// the delimiter, backslashes escape in basic strings.
+	skip := func(i int, delim string) int {
+		escapes := delim[0] == '"'
+		multiline := len(delim) == 3
+		for i += len(delim); i < len(contents); i++ {
+			switch {
+			case escapes && contents[i] == '\\':
+				i++
+			case contents[i] == '\n' && !multiline:
+				return i
+			case bytes.HasPrefix(contents[i:], []byte(delim)):
+				return i + len(delim)
+			}
+		}
+		return i
+	}
 
-	parameters := envVarRe.FindAllSubmatch(contents, -1)
-	for _, parameter := range parameters {
-		if len(parameter) != 3 {
-			continue
+	for i := 0; i < len(contents); {
+		switch {
+		case contents[i] == '#':
+			end := bytes.IndexByte(contents[i:], '\n')
+			if end < 0 {
+				end = len(contents)
+			} else {
+				end += i
+			}
+			comments = append(comments, [2]int{i, end})
+			i = end
+		case bytes.HasPrefix(contents[i:], []byte(`"""`)):
+			i = skip(i, `"""`)
+		case bytes.HasPrefix(contents[i:], []byte(`'''`)):
+			i = skip(i, `'''`)
+		case contents[i] == '"':
+			i = skip(i, `"`)
+		case contents[i] == '\'':
+			i = skip(i, `'`)
+		default:
+			i++
 		}
+	}
+	return comments
+}
 
-		var envVar []byte
-		if parameter[1] != nil {
-			envVar = parameter[1]
-		} else if parameter[2] != nil {
-			envVar = parameter[2]
-		} else {
+// expandEnv replaces the environment variables and file references of s, the
+// values are passed through escape.  Variables that are not set are left as
+// they are unless they have a default, ${VAR:-default}, or are required,
+// ${VAR:?message}.  fail is called with the offset of every required variable
+// not set and file that cannot be read, and of the file references if files
+// is false.
+func expandEnv(s string, files bool, escape func(string) string, fail func(offset int, msg string)) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range envVarRe.FindAllStringSubmatchIndex(s, -1) {
+		group := func(i int) string {
+			if match[2*i] < 0 {
+				return ""
+			}
+			return s[match[2*i]:match[2*i+1]]
+		}
+
+		result.WriteString(s[last:match[0]])
+		last = match[1]
+
+		name, op, word, file := group(1)+group(5), group(2), group(3), group(4)
+		var value string
+		var ok bool
+		switch {
+		case file != "" && !files:
+			fail(match[0], fmt.Sprintf("file reference %q is not allowed in configurations loaded from URLs", s[match[0]:match[1]]))
 			continue
+		case file != "":
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				fail(match[0], err.Error())
+				continue
+			}
+			value, ok = strings.TrimRight(string(data), "\r\n"), true
+		case op == "-":
+			value, ok = os.LookupEnv(name)
+			if !ok || value == "" {
+				// The default is part of the configuration, it is not
+				// escaped.
+				result.WriteString(word)
+				continue
+			}
+		case op == "?":
+			value, ok = os.LookupEnv(name)
+			if !ok || value == "" {
+				if word == "" {
+					word = "required variable is not set"
+				}
+				fail(match[0], name+": "+word)
+				continue
+			}
+		default:
+			value, ok = os.LookupEnv(name)
 		}
 
-		envVal, ok := os.LookupEnv(strings.TrimPrefix(string(envVar), "$"))
-		if ok {
-			envVal = escapeEnv(envVal)
-			contents = bytes.Replace(contents, parameter[0], []byte(envVal), 1)
+		if !ok {
+			result.WriteString(s[match[0]:match[1]])
+			continue
 		}
+		result.WriteString(escape(value))
 	}
-
-	return toml.Parse(contents)
+	result.WriteString(s[last:])
+	return result.String()
 }
 
 func (c *Config) addAggregator(name string, table *ast.Table) error {
@@ -981,7 +1235,28 @@ func (c *Config) addAggregator(name string, table *ast.Table) error {
 		return err
 	}
 
-	c.Aggregators = append(c.Aggregators, models.NewRunningAggregator(aggregator, conf))
+	ra := models.NewRunningAggregator(aggregator, conf)
+	ra.Secrets = c.SecretStores
+	if conf.EventTime {
+		// Each window has its own instance of the aggregator, unknown fields
+		// were already reported.
+		tomlCfg := &toml.Config{
+			NormFieldName: toml.DefaultConfig.NormFieldName,
+			FieldToKey:    toml.DefaultConfig.FieldToKey,
+			MissingField: func(reflect.Type, string) error {
+				return nil
+			},
+		}
+		ra.NewAggregator = func() (telegraf.Aggregator, error) {
+			aggregator := creator()
+			if err := tomlCfg.UnmarshalTable(table, aggregator); err != nil {
+				return nil, err
+			}
+			return aggregator, nil
+		}
+	}
+	c.locations[ra] = c.location(table)
+	c.Aggregators = append(c.Aggregators, ra)
 	return nil
 }
 
@@ -1000,6 +1275,7 @@ func (c *Config) addProcessor(name string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	c.locations[rf] = c.location(table)
 	c.Processors = append(c.Processors, rf)
 
 	// save a copy for the aggregator
@@ -1031,6 +1307,7 @@ func (c *Config) newRunningProcessor(
 	}
 
 	rf := models.NewRunningProcessor(processor, processorConfig)
+	rf.Secrets = c.SecretStores
 	return rf, nil
 }
 
@@ -1064,12 +1341,110 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 		return err
 	}
 
+	if outputConfig.BufferStrategy == models.BufferStrategyDisk {
+		for _, other := range c.Outputs {
+			if other.Config.BufferStrategy == models.BufferStrategyDisk &&
+				other.Config.BufferPath() == outputConfig.BufferPath() {
+				return fmt.Errorf("disk buffer directory %q is already used by another output, set a unique alias",
+					outputConfig.BufferPath())
+			}
+		}
+	}
+
 	ro := models.NewRunningOutput(name, output, outputConfig,
 		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	ro.Secrets = c.SecretStores
+	c.locations[ro] = c.location(table)
 	c.Outputs = append(c.Outputs, ro)
 	return nil
 }
 
+func (c *Config) addOutputGroup(table *ast.Table) error {
+	for key := range table.Fields {
+		switch key {
+		case "name", "mode", "outputs", "failback_interval":
+		default:
+			return fmt.Errorf("line %d: unknown field %q", table.Line, key)
+		}
+	}
+
+	gc := &models.OutputGroupConfig{
+		Mode:             models.OutputGroupFailover,
+		FailbackInterval: models.DEFAULT_FAILBACK_INTERVAL,
+	}
+	c.getFieldString(table, "name", &gc.Name)
+	c.getFieldString(table, "mode", &gc.Mode)
+	c.getFieldStringSlice(table, "outputs", &gc.Outputs)
+	c.getFieldDuration(table, "failback_interval", &gc.FailbackInterval)
+	if c.hasErrs() {
+		return c.firstErr()
+	}
+
+	if err := gc.Validate(); err != nil {
+		return err
+	}
+	for _, g := range c.OutputGroups {
+		if g.Name == gc.Name {
+			return fmt.Errorf("duplicate output group %q", gc.Name)
+		}
+	}
+
+	c.locations[gc] = c.location(table)
+	c.OutputGroups = append(c.OutputGroups, gc)
+	return nil
+}
+
+// addReplay loads the parser settings of the replayed files.
+func (c *Config) addReplay(table *ast.Table) error {
+	// Only the parser settings are used, any other setting is reported as
+	// unused.
+	if err := c.toml.UnmarshalTable(table, &struct{}{}); err != nil {
+		return err
+	}
+	config, err := c.getParserConfig("replay", table)
+	if err != nil {
+		return err
+	}
+	c.Replay = config
+	return nil
+}
+
+// addSecretStore initializes the store right away, the secrets are only read
+// when the plugins referencing them are initialized.
+func (c *Config) addSecretStore(name string, table *ast.Table) error {
+	creator, ok := secretstores.SecretStores[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested secret store: %s", name)
+	}
+	store := creator()
+
+	var id string
+	c.getFieldString(table, "id", &id)
+	if id == "" {
+		return fmt.Errorf("id is required")
+	}
+	if !secretStoreIDRe.MatchString(id) {
+		return fmt.Errorf("invalid id %q, only letters, digits and underscores are allowed", id)
+	}
+	if _, ok := c.SecretStores[id]; ok {
+		return fmt.Errorf("duplicate secret store id %q", id)
+	}
+
+	// The id is not a setting of the store.
+	delete(table.Fields, "id")
+	if err := c.toml.UnmarshalTable(table, store); err != nil {
+		return err
+	}
+	if p, ok := store.(telegraf.Initializer); ok {
+		if err := p.Init(); err != nil {
+			return err
+		}
+	}
+
+	c.SecretStores[id] = store
+	return nil
+}
+
 func (c *Config) addInput(name string, table *ast.Table) error {
 	if len(c.InputFilters) > 0 && !sliceContains(name, c.InputFilters) {
 		return nil
@@ -1116,6 +1491,8 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 
 	rp := models.NewRunningInput(input, pluginConfig)
 	rp.SetDefaultTags(c.Tags)
+	rp.Secrets = c.SecretStores
+	c.locations[rp] = c.location(table)
 	c.Inputs = append(c.Inputs, rp)
 	return nil
 }
@@ -1134,11 +1511,16 @@ func (c *Config) buildAggregator(name string, tbl *ast.Table) (*models.Aggregato
 	c.getFieldDuration(tbl, "period", &conf.Period)
 	c.getFieldDuration(tbl, "delay", &conf.Delay)
 	c.getFieldDuration(tbl, "grace", &conf.Grace)
+	c.getFieldBool(tbl, "event_time", &conf.EventTime)
+	c.getFieldDuration(tbl, "watermark", &conf.Watermark)
 	c.getFieldBool(tbl, "drop_original", &conf.DropOriginal)
 	c.getFieldString(tbl, "name_prefix", &conf.MeasurementPrefix)
 	c.getFieldString(tbl, "name_suffix", &conf.MeasurementSuffix)
 	c.getFieldString(tbl, "name_override", &conf.NameOverride)
 	c.getFieldString(tbl, "alias", &conf.Alias)
+	c.getFieldString(tbl, "pipeline", &conf.Pipeline)
+	c.getFieldLogLevel(tbl, "log_level", &conf.LogLevel)
+	conf.Fingerprint = tableFingerprint(tbl)
 
 	conf.Tags = make(map[string]string)
 	if node, ok := tbl.Fields["tags"]; ok {
@@ -1153,6 +1535,10 @@ func (c *Config) buildAggregator(name string, tbl *ast.Table) (*models.Aggregato
 		return nil, c.firstErr()
 	}
 
+	if conf.Watermark < 0 {
+		return nil, fmt.Errorf("watermark must not be negative")
+	}
+
 	var err error
 	conf.Filter, err = c.buildFilter(tbl)
 	if err != nil {
@@ -1169,6 +1555,9 @@ func (c *Config) buildProcessor(name string, tbl *ast.Table) (*models.ProcessorC
 
 	c.getFieldInt64(tbl, "order", &conf.Order)
 	c.getFieldString(tbl, "alias", &conf.Alias)
+	c.getFieldString(tbl, "pipeline", &conf.Pipeline)
+	c.getFieldLogLevel(tbl, "log_level", &conf.LogLevel)
+	conf.Fingerprint = tableFingerprint(tbl)
 
 	if c.hasErrs() {
 		return nil, c.firstErr()
@@ -1204,6 +1593,8 @@ func (c *Config) buildFilter(tbl *ast.Table) (models.Filter, error) {
 	c.getFieldStringSlice(tbl, "tagexclude", &f.TagExclude)
 	c.getFieldStringSlice(tbl, "taginclude", &f.TagInclude)
 
+	c.getFieldString(tbl, "metricpass", &f.MetricPass)
+
 	if c.hasErrs() {
 		return f, c.firstErr()
 	}
@@ -1219,14 +1610,27 @@ func (c *Config) buildFilter(tbl *ast.Table) (models.Filter, error) {
 // builds the filter and returns a
 // models.InputConfig to be inserted into models.RunningInput
 func (c *Config) buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
-	cp := &models.InputConfig{Name: name}
+	cp := &models.InputConfig{
+		Name:                name,
+		MetricMaxAge:        c.Agent.MetricMaxAge.Duration,
+		MetricMaxFutureSkew: c.Agent.MetricMaxFutureSkew.Duration,
+		MetricTimeAction:    c.Agent.MetricTimeAction,
+	}
 	c.getFieldDuration(tbl, "interval", &cp.Interval)
 	c.getFieldDuration(tbl, "precision", &cp.Precision)
 	c.getFieldDuration(tbl, "collection_jitter", &cp.CollectionJitter)
+	c.getFieldSchedule(tbl, "schedule", &cp.Schedule)
+	c.getFieldDuration(tbl, "gather_timeout", &cp.GatherTimeout)
+	c.getFieldDuration(tbl, "metric_max_age", &cp.MetricMaxAge)
+	c.getFieldDuration(tbl, "metric_max_future_skew", &cp.MetricMaxFutureSkew)
+	c.getFieldString(tbl, "metric_time_action", &cp.MetricTimeAction)
 	c.getFieldString(tbl, "name_prefix", &cp.MeasurementPrefix)
 	c.getFieldString(tbl, "name_suffix", &cp.MeasurementSuffix)
 	c.getFieldString(tbl, "name_override", &cp.NameOverride)
 	c.getFieldString(tbl, "alias", &cp.Alias)
+	c.getFieldString(tbl, "pipeline", &cp.Pipeline)
+	c.getFieldLogLevel(tbl, "log_level", &cp.LogLevel)
+	cp.Fingerprint = tableFingerprint(tbl)
 
 	cp.Tags = make(map[string]string)
 	if node, ok := tbl.Fields["tags"]; ok {
@@ -1241,6 +1645,14 @@ func (c *Config) buildInput(name string, tbl *ast.Table) (*models.InputConfig, e
 		return nil, c.firstErr()
 	}
 
+	if err := models.ValidateMetricTimeAction(cp.MetricTimeAction); err != nil {
+		return nil, err
+	}
+
+	if cp.Schedule != nil && cp.Interval != 0 {
+		return nil, fmt.Errorf("interval and schedule cannot both be set")
+	}
+
 	var err error
 	cp.Filter, err = c.buildFilter(tbl)
 	if err != nil {
@@ -1395,10 +1807,26 @@ func (c *Config) buildOutput(name string, tbl *ast.Table) (*models.OutputConfig,
 
 	c.getFieldInt(tbl, "metric_buffer_limit", &oc.MetricBufferLimit)
 	c.getFieldInt(tbl, "metric_batch_size", &oc.MetricBatchSize)
+	c.getFieldString(tbl, "buffer_strategy", &oc.BufferStrategy)
+	c.getFieldString(tbl, "buffer_directory", &oc.BufferDirectory)
+	c.getFieldSize(tbl, "buffer_max_size", &oc.BufferMaxSize)
+	c.getFieldInt(tbl, "buffer_priority", &oc.BufferPriority)
+	c.getFieldDuration(tbl, "retry_initial_backoff", &oc.RetryInitialBackoff)
+	c.getFieldDuration(tbl, "retry_max_backoff", &oc.RetryMaxBackoff)
+	c.getFieldDuration(tbl, "retry_jitter", &oc.RetryJitter)
+	c.getFieldInt(tbl, "breaker_failure_threshold", &oc.BreakerFailureThreshold)
+	c.getFieldDuration(tbl, "breaker_open_timeout", &oc.BreakerOpenTimeout)
+	c.getFieldInt(tbl, "max_concurrent_writes", &oc.MaxConcurrentWrites)
+	c.getFieldDuration(tbl, "metric_max_age", &oc.MetricMaxAge)
+	c.getFieldDuration(tbl, "metric_max_future_skew", &oc.MetricMaxFutureSkew)
+	c.getFieldString(tbl, "metric_time_action", &oc.MetricTimeAction)
 	c.getFieldString(tbl, "alias", &oc.Alias)
 	c.getFieldString(tbl, "name_override", &oc.NameOverride)
 	c.getFieldString(tbl, "name_suffix", &oc.NameSuffix)
 	c.getFieldString(tbl, "name_prefix", &oc.NamePrefix)
+	c.getFieldStringSlice(tbl, "pipelines", &oc.Pipelines)
+	c.getFieldLogLevel(tbl, "log_level", &oc.LogLevel)
+	oc.Fingerprint = tableFingerprint(tbl)
 
 	if c.hasErrs() {
 		return nil, c.firstErr()
@@ -1407,27 +1835,62 @@ func (c *Config) buildOutput(name string, tbl *ast.Table) (*models.OutputConfig,
 	return oc, nil
 }
 
+// tableFingerprint returns a digest of the settings in a plugin table.  Tables
+// with the same settings have the same fingerprint regardless of the order of
+// the settings.
+func tableFingerprint(tbl *ast.Table) string {
+	h := sha256.New()
+	writeTableSettings(h, tbl)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeTableSettings(w io.Writer, tbl *ast.Table) {
+	names := make([]string, 0, len(tbl.Fields))
+	for name := range tbl.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch node := tbl.Fields[name].(type) {
+		case *ast.KeyValue:
+			fmt.Fprintf(w, "%q=%s\n", name, node.Value.Source())
+		case *ast.Table:
+			fmt.Fprintf(w, "[%q]\n", name)
+			writeTableSettings(w, node)
+			fmt.Fprintf(w, "[/%q]\n", name)
+		case []*ast.Table:
+			for _, t := range node {
+				fmt.Fprintf(w, "[[%q]]\n", name)
+				writeTableSettings(w, t)
+				fmt.Fprintf(w, "[[/%q]]\n", name)
+			}
+		}
+	}
+}
+
 func (c *Config) missingTomlField(typ reflect.Type, key string) error {
 	switch key {
-	case "alias", "carbon2_format", "collectd_auth_file", "collectd_parse_multivalue",
+	case "alias", "breaker_failure_threshold", "breaker_open_timeout", "buffer_directory", "buffer_max_size", "buffer_priority", "buffer_strategy", "carbon2_format", "collectd_auth_file", "collectd_parse_multivalue",
 		"collectd_security_level", "collectd_typesdb", "collection_jitter", "csv_column_names",
 		"csv_column_types", "csv_comment", "csv_delimiter", "csv_header_row_count",
 		"csv_measurement_column", "csv_skip_columns", "csv_skip_rows", "csv_tag_columns",
 		"csv_timestamp_column", "csv_timestamp_format", "csv_timezone", "csv_trim_space",
 		"data_format", "data_type", "delay", "drop", "drop_original", "dropwizard_metric_registry_path",
 		"dropwizard_tag_paths", "dropwizard_tags_path", "dropwizard_time_format", "dropwizard_time_path",
-		"fielddrop", "fieldpass", "flush_interval", "flush_jitter", "form_urlencoded_tag_keys",
+		"event_time", "fielddrop", "fieldpass", "flush_interval", "flush_jitter", "form_urlencoded_tag_keys", "gather_timeout",
 		"grace", "graphite_separator", "graphite_tag_support", "grok_custom_pattern_files",
 		"grok_custom_patterns", "grok_named_patterns", "grok_patterns", "grok_timezone",
 		"grok_unique_timestamp", "influx_max_line_bytes", "influx_sort_fields", "influx_uint_support",
 		"interval", "json_name_key", "json_query", "json_strict", "json_string_fields",
-		"json_time_format", "json_time_key", "json_timestamp_units", "json_timezone",
-		"metric_batch_size", "metric_buffer_limit", "name_override", "name_prefix",
-		"name_suffix", "namedrop", "namepass", "order", "pass", "period", "precision",
+		"json_time_format", "json_time_key", "json_timestamp_units", "json_timezone", "log_level",
+		"max_concurrent_writes", "metric_batch_size", "metric_buffer_limit", "metric_max_age",
+		"metric_max_future_skew", "metric_time_action", "metricpass", "name_override", "name_prefix",
+		"name_suffix", "namedrop", "namepass", "order", "pass", "period", "pipeline", "pipelines", "precision",
 		"prefix", "prometheus_export_timestamp", "prometheus_sort_metrics", "prometheus_string_as_label",
-		"separator", "splunkmetric_hec_routing", "splunkmetric_multimetric", "tag_keys",
+		"retry_initial_backoff", "retry_jitter", "retry_max_backoff", "schedule", "separator", "splunkmetric_hec_routing", "splunkmetric_multimetric", "tag_keys",
 		"tagdrop", "tagexclude", "taginclude", "tagpass", "tags", "template", "templates",
-		"wavefront_source_override", "wavefront_use_strict":
+		"watermark", "wavefront_source_override", "wavefront_use_strict":
 
 		// ignore fields that are common to all plugins.
 	default:
@@ -1446,6 +1909,30 @@ func (c *Config) getFieldString(tbl *ast.Table, fieldName string, target *string
 	}
 }
 
+func (c *Config) getFieldLogLevel(tbl *ast.Table, fieldName string, target *string) {
+	c.getFieldString(tbl, fieldName, target)
+	if *target == "" {
+		return
+	}
+	if _, err := logger.ParseLevel(*target); err != nil {
+		c.addError(tbl, err)
+	}
+}
+
+func (c *Config) getFieldSchedule(tbl *ast.Table, fieldName string, target **cron.Schedule) {
+	var spec string
+	c.getFieldString(tbl, fieldName, &spec)
+	if spec == "" {
+		return
+	}
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		c.addError(tbl, fmt.Errorf("error parsing schedule: %w", err))
+		return
+	}
+	*target = schedule
+}
+
 func (c *Config) getFieldDuration(tbl *ast.Table, fieldName string, target interface{}) {
 	if node, ok := tbl.Fields[fieldName]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
@@ -1462,6 +1949,19 @@ func (c *Config) getFieldDuration(tbl *ast.Table, fieldName string, target inter
 	}
 }
 
+func (c *Config) getFieldSize(tbl *ast.Table, fieldName string, target *int64) {
+	if node, ok := tbl.Fields[fieldName]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			var size internal.Size
+			if err := size.UnmarshalTOML([]byte(kv.Value.Source())); err != nil {
+				c.addError(tbl, fmt.Errorf("error parsing size: %w", err))
+				return
+			}
+			*target = size.Size
+		}
+	}
+}
+
 func (c *Config) getFieldBool(tbl *ast.Table, fieldName string, target *bool) {
 	var err error
 	if node, ok := tbl.Fields[fieldName]; ok {
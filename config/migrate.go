@@ -0,0 +1,592 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/toml"
+	"github.com/influxdata/toml/ast"
+)
+
+var (
+	// headerRe matches the header of a table or of an array of tables.
+	headerRe = regexp.MustCompile(`^\s*\[\[?\s*([\w.\-]+)\s*\]\]?`)
+
+	// keyRe matches the key of a key value line.
+	keyRe = regexp.MustCompile(`^(\s*)([\w\-]+|"[^"]*")(\s*=)`)
+)
+
+// MigrationNote is a change made migrating a configuration.  Manual is true
+// if the setting could not be converted and has to be reviewed.
+type MigrationNote struct {
+	Line    int
+	Plugin  string
+	Message string
+	Manual  bool
+}
+
+func (n MigrationNote) String() string {
+	return fmt.Sprintf("line %d: %s: %s", n.Line, n.Plugin, n.Message)
+}
+
+// inputMigrations rewrite the tables of deprecated input plugins.
+var inputMigrations = map[string]func(m *migration, tbl *ast.Table){
+	"tcp_listener":          migrateTCPListener,
+	"udp_listener":          migrateUDPListener,
+	"httpjson":              migrateHTTPJSON,
+	"kafka_consumer_legacy": migrateKafkaConsumerLegacy,
+	"snmp_legacy":           migrateSNMPLegacy,
+}
+
+// Migrate rewrites the deprecated plugins and options of a TOML configuration
+// into their replacements.  The configuration is edited line by line, so that
+// comments and formatting are kept except for the plugins that have to be
+// rewritten as a whole.  Settings without a replacement are commented out.
+// Environment variables are not replaced.
+func Migrate(data []byte) ([]byte, []MigrationNote, error) {
+	m, err := newMigration(trimBOM(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if tbl, ok := m.root.Fields["agent"].(*ast.Table); ok {
+		m.migrateAgent(tbl)
+	}
+
+	for _, section := range []string{"inputs", "outputs", "processors", "aggregators"} {
+		tbl, ok := m.root.Fields[section].(*ast.Table)
+		if !ok {
+			continue
+		}
+		for _, name := range sortedFields(tbl) {
+			for _, plugin := range tables(tbl.Fields[name]) {
+				path := section + "." + name
+				m.migrateTLS(plugin, path)
+				if migrate, ok := inputMigrations[name]; ok && section == "inputs" {
+					migrate(m, plugin)
+				}
+			}
+		}
+	}
+
+	result := m.result()
+	if _, err := toml.Parse(m.mask(result)); err != nil {
+		return nil, nil, fmt.Errorf("migrated configuration is invalid: %v", err)
+	}
+
+	sort.SliceStable(m.notes, func(i, j int) bool {
+		return m.notes[i].Line < m.notes[j].Line
+	})
+	return result, m.notes, nil
+}
+
+// migration is a configuration being migrated.  Lines are numbered from 1
+// like the lines of the tables.
+type migration struct {
+	lines []string
+	root  *ast.Table
+
+	// offsets are the rune offsets of the start of the lines of the masked
+	// configuration parsed into root.
+	offsets []int
+	// tokens maps the tokens replacing environment variables to them.
+	tokens map[string]string
+
+	replaced map[int]string
+	inserted map[int][]string
+	notes    []MigrationNote
+}
+
+func newMigration(data []byte) (*migration, error) {
+	m := &migration{
+		lines:    strings.SplitAfter(string(data), "\n"),
+		tokens:   make(map[string]string),
+		replaced: make(map[int]string),
+		inserted: make(map[int][]string),
+	}
+
+	// Environment variables are replaced by numbers for parsing, they are
+	// valid both as values and within strings.
+	masked := envVarRe.ReplaceAllStringFunc(string(data), func(ref string) string {
+		token := fmt.Sprintf("71462800%06d", len(m.tokens))
+		m.tokens[token] = ref
+		return token
+	})
+
+	root, err := toml.Parse([]byte(masked))
+	if err != nil {
+		return nil, err
+	}
+	m.root = root
+
+	m.offsets = []int{0}
+	for i, r := range []rune(masked) {
+		if r == '\n' {
+			m.offsets = append(m.offsets, i+1)
+		}
+	}
+	return m, nil
+}
+
+// mask replaces the environment variables of the migrated configuration by
+// the tokens of the original.
+func (m *migration) mask(data []byte) []byte {
+	s := string(data)
+	for token, ref := range m.tokens {
+		s = strings.Replace(s, ref, token, -1)
+	}
+	return []byte(s)
+}
+
+// unmask restores the environment variables in text taken from the tables.
+func (m *migration) unmask(s string) string {
+	for token, ref := range m.tokens {
+		s = strings.Replace(s, token, ref, -1)
+	}
+	return s
+}
+
+func (m *migration) result() []byte {
+	var b strings.Builder
+	for i := range m.lines {
+		b.WriteString(m.line(i + 1))
+		for _, line := range m.inserted[i+1] {
+			b.WriteString(line)
+		}
+	}
+	return []byte(b.String())
+}
+
+func (m *migration) line(n int) string {
+	if s, ok := m.replaced[n]; ok {
+		return s
+	}
+	return m.lines[n-1]
+}
+
+// lineOf returns the line of the rune offset in the configuration.
+func (m *migration) lineOf(offset int) int {
+	return sort.Search(len(m.offsets), func(i int) bool {
+		return m.offsets[i] > offset
+	})
+}
+
+// valueLines returns the first and the last line of a key value.
+func (m *migration) valueLines(kv *ast.KeyValue) (int, int) {
+	return m.lineOf(kv.Value.Pos()), m.lineOf(kv.Value.End() - 1)
+}
+
+// tableEnd returns the last line of the table at path and of its sub-tables,
+// trailing comments are left to the following table.
+func (m *migration) tableEnd(tbl *ast.Table, path string) int {
+	end := len(m.lines)
+	for n := tbl.Line + 1; n <= len(m.lines); n++ {
+		match := headerRe.FindStringSubmatch(m.lines[n-1])
+		if match != nil && !strings.HasPrefix(match[1], path+".") {
+			end = n - 1
+			break
+		}
+	}
+	for end > tbl.Line {
+		line := strings.TrimSpace(m.lines[end-1])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+func (m *migration) note(line int, plugin string, manual bool, format string, a ...interface{}) {
+	m.notes = append(m.notes, MigrationNote{
+		Line:    line,
+		Plugin:  plugin,
+		Message: fmt.Sprintf(format, a...),
+		Manual:  manual,
+	})
+}
+
+// indent returns the indentation of the keys of the table.
+func (m *migration) indent(tbl *ast.Table) string {
+	for _, name := range sortedFields(tbl) {
+		if kv, ok := tbl.Fields[name].(*ast.KeyValue); ok {
+			first, _ := m.valueLines(kv)
+			line := m.lines[first-1]
+			return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+	}
+	return "  "
+}
+
+// insert adds a key value line after the header of the table.
+func (m *migration) insert(tbl *ast.Table, key, value string) {
+	line := m.indent(tbl) + key + " = " + value + "\n"
+	m.inserted[tbl.Line] = append(m.inserted[tbl.Line], line)
+}
+
+// renamePlugin renames the headers of the plugin table and its sub-tables.
+func (m *migration) renamePlugin(tbl *ast.Table, from, to string) {
+	var rename func(t *ast.Table)
+	rename = func(t *ast.Table) {
+		if t.Line > 0 && t.Line <= len(m.lines) {
+			line := m.line(t.Line)
+			if match := headerRe.FindStringSubmatchIndex(line); match != nil {
+				name := line[match[2]:match[3]]
+				if name == from || strings.HasPrefix(name, from+".") {
+					m.replaced[t.Line] = line[:match[2]] + to + line[match[2]+len(from):]
+				}
+			}
+		}
+		for _, name := range sortedFields(t) {
+			for _, sub := range tables(t.Fields[name]) {
+				rename(sub)
+			}
+		}
+	}
+	rename(tbl)
+	m.note(tbl.Line, from, false, "replaced by %s", to)
+}
+
+// renameKey renames the key of the table, if the new key is set already the
+// old key is commented out instead.
+func (m *migration) renameKey(tbl *ast.Table, plugin, from, to string) {
+	kv, ok := tbl.Fields[from].(*ast.KeyValue)
+	if !ok {
+		return
+	}
+	first, _ := m.valueLines(kv)
+	if _, ok := tbl.Fields[to]; ok {
+		m.comment(first, first)
+		m.note(first, plugin, false, "%s is replaced by %s, which is set already", from, to)
+		return
+	}
+
+	line := m.line(first)
+	match := keyRe.FindStringSubmatchIndex(line)
+	if match == nil {
+		m.note(first, plugin, true, "%s could not be renamed to %s", from, to)
+		return
+	}
+	m.replaced[first] = line[:match[4]] + to + line[match[5]:]
+	m.note(first, plugin, false, "%s renamed to %s", from, to)
+}
+
+// removeKey comments out the key of the table.
+func (m *migration) removeKey(tbl *ast.Table, plugin, key string, manual bool, reason string) {
+	kv, ok := tbl.Fields[key].(*ast.KeyValue)
+	if !ok {
+		return
+	}
+	first, last := m.valueLines(kv)
+	m.comment(first, last)
+	m.note(first, plugin, manual, "%s commented out, %s", key, reason)
+}
+
+// removeTable comments out the table and its sub-tables.
+func (m *migration) removeTable(tbl *ast.Table, path, plugin string, manual bool, reason string) {
+	m.comment(tbl.Line, m.tableEnd(tbl, path))
+	m.note(tbl.Line, plugin, manual, "%s commented out, %s", tbl.Name, reason)
+}
+
+func (m *migration) comment(first, last int) {
+	for n := first; n <= last; n++ {
+		line := m.line(n)
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed == "\n" {
+			continue
+		}
+		m.replaced[n] = line[:len(line)-len(trimmed)] + "# " + trimmed
+	}
+}
+
+// stringValue returns the value of a string key of the table.
+func (m *migration) stringValue(tbl *ast.Table, key string) (string, bool) {
+	kv, ok := tbl.Fields[key].(*ast.KeyValue)
+	if !ok {
+		return "", false
+	}
+	s, ok := kv.Value.(*ast.String)
+	if !ok {
+		return "", false
+	}
+	return m.unmask(s.Value), true
+}
+
+// source returns the TOML source of the value of the key.
+func (m *migration) source(tbl *ast.Table, key string) (string, bool) {
+	kv, ok := tbl.Fields[key].(*ast.KeyValue)
+	if !ok {
+		return "", false
+	}
+	return m.unmask(kv.Value.Source()), true
+}
+
+func (m *migration) migrateAgent(tbl *ast.Table) {
+	for _, key := range []string{"flush_buffer_when_full", "FlushBufferWhenFull", "utc", "UTC"} {
+		m.removeKey(tbl, "agent", key, false, "it has no effect")
+	}
+}
+
+// migrateTLS renames the ssl_* options of the plugin to tls_*.
+func (m *migration) migrateTLS(tbl *ast.Table, plugin string) {
+	for _, suffix := range []string{"ca", "cert", "key"} {
+		m.renameKey(tbl, plugin, "ssl_"+suffix, "tls_"+suffix)
+	}
+}
+
+// prefixAddress adds the scheme to the service address of a listener, the
+// default address is set if there is none.
+func (m *migration) prefixAddress(tbl *ast.Table, plugin, scheme, address string) {
+	kv, ok := tbl.Fields["service_address"].(*ast.KeyValue)
+	if !ok {
+		m.insert(tbl, "service_address", strconv.Quote(scheme+"://"+address))
+		return
+	}
+	if s, ok := kv.Value.(*ast.String); ok && strings.Contains(s.Value, "://") {
+		return
+	}
+
+	first, _ := m.valueLines(kv)
+	line := m.line(first)
+	eq := strings.Index(line, "=")
+	quote := strings.IndexAny(line[eq+1:], `"'`)
+	if eq < 0 || quote < 0 {
+		m.note(first, plugin, true, "service_address must start with %s://", scheme)
+		return
+	}
+	i := eq + 1 + quote + 1
+	m.replaced[first] = line[:i] + scheme + "://" + line[i:]
+}
+
+func migrateTCPListener(m *migration, tbl *ast.Table) {
+	const plugin = "inputs.tcp_listener"
+	m.renamePlugin(tbl, plugin, "inputs.socket_listener")
+	m.prefixAddress(tbl, plugin, "tcp", ":8094")
+	m.renameKey(tbl, plugin, "max_tcp_connections", "max_connections")
+	m.removeKey(tbl, plugin, "allowed_pending_messages", true, "it is not supported by socket_listener")
+}
+
+func migrateUDPListener(m *migration, tbl *ast.Table) {
+	const plugin = "inputs.udp_listener"
+	m.renamePlugin(tbl, plugin, "inputs.socket_listener")
+	m.prefixAddress(tbl, plugin, "udp", ":8092")
+	m.renameKey(tbl, plugin, "udp_buffer_size", "read_buffer_size")
+	m.removeKey(tbl, plugin, "udp_packet_size", false, "it has no effect")
+	m.removeKey(tbl, plugin, "allowed_pending_messages", true, "it is not supported by socket_listener")
+}
+
+func migrateHTTPJSON(m *migration, tbl *ast.Table) {
+	const plugin = "inputs.httpjson"
+	m.renamePlugin(tbl, plugin, "inputs.http")
+	m.renameKey(tbl, plugin, "servers", "urls")
+	m.renameKey(tbl, plugin, "response_timeout", "timeout")
+	if _, ok := tbl.Fields["data_format"]; !ok {
+		m.insert(tbl, "data_format", `"json"`)
+	}
+
+	// httpjson names the metrics httpjson_<name>.
+	name, ok := m.stringValue(tbl, "name")
+	if ok {
+		m.removeKey(tbl, plugin, "name", false, "replaced by name_override")
+	}
+	if _, ok := tbl.Fields["name_override"]; !ok {
+		measurement := "httpjson"
+		if name != "" {
+			measurement += "_" + name
+		}
+		m.insert(tbl, "name_override", strconv.Quote(measurement))
+	}
+
+	if params, ok := tbl.Fields["parameters"].(*ast.Table); ok {
+		m.removeTable(params, "inputs.httpjson.parameters", plugin, true,
+			"add the parameters to the query of the urls or to the body")
+	}
+	m.note(tbl.Line, plugin, false, "metrics are tagged with url instead of server")
+}
+
+func migrateKafkaConsumerLegacy(m *migration, tbl *ast.Table) {
+	const plugin = "inputs.kafka_consumer_legacy"
+	m.renamePlugin(tbl, plugin, "inputs.kafka_consumer")
+	for _, key := range []string{"zookeeper_peers", "zookeeper_chroot"} {
+		m.removeKey(tbl, plugin, key, true, "kafka_consumer connects to the brokers, set brokers instead")
+	}
+	for _, key := range []string{"point_buffer", "metric_buffer"} {
+		m.removeKey(tbl, plugin, key, false, "it has no effect")
+	}
+}
+
+// snmpLegacyKeys are the options of snmp_legacy converted into the agents,
+// fields and tables of snmp.
+var snmpLegacyKeys = map[string]bool{
+	"snmptranslate_file": true,
+	"host":               true,
+	"get":                true,
+	"bulk":               true,
+	"table":              true,
+	"subtable":           true,
+}
+
+// migrateSNMPLegacy replaces the snmp_legacy plugin by an snmp plugin per host
+// collecting the same oids.  The other settings of the plugin are copied to
+// each of them.
+func migrateSNMPLegacy(m *migration, tbl *ast.Table) {
+	const plugin = "inputs.snmp_legacy"
+	hosts := tables(tbl.Fields["host"])
+	if len(hosts) == 0 {
+		m.note(tbl.Line, plugin, true, "no host to convert")
+		return
+	}
+
+	named := func(key string) map[string]*ast.Table {
+		result := make(map[string]*ast.Table)
+		for _, t := range tables(tbl.Fields[key]) {
+			if name, ok := m.stringValue(t, "name"); ok {
+				result[name] = t
+			}
+		}
+		return result
+	}
+	gets, bulks, tbls := named("get"), named("bulk"), named("table")
+
+	// Settings common to all plugins are copied as they are, the keys before
+	// the tables.
+	end := m.tableEnd(tbl, plugin)
+	var common, commonTables []string
+	for _, name := range sortedFields(tbl) {
+		if snmpLegacyKeys[name] {
+			continue
+		}
+		if kv, ok := tbl.Fields[name].(*ast.KeyValue); ok {
+			first, last := m.valueLines(kv)
+			common = append(common, m.lines[first-1:last]...)
+			continue
+		}
+		for _, t := range tables(tbl.Fields[name]) {
+			for n := t.Line; n <= m.tableEnd(t, plugin+"."+name); n++ {
+				line := m.lines[n-1]
+				if n == t.Line {
+					line = strings.Replace(line, plugin, "inputs.snmp", 1)
+				}
+				commonTables = append(commonTables, line)
+			}
+		}
+	}
+	common = append(common, commonTables...)
+
+	if _, ok := tbl.Fields["snmptranslate_file"]; ok {
+		m.note(tbl.Line, plugin, true, "snmptranslate_file is not supported, snmp translates oids with the installed MIBs")
+	}
+	if len(tables(tbl.Fields["subtable"])) > 0 {
+		m.note(tbl.Line, plugin, true, "subtables are not supported, add the columns as fields of the snmp tables")
+	}
+
+	var b strings.Builder
+	for i, host := range hosts {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("[[inputs.snmp]]\n")
+		if address, ok := m.source(host, "address"); ok {
+			fmt.Fprintf(&b, "  agents = [%s]\n", address)
+		}
+		for _, key := range []string{"community", "version", "retries"} {
+			if value, ok := m.source(host, key); ok {
+				fmt.Fprintf(&b, "  %s = %s\n", key, value)
+			}
+		}
+		if kv, ok := host.Fields["timeout"].(*ast.KeyValue); ok {
+			if timeout, err := strconv.ParseFloat(kv.Value.Source(), 64); err == nil {
+				fmt.Fprintf(&b, "  timeout = \"%ss\"\n", strconv.FormatFloat(timeout, 'f', -1, 64))
+			} else {
+				m.note(host.Line, plugin, true, "timeout %s could not be converted", m.unmask(kv.Value.Source()))
+			}
+		}
+		for _, line := range common {
+			b.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				b.WriteString("\n")
+			}
+		}
+
+		if kv, ok := host.Fields["get_oids"].(*ast.KeyValue); ok {
+			if array, ok := kv.Value.(*ast.Array); ok {
+				for _, oid := range array.Value {
+					fmt.Fprintf(&b, "  [[inputs.snmp.field]]\n    oid = %s\n", m.unmask(oid.Source()))
+				}
+			}
+		}
+
+		var collect []string
+		if kv, ok := host.Fields["collect"].(*ast.KeyValue); ok {
+			if array, ok := kv.Value.(*ast.Array); ok {
+				for _, v := range array.Value {
+					if s, ok := v.(*ast.String); ok {
+						collect = append(collect, m.unmask(s.Value))
+					}
+				}
+			}
+		}
+		for _, t := range tables(host.Fields["table"]) {
+			name, _ := m.stringValue(t, "name")
+			if !sliceContains(name, collect) {
+				collect = append(collect, name)
+			}
+			if _, ok := t.Fields["include_instances"]; ok {
+				m.note(t.Line, plugin, true, "include_instances of table %q is not supported, use tagpass", name)
+			}
+			if _, ok := t.Fields["exclude_instances"]; ok {
+				m.note(t.Line, plugin, true, "exclude_instances of table %q is not supported, use tagdrop", name)
+			}
+		}
+
+		for _, name := range collect {
+			switch {
+			case gets[name] != nil:
+				oid, _ := m.source(gets[name], "oid")
+				fmt.Fprintf(&b, "  [[inputs.snmp.field]]\n    name = %s\n    oid = %s\n", strconv.Quote(name), oid)
+			case bulks[name] != nil:
+				oid, _ := m.source(bulks[name], "oid")
+				fmt.Fprintf(&b, "  [[inputs.snmp.table]]\n    name = %s\n    oid = %s\n", strconv.Quote(name), oid)
+				m.note(bulks[name].Line, plugin, true, "bulk %q converted to a table, check its fields", name)
+			case tbls[name] != nil:
+				oid, _ := m.source(tbls[name], "oid")
+				fmt.Fprintf(&b, "  [[inputs.snmp.table]]\n    name = %s\n    oid = %s\n", strconv.Quote(name), oid)
+				if _, ok := tbls[name].Fields["mapping_table"]; ok {
+					m.note(tbls[name].Line, plugin, true, "mapping_table of table %q is not supported", name)
+				}
+			default:
+				m.note(host.Line, plugin, true, "%q is not defined", name)
+			}
+		}
+	}
+
+	for n := tbl.Line; n <= end; n++ {
+		m.replaced[n] = ""
+	}
+	m.replaced[tbl.Line] = b.String()
+	m.note(tbl.Line, plugin, false, "replaced by %d inputs.snmp, one per host", len(hosts))
+}
+
+// tables returns the tables of a table or an array of tables field.
+func tables(field interface{}) []*ast.Table {
+	switch field := field.(type) {
+	case *ast.Table:
+		return []*ast.Table{field}
+	case []*ast.Table:
+		return field
+	default:
+		return nil
+	}
+}
+
+func sortedFields(tbl *ast.Table) []string {
+	names := make([]string, 0, len(tbl.Fields))
+	for name := range tbl.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		notes    []string
+	}{
+		{
+			name: "agent",
+			input: `[agent]
+  interval = "10s"
+  # Deprecated
+  flush_buffer_when_full = true
+  utc = true
+`,
+			expected: `[agent]
+  interval = "10s"
+  # Deprecated
+  # flush_buffer_when_full = true
+  # utc = true
+`,
+			notes: []string{
+				"line 4: agent: flush_buffer_when_full commented out, it has no effect",
+				"line 5: agent: utc commented out, it has no effect",
+			},
+		},
+		{
+			name: "tcp_listener",
+			input: `# Listen for TCP
+[[inputs.tcp_listener]]
+  ## Address to listen on
+  service_address = ":8094" # all interfaces
+  allowed_pending_messages = 10000
+  max_tcp_connections = 250
+  data_format = "influx"
+  [inputs.tcp_listener.tags]
+    source = "tcp"
+`,
+			expected: `# Listen for TCP
+[[inputs.socket_listener]]
+  ## Address to listen on
+  service_address = "tcp://:8094" # all interfaces
+  # allowed_pending_messages = 10000
+  max_connections = 250
+  data_format = "influx"
+  [inputs.socket_listener.tags]
+    source = "tcp"
+`,
+			notes: []string{
+				"line 2: inputs.tcp_listener: replaced by inputs.socket_listener",
+				"line 5: inputs.tcp_listener: allowed_pending_messages commented out, it is not supported by socket_listener",
+				"line 6: inputs.tcp_listener: max_tcp_connections renamed to max_connections",
+			},
+		},
+		{
+			name: "udp_listener",
+			input: `[[inputs.udp_listener]]
+  udp_packet_size = 1500
+  udp_buffer_size = 16777216
+`,
+			expected: `[[inputs.socket_listener]]
+  service_address = "udp://:8092"
+  # udp_packet_size = 1500
+  read_buffer_size = 16777216
+`,
+			notes: []string{
+				"line 1: inputs.udp_listener: replaced by inputs.socket_listener",
+				"line 2: inputs.udp_listener: udp_packet_size commented out, it has no effect",
+				"line 3: inputs.udp_listener: udp_buffer_size renamed to read_buffer_size",
+			},
+		},
+		{
+			name: "httpjson",
+			input: `[[inputs.httpjson]]
+  name = "webserver_stats"
+  servers = [
+    "http://localhost:9999/stats/",
+  ]
+  response_timeout = "5s"
+  method = "GET"
+  ssl_ca = "/etc/telegraf/ca.pem"
+
+  [inputs.httpjson.parameters]
+    event_type = "cpu_spike"
+
+  [inputs.httpjson.headers]
+    X-Auth-Token = "${TOKEN}"
+
+# Next plugin
+[[inputs.cpu]]
+`,
+			expected: `[[inputs.http]]
+  data_format = "json"
+  name_override = "httpjson_webserver_stats"
+  # name = "webserver_stats"
+  urls = [
+    "http://localhost:9999/stats/",
+  ]
+  timeout = "5s"
+  method = "GET"
+  tls_ca = "/etc/telegraf/ca.pem"
+
+  # [inputs.http.parameters]
+    # event_type = "cpu_spike"
+
+  [inputs.http.headers]
+    X-Auth-Token = "${TOKEN}"
+
+# Next plugin
+[[inputs.cpu]]
+`,
+			notes: []string{
+				"line 1: inputs.httpjson: replaced by inputs.http",
+				"line 1: inputs.httpjson: metrics are tagged with url instead of server",
+				"line 2: inputs.httpjson: name commented out, replaced by name_override",
+				"line 3: inputs.httpjson: servers renamed to urls",
+				"line 6: inputs.httpjson: response_timeout renamed to timeout",
+				"line 8: inputs.httpjson: ssl_ca renamed to tls_ca",
+				"line 10: inputs.httpjson: parameters commented out, add the parameters to the query of the urls or to the body",
+			},
+		},
+		{
+			name: "kafka_consumer_legacy",
+			input: `[[inputs.kafka_consumer_legacy]]
+  topics = ["telegraf"]
+  zookeeper_peers = ["${ZOOKEEPER}"]
+  offset = "oldest"
+`,
+			expected: `[[inputs.kafka_consumer]]
+  topics = ["telegraf"]
+  # zookeeper_peers = ["${ZOOKEEPER}"]
+  offset = "oldest"
+`,
+			notes: []string{
+				"line 1: inputs.kafka_consumer_legacy: replaced by inputs.kafka_consumer",
+				"line 3: inputs.kafka_consumer_legacy: zookeeper_peers commented out, kafka_consumer connects to the brokers, set brokers instead",
+			},
+		},
+		{
+			name: "snmp_legacy",
+			input: `[[inputs.snmp_legacy]]
+  interval = "60s"
+  [[inputs.snmp_legacy.host]]
+    address = "192.168.2.2:161"
+    community = "${COMMUNITY}"
+    version = 2
+    timeout = 2.5
+    retries = 2
+    collect = ["ifnumber", "iftable"]
+  [[inputs.snmp_legacy.get]]
+    name = "ifnumber"
+    oid = "ifNumber.0"
+  [[inputs.snmp_legacy.table]]
+    name = "iftable"
+    oid = ".1.3.6.1.2.1.31.1.1.1"
+  [inputs.snmp_legacy.tags]
+    site = "a"
+
+[[outputs.file]]
+  ssl_cert = "/etc/telegraf/cert.pem"
+`,
+			expected: `[[inputs.snmp]]
+  agents = ["192.168.2.2:161"]
+  community = "${COMMUNITY}"
+  version = 2
+  retries = 2
+  timeout = "2.5s"
+  interval = "60s"
+  [inputs.snmp.tags]
+    site = "a"
+  [[inputs.snmp.field]]
+    name = "ifnumber"
+    oid = "ifNumber.0"
+  [[inputs.snmp.table]]
+    name = "iftable"
+    oid = ".1.3.6.1.2.1.31.1.1.1"
+
+[[outputs.file]]
+  tls_cert = "/etc/telegraf/cert.pem"
+`,
+			notes: []string{
+				"line 1: inputs.snmp_legacy: replaced by 1 inputs.snmp, one per host",
+				"line 20: outputs.file: ssl_cert renamed to tls_cert",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, notes, err := Migrate([]byte(tt.input))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(actual))
+
+			var messages []string
+			for _, note := range notes {
+				messages = append(messages, note.String())
+			}
+			require.Equal(t, tt.notes, messages)
+		})
+	}
+}
+
+func TestMigrateManual(t *testing.T) {
+	_, notes, err := Migrate([]byte(`[[inputs.snmp_legacy]]
+  snmptranslate_file = "/tmp/oids.txt"
+  [[inputs.snmp_legacy.host]]
+    address = "192.168.2.2:161"
+    collect = ["mybulk", "missing"]
+  [[inputs.snmp_legacy.bulk]]
+    name = "mybulk"
+    oid = ".1.3.6.1.2.1.1"
+`))
+	require.NoError(t, err)
+
+	var manual []string
+	for _, note := range notes {
+		if note.Manual {
+			manual = append(manual, note.String())
+		}
+	}
+	require.Equal(t, []string{
+		"line 1: inputs.snmp_legacy: snmptranslate_file is not supported, snmp translates oids with the installed MIBs",
+		`line 3: inputs.snmp_legacy: "missing" is not defined`,
+		`line 6: inputs.snmp_legacy: bulk "mybulk" converted to a table, check its fields`,
+	}, manual)
+}
+
+func TestMigrateInvalid(t *testing.T) {
+	_, _, err := Migrate([]byte("[[inputs.cpu]\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+)
+
+// RemoteConfig is a configuration file loaded from an URL.  ETag and
+// LastModified identify the version last fetched, so that polling only
+// downloads the file again once it changed.
+type RemoteConfig struct {
+	URL          string
+	ETag         string
+	LastModified string
+
+	sum [sha256.Size]byte
+}
+
+// fetch downloads the configuration file.  If it was fetched before, the
+// request is conditional and modified is false when the file is unchanged.
+// The version of the file is updated.
+func (r *RemoteConfig) fetch(ctx context.Context) (data []byte, modified bool, err error) {
+	data, sum, resp, err := r.get(ctx)
+	if err != nil || data == nil {
+		return nil, false, err
+	}
+
+	// Servers not supporting conditional requests send the file every time.
+	modified = sum != r.sum
+	r.sum = sum
+	r.ETag = resp.Header.Get("ETag")
+	r.LastModified = resp.Header.Get("Last-Modified")
+	return data, modified, nil
+}
+
+// changed returns true if the file changed since the version last fetched,
+// the version is not updated.
+func (r *RemoteConfig) changed(ctx context.Context) (bool, error) {
+	data, sum, _, err := r.get(ctx)
+	if err != nil || data == nil {
+		return false, err
+	}
+	return sum != r.sum, nil
+}
+
+// get downloads the configuration file unless it is unchanged since the
+// version last fetched, the data is nil then.
+func (r *RemoteConfig) get(ctx context.Context) ([]byte, [sha256.Size]byte, *http.Response, error) {
+	var sum [sha256.Size]byte
+	req, err := http.NewRequest("GET", r.URL, nil)
+	if err != nil {
+		return nil, sum, nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if v, exists := os.LookupEnv("INFLUX_TOKEN"); exists {
+		req.Header.Add("Authorization", "Token "+v)
+	}
+	req.Header.Add("Accept", "application/toml")
+	req.Header.Set("User-Agent", internal.ProductToken())
+	if r.ETag != "" {
+		req.Header.Set("If-None-Match", r.ETag)
+	}
+	if r.LastModified != "" {
+		req.Header.Set("If-Modified-Since", r.LastModified)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, sum, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && (r.ETag != "" || r.LastModified != "") {
+		return nil, sum, resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, sum, nil, fmt.Errorf("failed to retrieve remote config: %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, sum, nil, err
+	}
+	return data, sha256.Sum256(data), resp, nil
+}
+
+// WatchRemote polls the configuration files loaded from URLs every interval
+// until the context is done or any of them changed, reload is called once and
+// the watch ends then.  The versions of the files are not updated, so that the
+// watch of the same configuration detects the change again if the reload
+// failed.  The watch is started again with the reloaded configuration.
+func (c *Config) WatchRemote(ctx context.Context, interval time.Duration, reload func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+		for _, remote := range c.Remotes {
+			pollCtx, cancel := context.WithTimeout(ctx, interval)
+			modified, err := remote.changed(pollCtx)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("W! [config] Error polling configuration %s: %v", remote.URL, err)
+				continue
+			}
+			if modified {
+				log.Printf("I! [config] Configuration %s changed", remote.URL)
+				changed = true
+			}
+		}
+		if changed {
+			reload()
+			return
+		}
+	}
+}
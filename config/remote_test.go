@@ -0,0 +1,150 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/plugins/inputs/memcached"
+	"github.com/stretchr/testify/require"
+)
+
+type configServer struct {
+	sync.Mutex
+	config   string
+	etag     string
+	requests int
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	w.Write([]byte(s.config))
+}
+
+func (s *configServer) set(config, etag string) {
+	s.Lock()
+	defer s.Unlock()
+	s.config = config
+	s.etag = etag
+}
+
+func TestRemoteConfig_Fetch(t *testing.T) {
+	for _, etag := range []string{`"v1"`, ""} {
+		srv := &configServer{}
+		srv.set("[agent]\n", etag)
+		ts := httptest.NewServer(srv)
+
+		remote := &RemoteConfig{URL: ts.URL}
+		data, modified, err := remote.fetch(context.Background())
+		require.NoError(t, err)
+		require.True(t, modified)
+		require.Equal(t, "[agent]\n", string(data))
+		require.Equal(t, etag, remote.ETag)
+
+		_, modified, err = remote.fetch(context.Background())
+		require.NoError(t, err)
+		require.False(t, modified)
+
+		srv.set("[agent]\n  debug = true\n", etag+"2")
+		data, modified, err = remote.fetch(context.Background())
+		require.NoError(t, err)
+		require.True(t, modified)
+		require.Equal(t, "[agent]\n  debug = true\n", string(data))
+
+		ts.Close()
+	}
+}
+
+func TestConfig_WatchRemote(t *testing.T) {
+	srv := &configServer{}
+	srv.set("[[inputs.memcached]]\n", `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(ts.URL))
+	require.Len(t, c.Remotes, 1)
+	require.Equal(t, `"v1"`, c.Remotes[0].ETag)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan struct{}, 2)
+	done := make(chan struct{})
+	watch := func() {
+		go func() {
+			c.WatchRemote(ctx, 10*time.Millisecond, func() {
+				reloads <- struct{}{}
+			})
+			done <- struct{}{}
+		}()
+	}
+	watch()
+
+	// Unchanged configuration is not reloaded.
+	require.Eventually(t, func() bool {
+		srv.Lock()
+		defer srv.Unlock()
+		return srv.requests >= 3
+	}, time.Second, 5*time.Millisecond)
+	require.Len(t, reloads, 0)
+
+	// The watch ends after requesting a reload.
+	srv.set("[[inputs.memcached]]\n  servers = [\"localhost\"]\n", `"v2"`)
+	for _, ch := range []chan struct{}{reloads, done} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("configuration not reloaded")
+		}
+	}
+
+	// The version is kept, so that the change is detected again if the
+	// reload failed.
+	require.Equal(t, `"v1"`, c.Remotes[0].ETag)
+	watch()
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatal("failed reload not retried")
+	}
+	<-done
+}
+
+func TestConfig_RemoteSubstitution(t *testing.T) {
+	require.NoError(t, os.Setenv("TEST_SERVER", "localhost"))
+	defer os.Unsetenv("TEST_SERVER")
+	os.Unsetenv("TEST_UNSET")
+
+	// Environment variables are replaced in remote configurations.
+	srv := &configServer{}
+	srv.set("[[inputs.memcached]]\n  servers = [\"$TEST_SERVER\", \"${TEST_SERVER}\", \"${TEST_UNSET:-default}\", \"${TEST_SERVER:?}\"]\n", "")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(ts.URL))
+	require.Len(t, c.Inputs, 1)
+	m, ok := c.Inputs[0].Input.(*memcached.Memcached)
+	require.True(t, ok)
+	require.Equal(t, []string{"localhost", "localhost", "default", "localhost"}, m.Servers)
+
+	// Files of the host cannot be read.
+	srv.set("[[inputs.memcached]]\n  servers = [\"${file:./testdata/secrets/url}\"]\n", "")
+	c = NewConfig()
+	err := c.LoadConfig(ts.URL)
+	require.EqualError(t, err, "Error loading config file "+ts.URL+": Error parsing data: "+
+		`line 2: file reference "${file:./testdata/secrets/url}" is not allowed in configurations loaded from URLs`)
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/aggregators"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/processors"
+	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/influxdata/toml"
+)
+
+// Schema describes the options of all registered plugins and data formats.
+type Schema struct {
+	Inputs      []PluginSchema   `json:"inputs"`
+	Outputs     []PluginSchema   `json:"outputs"`
+	Processors  []PluginSchema   `json:"processors"`
+	Aggregators []PluginSchema   `json:"aggregators"`
+	Parsers     DataFormatSchema `json:"parsers"`
+	Serializers DataFormatSchema `json:"serializers"`
+}
+
+// PluginSchema describes a plugin.  Parser and Serializer are true if the
+// plugin takes the options of a data format.
+type PluginSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parser      bool           `json:"parser,omitempty"`
+	Serializer  bool           `json:"serializer,omitempty"`
+	Options     []OptionSchema `json:"options"`
+}
+
+// DataFormatSchema describes the options of the parsers or serializers, all
+// data formats take the same options.
+type DataFormatSchema struct {
+	DataFormats []string       `json:"data_formats"`
+	Options     []OptionSchema `json:"options"`
+}
+
+// OptionSchema describes an option of a plugin.  Type is one of boolean,
+// integer, float, string, duration, size, array, table or array_of_tables.
+// Items is the type of the values of arrays and tables, the options of tables
+// of a known structure and of arrays of tables are in Options.
+type OptionSchema struct {
+	Name        string         `json:"name"`
+	Key         string         `json:"key"`
+	Type        string         `json:"type"`
+	Items       string         `json:"items,omitempty"`
+	Default     interface{}    `json:"default,omitempty"`
+	Enum        []string       `json:"enum,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Options     []OptionSchema `json:"options,omitempty"`
+}
+
+// telegrafPkg is the package prefix of the structures described as tables,
+// structures of other packages are not meant to be configured.
+const telegrafPkg = "github.com/influxdata/telegraf"
+
+var (
+	durationTypes = []reflect.Type{
+		reflect.TypeOf(internal.Duration{}),
+		reflect.TypeOf(Duration(0)),
+		reflect.TypeOf(time.Duration(0)),
+	}
+	sizeTypes = []reflect.Type{
+		reflect.TypeOf(internal.Size{}),
+		reflect.TypeOf(Size(0)),
+	}
+
+	// sampleKeyRe matches the options of the sample configurations, set or
+	// commented out.
+	sampleKeyRe = regexp.MustCompile(`^\s*#?\s*([\w\-]+)\s*=`)
+)
+
+// PluginSchemas returns the schema of the plugins registered in the inputs,
+// outputs, processors and aggregators, and of the parser and serializer data
+// formats.  Options are found by reflection on the plugin structures, the
+// defaults are the values set by the plugin creators and the descriptions are
+// the comments of the sample configurations.
+func PluginSchemas() *Schema {
+	schema := &Schema{}
+	for name, creator := range inputs.Inputs {
+		schema.Inputs = append(schema.Inputs, pluginSchema(name, creator()))
+	}
+	for name, creator := range outputs.Outputs {
+		schema.Outputs = append(schema.Outputs, pluginSchema(name, creator()))
+	}
+	for name, creator := range processors.Processors {
+		var plugin telegraf.PluginDescriber = creator()
+		if p, ok := plugin.(unwrappable); ok {
+			plugin = p.Unwrap()
+		}
+		schema.Processors = append(schema.Processors, pluginSchema(name, plugin))
+	}
+	for name, creator := range aggregators.Aggregators {
+		schema.Aggregators = append(schema.Aggregators, pluginSchema(name, creator()))
+	}
+	for _, plugins := range [][]PluginSchema{schema.Inputs, schema.Outputs, schema.Processors, schema.Aggregators} {
+		sort.Slice(plugins, func(i, j int) bool {
+			return plugins[i].Name < plugins[j].Name
+		})
+	}
+
+	schema.Parsers = dataFormatSchema(&parsers.Config{DataFormat: "influx"}, parsers.DataFormats)
+	schema.Serializers = dataFormatSchema(&serializers.Config{DataFormat: "influx"}, serializers.DataFormats)
+	return schema
+}
+
+func pluginSchema(name string, plugin telegraf.PluginDescriber) PluginSchema {
+	_, parser := plugin.(parsers.ParserInput)
+	_, parserFunc := plugin.(parsers.ParserFuncInput)
+	_, serializer := plugin.(serializers.SerializerOutput)
+	return PluginSchema{
+		Name:        name,
+		Description: plugin.Description(),
+		Parser:      parser || parserFunc,
+		Serializer:  serializer,
+		Options:     optionSchemas(reflect.ValueOf(plugin), sampleDescriptions(plugin.SampleConfig())),
+	}
+}
+
+func dataFormatSchema(config interface{}, formats []string) DataFormatSchema {
+	options := optionSchemas(reflect.ValueOf(config), nil)
+	for i := range options {
+		if options[i].Key == "data_format" {
+			options[i].Enum = formats
+		}
+	}
+	return DataFormatSchema{DataFormats: formats, Options: options}
+}
+
+// sampleDescriptions returns the comments preceding the options at the top
+// level of the sample configuration.
+func sampleDescriptions(sample string) map[string]string {
+	descriptions := make(map[string]string)
+	var comment []string
+	for _, line := range strings.Split(sample, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			// Options of sub-tables are not described.
+			return descriptions
+		case strings.HasPrefix(trimmed, "##"):
+			comment = append(comment, strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			continue
+		}
+
+		if match := sampleKeyRe.FindStringSubmatch(line); match != nil && len(comment) > 0 {
+			if _, ok := descriptions[match[1]]; !ok {
+				descriptions[match[1]] = strings.Join(comment, " ")
+			}
+		}
+		comment = nil
+	}
+	return descriptions
+}
+
+// optionSchemas returns the options of the fields of the structure, the
+// options of embedded structures are options of the structure.
+func optionSchemas(v reflect.Value, descriptions map[string]string) []OptionSchema {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return []OptionSchema{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return []OptionSchema{}
+	}
+
+	options := []OptionSchema{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("toml")
+		if key == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if field.Anonymous && key == "" {
+			typ := field.Type
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			if typ.Kind() != reflect.Struct || !strings.HasPrefix(typ.PkgPath(), telegrafPkg) {
+				continue
+			}
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr && fv.IsNil() {
+				fv = reflect.New(typ)
+			}
+			options = append(options, optionSchemas(fv, descriptions)...)
+			continue
+		}
+
+		option, ok := optionSchema(field.Type, v.Field(i))
+		if !ok {
+			continue
+		}
+		if key == "" {
+			key = toml.DefaultConfig.FieldToKey(t, field.Name)
+		}
+		option.Name = field.Name
+		option.Key = key
+		option.Description = descriptions[key]
+		options = append(options, option)
+	}
+	return options
+}
+
+// optionSchema returns the type and the default of an option, it returns false
+// if the type cannot be configured.
+func optionSchema(typ reflect.Type, v reflect.Value) (OptionSchema, bool) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		if v.IsValid() && !v.IsNil() {
+			v = v.Elem()
+		} else {
+			v = reflect.Value{}
+		}
+	}
+	hasDefault := v.IsValid() && !v.IsZero()
+
+	switch {
+	case isType(typ, durationTypes):
+		option := OptionSchema{Type: "duration"}
+		if hasDefault {
+			if d, ok := v.Interface().(internal.Duration); ok {
+				option.Default = d.Duration.String()
+			} else {
+				option.Default = time.Duration(v.Int()).String()
+			}
+		}
+		return option, true
+	case isType(typ, sizeTypes):
+		option := OptionSchema{Type: "size"}
+		if hasDefault {
+			if s, ok := v.Interface().(internal.Size); ok {
+				option.Default = s.Size
+			} else {
+				option.Default = v.Int()
+			}
+		}
+		return option, true
+	}
+
+	option := OptionSchema{}
+	switch typ.Kind() {
+	case reflect.Bool:
+		option.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		option.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		option.Type = "float"
+	case reflect.String:
+		option.Type = "string"
+	case reflect.Slice, reflect.Array:
+		elem := typ.Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct && !isType(elem, durationTypes) && !isType(elem, sizeTypes) {
+			if !strings.HasPrefix(elem.PkgPath(), telegrafPkg) {
+				return option, false
+			}
+			option.Type = "array_of_tables"
+			option.Options = optionSchemas(reflect.New(elem), nil)
+			return option, true
+		}
+		items, ok := optionSchema(elem, reflect.Value{})
+		if !ok || items.Items != "" {
+			return option, false
+		}
+		option.Type = "array"
+		option.Items = items.Type
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return option, false
+		}
+		option.Type = "table"
+		if typ.Elem().Kind() == reflect.Interface {
+			break
+		}
+		items, ok := optionSchema(typ.Elem(), reflect.Value{})
+		if !ok {
+			return option, false
+		}
+		option.Items = items.Type
+	case reflect.Struct:
+		if !strings.HasPrefix(typ.PkgPath(), telegrafPkg) {
+			return option, false
+		}
+		option.Type = "table"
+		if !v.IsValid() {
+			v = reflect.New(typ)
+		}
+		option.Options = optionSchemas(v, nil)
+		return option, true
+	default:
+		return option, false
+	}
+
+	if hasDefault {
+		option.Default = v.Interface()
+	}
+	return option, true
+}
+
+func isType(typ reflect.Type, types []reflect.Type) bool {
+	for _, t := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
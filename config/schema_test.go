@@ -0,0 +1,75 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf/config"
+	_ "github.com/influxdata/telegraf/plugins/inputs/exec"
+	_ "github.com/influxdata/telegraf/plugins/processors/reverse_dns"
+	"github.com/stretchr/testify/require"
+)
+
+func findPlugin(t *testing.T, plugins []config.PluginSchema, name string) config.PluginSchema {
+	for _, p := range plugins {
+		if p.Name == name {
+			return p
+		}
+	}
+	require.FailNow(t, "plugin not found", name)
+	return config.PluginSchema{}
+}
+
+func findOption(t *testing.T, options []config.OptionSchema, key string) config.OptionSchema {
+	for _, o := range options {
+		if o.Key == key {
+			return o
+		}
+	}
+	require.FailNow(t, "option not found", key)
+	return config.OptionSchema{}
+}
+
+func TestPluginSchemas(t *testing.T) {
+	schema := config.PluginSchemas()
+
+	exec := findPlugin(t, schema.Inputs, "exec")
+	require.True(t, exec.Parser)
+	require.False(t, exec.Serializer)
+	require.Equal(t, config.OptionSchema{
+		Name:        "Commands",
+		Key:         "commands",
+		Type:        "array",
+		Items:       "string",
+		Description: "Commands array",
+	}, findOption(t, exec.Options, "commands"))
+	require.Equal(t, config.OptionSchema{
+		Name:        "Timeout",
+		Key:         "timeout",
+		Type:        "duration",
+		Default:     "5s",
+		Description: "Timeout for each command to complete.",
+	}, findOption(t, exec.Options, "timeout"))
+
+	// Streaming processors are described by the wrapped plugin.
+	rdns := findPlugin(t, schema.Processors, "reverse_dns")
+	require.Equal(t, "ReverseDNS does a reverse lookup on IP addresses to retrieve the DNS name", rdns.Description)
+	require.Equal(t, "1m0s", findOption(t, rdns.Options, "lookup_timeout").Default)
+	require.Equal(t, 10, findOption(t, rdns.Options, "max_parallel_lookups").Default)
+	ordered := findOption(t, rdns.Options, "ordered")
+	require.Equal(t, "boolean", ordered.Type)
+	require.Nil(t, ordered.Default)
+	lookup := findOption(t, rdns.Options, "lookup")
+	require.Equal(t, "array_of_tables", lookup.Type)
+	require.Equal(t, []config.OptionSchema{
+		{Name: "Tag", Key: "tag", Type: "string"},
+		{Name: "Field", Key: "field", Type: "string"},
+		{Name: "Dest", Key: "dest", Type: "string"},
+	}, lookup.Options)
+
+	dataFormat := findOption(t, schema.Parsers.Options, "data_format")
+	require.Equal(t, "influx", dataFormat.Default)
+	require.Contains(t, dataFormat.Enum, "json")
+
+	require.Equal(t, "duration", findOption(t, schema.Serializers.Options, "timestamp_units").Type)
+	require.Contains(t, findOption(t, schema.Serializers.Options, "data_format").Enum, "prometheus")
+}
@@ -0,0 +1,349 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/toml/ast"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats.
+const (
+	formatTOML = "toml"
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// configFormat returns the format of the configuration file or URL from its
+// extension, files without a known extension are TOML.
+func configFormat(config string) string {
+	ext := filepath.Ext(config)
+	if isURL(config) {
+		u, _ := url.Parse(config)
+		ext = path.Ext(u.Path)
+	}
+
+	switch ext {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".json":
+		return formatJSON
+	default:
+		return formatTOML
+	}
+}
+
+// isURL returns true if the configuration is loaded from an http or https
+// URL.
+func isURL(config string) bool {
+	u, err := url.Parse(config)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// isConfigFile returns true if the file is loaded from a config directory.
+func isConfigFile(name string) bool {
+	ext := filepath.Ext(name)
+	switch ext {
+	case ".conf", ".yaml", ".yml", ".json":
+		return name != ext
+	default:
+		return false
+	}
+}
+
+// parseYAML parses a YAML or JSON configuration into the same tables as the
+// equivalent TOML configuration, so that both are loaded alike.  Mappings are
+// tables and sequences of mappings are arrays of tables:
+//
+//	inputs:
+//	  cpu:
+//	    - percpu: true
+//
+// is the same as
+//
+//	[[inputs.cpu]]
+//	  percpu = true
+//
+// The environment variables of YAML configurations are replaced in the values,
+// file references only if files is true.
+func parseYAML(contents []byte, format string, files bool) (*ast.Table, error) {
+	if format == formatJSON {
+		// YAML is a superset of JSON, but its errors are confusing for
+		// invalid JSON.
+		var v interface{}
+		if err := json.Unmarshal(contents, &v); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(contents, &doc); err != nil {
+		return nil, err
+	}
+	if format == formatYAML {
+		if err := substituteYAML(&doc, files); err != nil {
+			return nil, err
+		}
+	}
+
+	root := &ast.Table{
+		Line:   1,
+		Fields: make(map[string]interface{}),
+		Type:   ast.TableTypeNormal,
+	}
+	// An empty document has no content.
+	if len(doc.Content) == 0 {
+		return root, nil
+	}
+
+	node := resolveAlias(doc.Content[0])
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping at the top level", node.Line)
+	}
+	if err := yamlFields(root, node); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// substituteYAML replaces the environment variables and file references in
+// the scalars of the document.  The values of plain scalars are resolved
+// again, so that ${PORT} is an integer if the variable is one, quoted scalars
+// remain strings.
+func substituteYAML(doc *yaml.Node, files bool) error {
+	var errs []string
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		// Aliased nodes are replaced at their anchor.
+		if node.Kind == yaml.AliasNode {
+			return
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+		if node.Kind != yaml.ScalarNode {
+			return
+		}
+
+		value := expandEnv(node.Value, files, func(v string) string { return v }, func(_ int, msg string) {
+			errs = append(errs, fmt.Sprintf("line %d: %s", node.Line, msg))
+		})
+		if value == node.Value {
+			return
+		}
+		node.Value = value
+		if node.Tag != "!!str" {
+			return
+		}
+		// Empty values remain strings instead of becoming null.
+		resolved := &yaml.Node{Kind: yaml.ScalarNode, Style: node.Style, Value: value}
+		switch tag := resolved.ShortTag(); tag {
+		case "!!int", "!!float", "!!bool", "!!timestamp":
+			node.Tag = tag
+		}
+	}
+	walk(doc)
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// yamlFields adds the keys of the mapping to the fields of the table.  Merge
+// keys, "<<", add the keys of the merged mappings missing in the mapping.
+func yamlFields(tbl *ast.Table, node *yaml.Node) error {
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+		if key.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: keys must be scalars", key.Line)
+		}
+		if key.Tag == "!!merge" {
+			merges = append(merges, value)
+			continue
+		}
+		if _, ok := tbl.Fields[key.Value]; ok {
+			return fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+		}
+
+		field, err := yamlField(key, value)
+		if err != nil {
+			return err
+		}
+		tbl.Fields[key.Value] = field
+	}
+
+	for _, merge := range merges {
+		mappings := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			mappings = merge.Content
+		}
+		for _, mapping := range mappings {
+			mapping = resolveAlias(mapping)
+			if mapping.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: only mappings can be merged", mapping.Line)
+			}
+			merged := &ast.Table{Fields: make(map[string]interface{})}
+			if err := yamlFields(merged, mapping); err != nil {
+				return err
+			}
+			for k, v := range merged.Fields {
+				if _, ok := tbl.Fields[k]; !ok {
+					tbl.Fields[k] = v
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// yamlField returns the table, array of tables or key value of the key.
+func yamlField(key, node *yaml.Node) (interface{}, error) {
+	switch {
+	case node.Kind == yaml.MappingNode || isNull(node):
+		return yamlTable(key.Value, key.Line, ast.TableTypeNormal, node)
+	case node.Kind == yaml.SequenceNode && isTableArray(node):
+		tables := make([]*ast.Table, 0, len(node.Content))
+		for _, item := range node.Content {
+			item = resolveAlias(item)
+			line := item.Line
+			if line == 0 {
+				line = key.Line
+			}
+			tbl, err := yamlTable(key.Value, line, ast.TableTypeArray, item)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, tbl)
+		}
+		return tables, nil
+	default:
+		value, err := yamlValue(node)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.KeyValue{Key: key.Value, Value: value, Line: key.Line}, nil
+	}
+}
+
+func yamlTable(name string, line int, typ ast.TableType, node *yaml.Node) (*ast.Table, error) {
+	tbl := &ast.Table{
+		Line:   line,
+		Name:   name,
+		Fields: make(map[string]interface{}),
+		Type:   typ,
+	}
+	if isNull(node) {
+		return tbl, nil
+	}
+	if err := yamlFields(tbl, node); err != nil {
+		return nil, err
+	}
+	return tbl, nil
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// isTableArray returns true if the sequence is not empty and has only
+// mappings, null items are empty tables.
+func isTableArray(node *yaml.Node) bool {
+	if len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		item = resolveAlias(item)
+		if item.Kind != yaml.MappingNode && !isNull(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlValue converts the scalar or sequence into a TOML value, the source of
+// the value is its TOML representation.
+func yamlValue(node *yaml.Node) (ast.Value, error) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		array := &ast.Array{Value: make([]ast.Value, 0, len(node.Content))}
+		sources := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			item = resolveAlias(item)
+			if item.Kind == yaml.MappingNode || isNull(item) {
+				return nil, fmt.Errorf("line %d: arrays cannot mix tables and values", item.Line)
+			}
+			value, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			array.Value = append(array.Value, value)
+			sources = append(sources, value.Source())
+		}
+		array.Data = []rune("[" + strings.Join(sources, ", ") + "]")
+		return array, nil
+	case yaml.ScalarNode:
+	default:
+		return nil, fmt.Errorf("line %d: unsupported value", node.Line)
+	}
+
+	switch node.Tag {
+	case "!!str":
+		return &ast.String{Value: node.Value, Data: []rune(strconv.Quote(node.Value))}, nil
+	case "!!int":
+		var v int64
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		s := strconv.FormatInt(v, 10)
+		return &ast.Integer{Value: s, Data: []rune(s)}, nil
+	case "!!float":
+		var v float64
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		switch {
+		case math.IsInf(v, 1):
+			s = "inf"
+		case math.IsInf(v, -1):
+			s = "-inf"
+		case math.IsNaN(v):
+			s = "nan"
+		}
+		return &ast.Float{Value: s, Data: []rune(s)}, nil
+	case "!!bool":
+		var v bool
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		s := strconv.FormatBool(v)
+		return &ast.Boolean{Value: s, Data: []rune(s)}, nil
+	case "!!timestamp":
+		var v time.Time
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		s := v.Format(time.RFC3339Nano)
+		return &ast.Datetime{Value: s, Data: []rune(s)}, nil
+	default:
+		return nil, fmt.Errorf("line %d: unsupported value of type %s", node.Line, node.Tag)
+	}
+}
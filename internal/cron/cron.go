@@ -0,0 +1,261 @@
+// Package cron parses cron schedules and computes their next run time.
+//
+// A schedule has the five standard fields, separated by spaces:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field is "*", a value, a range "a-b", or a list of those separated by
+// commas, optionally followed by a step "/n".  Months and days of the week may
+// be given by their three letter English names, Sunday is 0 or 7.  When both
+// the day of the month and the day of the week are restricted, a day matching
+// either runs the schedule.
+//
+// The descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly are accepted in place of the fields.  Times are in the local time
+// zone unless the schedule starts with "CRON_TZ=<zone> ".
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron schedule.
+type Schedule struct {
+	spec string
+	loc  *time.Location
+
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domStar and dowStar are true when the day fields are unrestricted.
+	domStar bool
+	dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearchYears bounds the search of the next run time, schedules such as
+// February 30th never run.
+const maxSearchYears = 5
+
+// Parse parses the cron schedule.
+func Parse(spec string) (*Schedule, error) {
+	s := &Schedule{spec: spec, loc: time.Local}
+
+	expr := strings.TrimSpace(spec)
+	if strings.HasPrefix(expr, "CRON_TZ=") {
+		i := strings.IndexAny(expr, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("missing schedule after %s", expr)
+		}
+		loc, err := time.LoadLocation(strings.TrimPrefix(expr[:i], "CRON_TZ="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone: %v", err)
+		}
+		s.loc = loc
+		expr = strings.TrimSpace(expr[i:])
+	}
+
+	if strings.HasPrefix(expr, "@") {
+		d, ok := descriptors[expr]
+		if !ok {
+			return nil, fmt.Errorf("unknown descriptor %q", expr)
+		}
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d", len(fields))
+	}
+
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// Sunday is both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", spec)
+	}
+	return s, nil
+}
+
+// parse returns the set of values of the field as a bitset.
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %v", f.name, expr, err)
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func (f field) parsePart(part string) (uint64, error) {
+	rng, step := part, 1
+	if i := strings.Index(part, "/"); i >= 0 {
+		rng = part[:i]
+		n, err := strconv.Atoi(part[i+1:])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid step %q", part[i+1:])
+		}
+		step = n
+	}
+
+	var lo, hi int
+	switch {
+	case rng == "*" || rng == "?":
+		lo, hi = f.min, f.max
+		if f.name == dowField.name {
+			hi = 6
+		}
+	case strings.Contains(rng, "-"):
+		i := strings.Index(rng, "-")
+		var err error
+		if lo, err = f.value(rng[:i]); err != nil {
+			return 0, err
+		}
+		if hi, err = f.value(rng[i+1:]); err != nil {
+			return 0, err
+		}
+		if hi < lo {
+			return 0, fmt.Errorf("range %q is reversed", rng)
+		}
+	default:
+		var err error
+		if lo, err = f.value(rng); err != nil {
+			return 0, err
+		}
+		hi = lo
+		// A single value with a step, such as 5/15, runs from the value to
+		// the maximum.
+		if step > 1 {
+			hi = f.max
+		}
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the schedule as it was parsed.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first run time strictly after t, or the zero time if the
+// schedule does not run in the following years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.Year() + maxSearchYears
+
+	for t.Year() <= end {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// forward returns next if it is after t.  Otherwise the wall clock time of next
+// does not exist due to a daylight saving time change and an hour after t is
+// returned.
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Hour)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
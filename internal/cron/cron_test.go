@@ -0,0 +1,135 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// Thursday
+	start := time.Date(2020, 10, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		expected []time.Time
+	}{
+		{
+			spec: "CRON_TZ=UTC */15 * * * *",
+			expected: []time.Time{
+				time.Date(2020, 10, 1, 10, 15, 0, 0, time.UTC),
+				time.Date(2020, 10, 1, 10, 30, 0, 0, time.UTC),
+				time.Date(2020, 10, 1, 10, 45, 0, 0, time.UTC),
+				time.Date(2020, 10, 1, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC 0 2 * * *",
+			expected: []time.Time{
+				time.Date(2020, 10, 2, 2, 0, 0, 0, time.UTC),
+				time.Date(2020, 10, 3, 2, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC */30 9-17 * * mon-fri",
+			expected: []time.Time{
+				time.Date(2020, 10, 1, 10, 30, 0, 0, time.UTC),
+				time.Date(2020, 10, 1, 11, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC 0 9 * * MON-FRI",
+			expected: []time.Time{
+				time.Date(2020, 10, 2, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 10, 5, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC 0 0 1,15 * 7",
+			expected: []time.Time{
+				time.Date(2020, 10, 4, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 10, 11, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 10, 15, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 10, 18, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC 5/20 0 * * *",
+			expected: []time.Time{
+				time.Date(2020, 10, 2, 0, 5, 0, 0, time.UTC),
+				time.Date(2020, 10, 2, 0, 25, 0, 0, time.UTC),
+				time.Date(2020, 10, 2, 0, 45, 0, 0, time.UTC),
+				time.Date(2020, 10, 3, 0, 5, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC 0 0 29 feb *",
+			expected: []time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			spec: "CRON_TZ=UTC @monthly",
+			expected: []time.Time{
+				time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			require.NoError(t, err)
+			require.Equal(t, tt.spec, s.String())
+
+			now := start
+			for _, expected := range tt.expected {
+				now = s.Next(now)
+				require.True(t, expected.Equal(now), "expected %v, got %v", expected, now)
+			}
+		})
+	}
+}
+
+func TestNextTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	s, err := Parse("CRON_TZ=America/New_York 0 2 * * *")
+	require.NoError(t, err)
+
+	next := s.Next(time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC))
+	require.True(t, time.Date(2020, 10, 2, 2, 0, 0, 0, loc).Equal(next))
+
+	// 2:00 does not exist on the day daylight saving time starts.
+	next = s.Next(time.Date(2020, 3, 8, 0, 0, 0, 0, loc))
+	require.True(t, time.Date(2020, 3, 9, 2, 0, 0, 0, loc).Equal(next))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"* * * *", "expected 5 fields, found 4"},
+		{"60 * * * *", `invalid minute "60": value 60 out of range 0-59`},
+		{"* 5-1 * * *", `invalid hour "5-1": range "5-1" is reversed`},
+		{"*/0 * * * *", `invalid minute "*/0": invalid step "0"`},
+		{"* * * foo *", `invalid month "foo": invalid value "foo"`},
+		{"* * 0 * *", `invalid day of month "0": value 0 out of range 1-31`},
+		{"@often", `unknown descriptor "@often"`},
+		{"CRON_TZ=Nowhere/Land * * * * *", "invalid time zone: unknown time zone Nowhere/Land"},
+		{"0 0 30 2 *", `schedule "0 0 30 2 *" never runs`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
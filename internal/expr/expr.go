@@ -0,0 +1,221 @@
+// Package expr evaluates boolean expressions on the name, tags and fields of
+// a metric, such as:
+//
+//	fields.status != 200 && tags.host startsWith 'db'
+//
+// Expressions support the comparison operators == != < <= > >=, the string
+// operators startsWith, endsWith, contains and matches (a regular
+// expression), the arithmetic operators + - * / %, the boolean operators
+// && || ! and parentheses.  The metric is referenced with name, tags.<key>
+// and fields.<key>, or tags['key'] and fields['key'] for keys that are not
+// identifiers.
+//
+// A missing tag or field is not equal to any value, ordering and string
+// comparisons with it are false and arithmetic with it yields a missing
+// value.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Expression is a compiled expression.
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses the expression.
+func Compile(source string) (*Expression, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %v at offset %d", t, t.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval returns the result of the expression for the metric.  An error is
+// returned when the operands of an operator have the wrong type or the
+// result is not a boolean.
+func (e *Expression) Eval(m telegraf.Metric) (bool, error) {
+	v, err := e.root.eval(m)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression result %v is not a boolean", describe(v))
+	}
+	return b, nil
+}
+
+// Match returns the result of the expression for the metric, errors are
+// false.
+func (e *Expression) Match(m telegraf.Metric) bool {
+	b, err := e.Eval(m)
+	return err == nil && b
+}
+
+type node interface {
+	eval(m telegraf.Metric) (interface{}, error)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n *literal) eval(m telegraf.Metric) (interface{}, error) {
+	return n.value, nil
+}
+
+type nameRef struct{}
+
+func (n *nameRef) eval(m telegraf.Metric) (interface{}, error) {
+	return m.Name(), nil
+}
+
+type tagRef struct {
+	key string
+}
+
+func (n *tagRef) eval(m telegraf.Metric) (interface{}, error) {
+	if v, ok := m.GetTag(n.key); ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+type fieldRef struct {
+	key string
+}
+
+func (n *fieldRef) eval(m telegraf.Metric) (interface{}, error) {
+	if v, ok := m.GetField(n.key); ok {
+		return normalize(v), nil
+	}
+	return nil, nil
+}
+
+type notOp struct {
+	operand node
+}
+
+func (n *notOp) eval(m telegraf.Metric) (interface{}, error) {
+	v, err := evalBool(n.operand, m, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !v, nil
+}
+
+type negOp struct {
+	operand node
+}
+
+func (n *negOp) eval(m telegraf.Metric) (interface{}, error) {
+	v, err := n.operand.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		return -v, nil
+	case float64:
+		return -v, nil
+	}
+	return nil, fmt.Errorf("operator - not supported on %v", describe(v))
+}
+
+// logicalOp is && or ||, the right operand is only evaluated when needed.
+type logicalOp struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalOp) eval(m telegraf.Metric) (interface{}, error) {
+	l, err := evalBool(n.left, m, n.op)
+	if err != nil {
+		return nil, err
+	}
+	if (n.op == "&&" && !l) || (n.op == "||" && l) {
+		return l, nil
+	}
+	return evalBool(n.right, m, n.op)
+}
+
+type binaryOp struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryOp) eval(m telegraf.Metric) (interface{}, error) {
+	l, err := n.left.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(m)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return compare(n.op, l, r)
+	case "startsWith", "endsWith", "contains":
+		return stringOp(n.op, l, r)
+	default:
+		return arithmetic(n.op, l, r)
+	}
+}
+
+// matchOp matches a string against a regular expression compiled with the
+// expression.
+type matchOp struct {
+	operand node
+	re      *regexp.Regexp
+}
+
+func (n *matchOp) eval(m telegraf.Metric) (interface{}, error) {
+	v, err := n.operand.eval(m)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case string:
+		return n.re.MatchString(v), nil
+	}
+	return nil, fmt.Errorf("operator matches not supported on %v", describe(v))
+}
+
+func evalBool(n node, m telegraf.Metric, op string) (bool, error) {
+	v, err := n.eval(m)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("operator %s not supported on %v", op, describe(v))
+	}
+	return b, nil
+}
@@ -0,0 +1,129 @@
+package expr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var testMetric = testutil.MustMetric(
+	"http_response",
+	map[string]string{
+		"host":   "db-01",
+		"server": "http://example.org",
+		"a-b":    "dashed",
+	},
+	map[string]interface{}{
+		"status":       int64(503),
+		"usage_idle":   99.5,
+		"used":         uint64(30),
+		"total":        int64(40),
+		"result":       "timeout",
+		"ok":           false,
+		"request time": 1.5,
+	},
+	time.Unix(0, 0),
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`fields.status != 200`, true},
+		{`fields.status == 503`, true},
+		{`fields.status >= 500 && fields.status < 600`, true},
+		{`fields.usage_idle > 99`, true},
+		{`fields.usage_idle > 99.5`, false},
+		{`fields.status > 99.5`, true},
+		{`tags.host startsWith 'db'`, true},
+		{`tags.host endsWith "01"`, true},
+		{`tags.server contains 'example'`, true},
+		{`tags.server matches '^https?://'`, true},
+		{`name == 'http_response'`, true},
+		{`fields.status != 200 && tags.host startsWith 'db'`, true},
+		{`fields.status == 200 || tags.host == 'db-01'`, true},
+		{`!(fields.status == 200)`, true},
+		{`!fields.ok`, true},
+		{`fields.ok == false`, true},
+		{`fields.used / fields.total > 0.7`, true},
+		{`fields.used + 10 == fields.total`, true},
+		{`fields.total % 3 == 1`, true},
+		{`-fields.total < 0`, true},
+		{`1 + 2 * 3 == 7`, true},
+		{`fields.result == "timeout"`, true},
+		{`tags['a-b'] == 'dashed'`, true},
+		{`fields["request time"] < 2`, true},
+		{`tags.missing == 'x'`, false},
+		{`tags.missing != 'x'`, true},
+		{`fields.missing > 1`, false},
+		{`fields.missing < 1`, false},
+		{`fields.missing + 1 == 1`, false},
+		{`tags.missing startsWith 'x'`, false},
+		{`tags.missing matches '.*'`, false},
+		{`true`, true},
+		{`false || true && false`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Compile(tt.expr)
+			require.NoError(t, err)
+			result, err := e.Eval(testMetric)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`fields.status`, "expression result number 503 is not a boolean"},
+		{`fields.status > 'a'`, `operator > not supported on number 503 and string "a"`},
+		{`fields.ok > true`, "operator > not supported on boolean false and boolean true"},
+		{`fields.status && true`, "operator && not supported on number 503"},
+		{`tags.host + 1 > 0`, `operator + not supported on string "db-01" and number 1`},
+		{`fields.status % 0 == 0`, "integer modulo by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Compile(tt.expr)
+			require.NoError(t, err)
+			_, err = e.Eval(testMetric)
+			require.EqualError(t, err, tt.err)
+			require.False(t, e.Match(testMetric))
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{``, "unexpected end of expression at offset 0"},
+		{`fields.status ==`, "unexpected end of expression at offset 16"},
+		{`fields.status == 200)`, `unexpected ")" at offset 20`},
+		{`(fields.status == 200`, `expected ")", found end of expression at offset 21`},
+		{`field.status == 200`, `unknown identifier "field" at offset 0`},
+		{`tags == 'a'`, `expected . or [ after tags, found "==" at offset 5`},
+		{`tags['a' == 'b'`, `expected "]", found "==" at offset 9`},
+		{`tags.host == 'a`, "unterminated string at offset 13"},
+		{`tags.host matches '('`, "invalid regular expression at offset 18: error parsing regexp: missing closing ): `(`"},
+		{`tags.host matches tags.x`, `expected a string after matches, found "tags" at offset 18`},
+		{`fields.a = 1`, `unexpected character '=' at offset 9`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
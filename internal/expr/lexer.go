@@ -0,0 +1,130 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // source text of the token
+	value string // value of a string token
+	pos   int    // offset of the token in the expression
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators are sorted so that the longest operator matches first.
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".",
+}
+
+// lex splits the expression into tokens.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for pos < len(input) {
+		c := rune(input[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case isDigit(c):
+			start := pos
+			for pos < len(input) && (isDigit(rune(input[pos])) || input[pos] == '.') {
+				pos++
+			}
+			if pos < len(input) && (input[pos] == 'e' || input[pos] == 'E') {
+				pos++
+				if pos < len(input) && (input[pos] == '+' || input[pos] == '-') {
+					pos++
+				}
+				for pos < len(input) && isDigit(rune(input[pos])) {
+					pos++
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: input[start:pos], pos: start})
+		case isIdentStart(c):
+			start := pos
+			for pos < len(input) && isIdentPart(rune(input[pos])) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: input[start:pos], pos: start})
+		case c == '\'' || c == '"':
+			start := pos
+			value, n, err := lexString(input[pos:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at offset %d", err, start)
+			}
+			pos += n
+			tokens = append(tokens, token{kind: tokenString, text: input[start:pos], value: value, pos: start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(input[pos:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, pos)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: pos})
+			pos += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: pos}), nil
+}
+
+// lexString reads the quoted string at the start of the input and returns its
+// value and length.  A backslash escapes the next character.
+func lexString(input string) (string, int, error) {
+	quote := input[0]
+	var b strings.Builder
+	for i := 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			i++
+			if i == len(input) {
+				break
+			}
+			b.WriteByte(input[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(input[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || isDigit(c)
+}
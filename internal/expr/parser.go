@@ -0,0 +1,253 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// parser is a recursive descent parser, from the lowest precedence:
+//
+//	or         = and { "||" and }
+//	and        = not { "&&" not }
+//	not        = "!" not | comparison
+//	comparison = sum [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" |
+//	             "startsWith" | "endsWith" | "contains" ) sum |
+//	             "matches" string ]
+//	sum        = product { ( "+" | "-" ) product }
+//	product    = unary { ( "*" | "/" | "%" ) unary }
+//	unary      = "-" unary | primary
+//	primary    = number | string | "true" | "false" | "name" |
+//	             ( "tags" | "fields" ) ( "." ident | "[" string "]" ) |
+//	             "(" or ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators or keywords.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && t.kind != tokenIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		t := p.peek()
+		return fmt.Errorf("expected %q, found %v at offset %d", op, t, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalOp{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalOp{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.accept("!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notOp{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.accept("matches"); ok {
+		t := p.next()
+		if t.kind != tokenString {
+			return nil, fmt.Errorf("expected a string after matches, found %v at offset %d", t, t.pos)
+		}
+		re, err := regexp.Compile(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression at offset %d: %v", t.pos, err)
+		}
+		return &matchOp{operand: left, re: re}, nil
+	}
+
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "startsWith", "endsWith", "contains")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryOp{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryOp{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryOp{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negOp{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if v, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{value: v}, nil
+		}
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return &literal{value: v}, nil
+	case tokenString:
+		return &literal{value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "name":
+			return &nameRef{}, nil
+		case "tags", "fields":
+			key, err := p.parseKey(t.text)
+			if err != nil {
+				return nil, err
+			}
+			if t.text == "tags" {
+				return &tagRef{key: key}, nil
+			}
+			return &fieldRef{key: key}, nil
+		}
+		return nil, fmt.Errorf("unknown identifier %q at offset %d", t.text, t.pos)
+	case tokenOperator:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %v at offset %d", t, t.pos)
+}
+
+// parseKey parses the key of a tag or field, either .key or ['key'].
+func (p *parser) parseKey(kind string) (string, error) {
+	if _, ok := p.accept("."); ok {
+		t := p.next()
+		if t.kind != tokenIdent {
+			return "", fmt.Errorf("expected a key after %s., found %v at offset %d", kind, t, t.pos)
+		}
+		return t.text, nil
+	}
+	if _, ok := p.accept("["); ok {
+		t := p.next()
+		if t.kind != tokenString {
+			return "", fmt.Errorf("expected a string key after %s[, found %v at offset %d", kind, t, t.pos)
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		return t.value, nil
+	}
+	t := p.peek()
+	return "", fmt.Errorf("expected . or [ after %s, found %v at offset %d", kind, t, t.pos)
+}
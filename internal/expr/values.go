@@ -0,0 +1,187 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// normalize converts the field value to the types used in expressions:
+// int64, float64, string or bool.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			return float64(v)
+		}
+		return int64(v)
+	case int:
+		return int64(v)
+	case float32:
+		return float64(v)
+	}
+	return v
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "missing value"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("boolean %t", v)
+	}
+	return fmt.Sprintf("number %v", v)
+}
+
+// numbers returns the operands as li and ri when both are integers, otherwise
+// as lf and rf.  ok is false when an operand is not a number.
+func numbers(l, r interface{}) (li, ri int64, lf, rf float64, isInt bool, ok bool) {
+	switch l := l.(type) {
+	case int64:
+		switch r := r.(type) {
+		case int64:
+			return l, r, 0, 0, true, true
+		case float64:
+			return 0, 0, float64(l), r, false, true
+		}
+	case float64:
+		switch r := r.(type) {
+		case int64:
+			return 0, 0, l, float64(r), false, true
+		case float64:
+			return 0, 0, l, r, false, true
+		}
+	}
+	return 0, 0, 0, 0, false, false
+}
+
+// compare evaluates a comparison operator.  Numbers compare with numbers,
+// strings with strings and booleans only for equality.
+func compare(op string, l, r interface{}) (interface{}, error) {
+	if l == nil || r == nil {
+		switch op {
+		case "==":
+			return l == nil && r == nil, nil
+		case "!=":
+			return l != nil || r != nil, nil
+		}
+		return false, nil
+	}
+
+	var c int
+	if li, ri, lf, rf, isInt, ok := numbers(l, r); ok {
+		switch {
+		case isInt && li < ri:
+			c = -1
+		case isInt && li > ri:
+			c = 1
+		case isInt:
+		case math.IsNaN(lf) || math.IsNaN(rf):
+			// NaN is not equal to any number.
+			return op == "!=", nil
+		case lf < rf:
+			c = -1
+		case lf > rf:
+			c = 1
+		}
+	} else if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok {
+			return nil, mismatch(op, l, r)
+		}
+		c = strings.Compare(ls, rs)
+	} else if lb, ok := l.(bool); ok {
+		rb, ok := r.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return nil, mismatch(op, l, r)
+		}
+		if lb != rb {
+			c = 1
+		}
+	} else {
+		return nil, mismatch(op, l, r)
+	}
+
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func stringOp(op string, l, r interface{}) (interface{}, error) {
+	if l == nil || r == nil {
+		return false, nil
+	}
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if !lok || !rok {
+		return nil, mismatch(op, l, r)
+	}
+
+	switch op {
+	case "startsWith":
+		return strings.HasPrefix(ls, rs), nil
+	case "endsWith":
+		return strings.HasSuffix(ls, rs), nil
+	default:
+		return strings.Contains(ls, rs), nil
+	}
+}
+
+// arithmetic evaluates an arithmetic operator on numbers, the division of
+// integers is not truncated.
+func arithmetic(op string, l, r interface{}) (interface{}, error) {
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	li, ri, lf, rf, isInt, ok := numbers(l, r)
+	if !ok {
+		return nil, mismatch(op, l, r)
+	}
+
+	if isInt {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("integer modulo by zero")
+			}
+			return li % ri, nil
+		}
+		lf, rf = float64(li), float64(ri)
+	}
+
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	default:
+		return math.Mod(lf, rf), nil
+	}
+}
+
+func mismatch(op string, l, r interface{}) error {
+	return fmt.Errorf("operator %s not supported on %v and %v", op, describe(l), describe(r))
+}
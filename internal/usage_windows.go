@@ -11,11 +11,21 @@ Usage:
 The commands & flags are:
 
   config              print out full sample configuration to stdout
+  config migrate      print the configuration with deprecated plugins and
+                      options replaced, report the changes to stderr
+  plugins [--json]    print the available plugins and data formats, with
+                      --json the schema of their options
+  tap <stage>         stream the metrics of a stage of the running agent,
+                      such as processors.rename, through its API; options
+                      are --api-address, --alias and --filter
   version             print the version to stdout
 
   --aggregator-filter <filter>   filter the aggregators to enable, separator is :
+  --check-config                 load the configuration and initialize the plugins,
+                                 report all errors and exit
   --config <file>                configuration file to load
-  --config-directory <directory> directory containing additional *.conf files
+  --config-directory <directory> directory containing additional *.conf, *.yaml
+                                 and *.json files
   --debug                        turn on debug logging
   --input-filter <filter>        filter the inputs to enable, separator is :
   --input-list                   print available input plugins.
@@ -25,14 +35,25 @@ The commands & flags are:
   --pprof-addr <address>         pprof address to listen on, don't activate pprof if empty
   --processor-filter <filter>    filter the processors to enable, separator is :
   --quiet                        run in quiet mode
+  --replay                       replay the metrics of the files given as
+                                 arguments through the processors to the outputs,
+                                 exit once the outputs have acknowledged them
+  --replay-format <format>       data format of the replayed files, overrides the
+                                 data_format of the [replay] table, default influx
+  --replay-rate <n>              maximum number of metrics replayed per second
   --sample-config                print out full sample configuration
   --section-filter               filter config sections to output, separator is :
                                  Valid values are 'agent', 'global_tags', 'outputs',
                                  'processors', 'aggregators' and 'inputs'
   --once                         enable once mode: gather metrics once, write them, and exit
   --test                         enable test mode: gather metrics once and print them
+  --test-pipeline                enable test pipeline mode: gather metrics once, run
+                                 them through the processors and aggregators and
+                                 print the metrics each output would receive
+  --test-pipeline-window <dur>   in test pipeline mode, gather the inputs once per
+                                 interval of this aggregation window without waiting
   --test-wait                    wait up to this many seconds for service
-                                 inputs to complete in test or once mode
+                                 inputs to complete in test, test pipeline or once mode
   --usage <plugin>               print usage for a plugin, ie, 'telegraf --usage mysql'
   --version                      display the version and exit
 
@@ -49,9 +70,27 @@ Examples:
   # generate config with only cpu input & influxdb output plugins defined
   telegraf --input-filter cpu --output-filter influxdb config
 
+  # replace deprecated plugins and options in a config file
+  telegraf config migrate telegraf.conf > telegraf.new.conf
+
+  # print the options of all plugins as JSON
+  telegraf plugins --json > plugins.json
+
+  # stream the metrics leaving a processor of the running agent
+  telegraf --config telegraf.conf tap --filter "tags.host == 'db01'" processors.rename
+
+  # check the configuration without running telegraf
+  telegraf --config telegraf.conf --check-config
+
   # run a single telegraf collection, outputting metrics to stdout
   telegraf --config telegraf.conf --test
 
+  # print the metrics each output receives after the processors and aggregators
+  telegraf --config telegraf.conf --test-pipeline --test-pipeline-window 1m
+
+  # replay line protocol files through the processors to the outputs
+  telegraf --config telegraf.conf --replay --replay-rate 1000 metrics.out
+
   # run telegraf with all plugins defined in config file
   telegraf --config telegraf.conf
 
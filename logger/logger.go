@@ -1,11 +1,15 @@
 package logger
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf/internal"
@@ -15,11 +19,33 @@ import (
 
 var prefixRegex = regexp.MustCompile("^[DIWE]!")
 
+// sourceRegex matches the source of a message, such as "[inputs.cpu::alias] ".
+var sourceRegex = regexp.MustCompile(`^\[([^\]]+)\] ?`)
+
 const (
 	LogTargetFile   = "file"
 	LogTargetStderr = "stderr"
 )
 
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var levelNames = map[byte]string{
+	'D': "debug",
+	'I': "info",
+	'W': "warn",
+	'E': "error",
+}
+
+var pluginTypes = map[string]bool{
+	"inputs":      true,
+	"outputs":     true,
+	"processors":  true,
+	"aggregators": true,
+}
+
 // LogConfig contains the log configuration settings
 type LogConfig struct {
 	// will set the log level to DEBUG
@@ -38,6 +64,8 @@ type LogConfig struct {
 	RotationMaxSize internal.Size
 	// maximum rotated files to keep (older ones will be deleted)
 	RotationMaxArchives int
+	// text or json, json is not supported by the eventlog target
+	LogFormat string
 }
 
 type LoggerCreator interface {
@@ -53,19 +81,148 @@ func registerLogger(name string, loggerCreator LoggerCreator) {
 	loggerRegistry[name] = loggerCreator
 }
 
+// unfilteredWriter is implemented by the log writers to write messages that
+// are already filtered by the log level of their plugin.
+type unfilteredWriter interface {
+	WriteUnfiltered(b []byte) (n int, err error)
+}
+
 type telegrafLog struct {
-	writer         io.Writer
+	sync.Mutex
 	internalWriter io.Writer
+	json           bool
 }
 
 func (t *telegrafLog) Write(b []byte) (n int, err error) {
+	if !levelEnabled(b) {
+		return len(b), nil
+	}
+	return t.WriteUnfiltered(b)
+}
+
+func (t *telegrafLog) WriteUnfiltered(b []byte) (n int, err error) {
 	var line []byte
-	if !prefixRegex.Match(b) {
-		line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" I! "), b...)
-	} else {
-		line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" "), b...)
+	now := time.Now().UTC()
+	switch {
+	case t.json:
+		line = jsonLine(now, b)
+	case !prefixRegex.Match(b):
+		line = append([]byte(now.Format(time.RFC3339)+" I! "), b...)
+	default:
+		line = append([]byte(now.Format(time.RFC3339)+" "), b...)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	if _, err := t.internalWriter.Write(line); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// jsonRecord is a message logged in the json format.
+type jsonRecord struct {
+	Time        string `json:"time"`
+	Level       string `json:"level"`
+	PluginType  string `json:"plugin_type,omitempty"`
+	PluginName  string `json:"plugin_name,omitempty"`
+	PluginAlias string `json:"plugin_alias,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Message     string `json:"message"`
+}
+
+// jsonLine converts a message to a json record, the source of the message is
+// split into the plugin type, name and alias when it is a plugin.
+func jsonLine(now time.Time, b []byte) []byte {
+	record := jsonRecord{
+		Time:  now.Format(time.RFC3339Nano),
+		Level: "info",
+	}
+	msg := string(b)
+	if prefixRegex.MatchString(msg) {
+		record.Level = levelNames[msg[0]]
+		msg = strings.TrimPrefix(msg[2:], " ")
+	}
+	if m := sourceRegex.FindStringSubmatch(msg); m != nil {
+		msg = msg[len(m[0]):]
+		name := strings.SplitN(m[1], "::", 2)
+		parts := strings.SplitN(name[0], ".", 2)
+		if len(parts) == 2 && pluginTypes[parts[0]] {
+			record.PluginType = parts[0]
+			record.PluginName = parts[1]
+			if len(name) == 2 {
+				record.PluginAlias = name[1]
+			}
+		} else {
+			record.Source = m[1]
+		}
+	}
+	record.Message = strings.TrimRight(msg, "\r\n")
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"level":"error","message":%q}`, err.Error()))
+	}
+	return append(line, '\n')
+}
+
+// levelWriter drops the messages below the global log level.
+type levelWriter struct {
+	w io.Writer
+}
+
+func (l *levelWriter) Write(b []byte) (n int, err error) {
+	if !levelEnabled(b) {
+		return len(b), nil
+	}
+	return l.w.Write(b)
+}
+
+func (l *levelWriter) WriteUnfiltered(b []byte) (n int, err error) {
+	return l.w.Write(b)
+}
+
+// levelEnabled reports whether the message is written at the global log
+// level, messages without level are info messages.
+func levelEnabled(b []byte) bool {
+	level := wlog.INFO
+	if prefixRegex.Match(b) {
+		level = wlog.Levels[b[0]]
+	}
+	return level >= wlog.LogLevel()
+}
+
+// ParseLevel parses the log level of a plugin, one of "debug", "info", "warn"
+// or "error".
+func ParseLevel(level string) (wlog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return wlog.DEBUG, nil
+	case "info":
+		return wlog.INFO, nil
+	case "warn":
+		return wlog.WARN, nil
+	case "error":
+		return wlog.ERROR, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q, must be one of debug, info, warn or error", level)
+}
+
+// PrintUnfiltered writes a message ignoring the global log level, it is used
+// by plugins having their own log level.
+func PrintUnfiltered(msg string) {
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+
+	loggerMu.Lock()
+	w, ok := actualLogger.(unfilteredWriter)
+	loggerMu.Unlock()
+	if !ok {
+		log.Print(msg)
+		return
 	}
-	return t.writer.Write(line)
+	w.WriteUnfiltered([]byte(msg))
 }
 
 func (t *telegrafLog) Close() error {
@@ -83,9 +240,8 @@ func (t *telegrafLog) Close() error {
 }
 
 // newTelegrafWriter returns a logging-wrapped writer.
-func newTelegrafWriter(w io.Writer) io.Writer {
+func newTelegrafWriter(w io.Writer) *telegrafLog {
 	return &telegrafLog{
-		writer:         wlog.NewWriter(w),
 		internalWriter: w,
 	}
 }
@@ -120,12 +276,21 @@ func (t *telegrafLogCreator) CreateLogger(config LogConfig) (io.Writer, error) {
 		writer = defaultWriter
 	}
 
-	return newTelegrafWriter(writer), nil
+	tl := newTelegrafWriter(writer)
+	switch config.LogFormat {
+	case LogFormatJSON:
+		tl.json = true
+	case LogFormatText, "":
+	default:
+		log.Printf("E! Unsupported logformat: %s, using text", config.LogFormat)
+	}
+	return tl, nil
 }
 
 // Keep track what is actually set as a log output, because log package doesn't provide a getter.
 // It allows closing previous writer if re-set and have possibility to test what is actually set
 var actualLogger io.Writer
+var loggerMu sync.Mutex
 
 func newLogWriter(config LogConfig) io.Writer {
 	log.SetFlags(0)
@@ -150,7 +315,9 @@ func newLogWriter(config LogConfig) io.Writer {
 		closer.Close()
 	}
 	log.SetOutput(logWriter)
+	loggerMu.Lock()
 	actualLogger = logWriter
+	loggerMu.Unlock()
 
 	return logWriter
 }
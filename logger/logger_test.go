@@ -2,6 +2,7 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/wlog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -151,3 +153,57 @@ func createBasicLogConfig(filename string) LogConfig {
 		RotationMaxArchives: -1,
 	}
 }
+
+func TestJSONWriteLogToFile(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() { os.Remove(tmpfile.Name()) }()
+	config := createBasicLogConfig(tmpfile.Name())
+	config.LogFormat = LogFormatJSON
+	SetupLogging(config)
+	log.Printf("W! [inputs.snmp::core] timeout\n")
+	log.Printf("E! [agent] failed")
+	log.Printf("TEST")
+	log.Printf("D! TEST") // <- should be ignored
+
+	f, err := ioutil.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+
+	var records []jsonRecord
+	for _, line := range bytes.Split(bytes.TrimSpace(f), []byte("\n")) {
+		var record jsonRecord
+		require.NoError(t, json.Unmarshal(line, &record))
+		require.NotEmpty(t, record.Time)
+		record.Time = ""
+		records = append(records, record)
+	}
+	require.Equal(t, []jsonRecord{
+		{Level: "warn", PluginType: "inputs", PluginName: "snmp", PluginAlias: "core", Message: "timeout"},
+		{Level: "error", Source: "agent", Message: "failed"},
+		{Level: "info", Message: "TEST"},
+	}, records)
+}
+
+func TestPrintUnfiltered(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() { os.Remove(tmpfile.Name()) }()
+	config := createBasicLogConfig(tmpfile.Name())
+	config.Quiet = true
+	SetupLogging(config)
+	log.Printf("D! [inputs.snmp] filtered")
+	PrintUnfiltered("D! [inputs.snmp] unfiltered")
+
+	f, err := ioutil.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+	require.Equal(t, "Z D! [inputs.snmp] unfiltered\n", string(f[19:]))
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("Debug")
+	require.NoError(t, err)
+	require.Equal(t, wlog.DEBUG, level)
+
+	_, err = ParseLevel("trace")
+	require.Error(t, err)
+}
@@ -17,6 +17,8 @@ type metric struct {
 
 	tp        telegraf.ValueType
 	aggregate bool
+
+	origin *Origin
 }
 
 func New(
@@ -83,6 +85,10 @@ func FromMetric(other telegraf.Metric) telegraf.Metric {
 	for i, field := range other.FieldList() {
 		m.fields[i] = &telegraf.Field{Key: field.Key, Value: field.Value}
 	}
+
+	if origin, ok := GetOrigin(other); ok {
+		m.origin = &origin
+	}
 	return m
 }
 
@@ -248,6 +254,11 @@ func (m *metric) Copy() telegraf.Metric {
 	for i, field := range m.fields {
 		m2.fields[i] = &telegraf.Field{Key: field.Key, Value: field.Value}
 	}
+
+	if m.origin != nil {
+		origin := *m.origin
+		m2.origin = &origin
+	}
 	return m2
 }
 
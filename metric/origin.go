@@ -0,0 +1,65 @@
+package metric
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Origin is the input that gathered a metric, it is used to measure the
+// latency of the metric from the input to the outputs.
+type Origin struct {
+	Input      string
+	InputAlias string
+
+	// Gathered is when the input added the metric.
+	Gathered time.Time
+
+	// Buffered is when the metric was added to the buffer of an output.
+	Buffered time.Time
+}
+
+type originMetric interface {
+	originRef() **Origin
+}
+
+func (m *metric) originRef() **Origin {
+	return &m.origin
+}
+
+func (m *trackingMetric) originRef() **Origin {
+	if om, ok := m.Metric.(originMetric); ok {
+		return om.originRef()
+	}
+	return nil
+}
+
+// SetOrigin sets the origin of the metric.
+func SetOrigin(m telegraf.Metric, origin Origin) {
+	if om, ok := m.(originMetric); ok {
+		if ref := om.originRef(); ref != nil {
+			*ref = &origin
+		}
+	}
+}
+
+// GetOrigin returns the origin of the metric, false if it is unknown such as
+// for metrics created by processors and aggregators.
+func GetOrigin(m telegraf.Metric) (Origin, bool) {
+	if om, ok := m.(originMetric); ok {
+		if ref := om.originRef(); ref != nil && *ref != nil {
+			return **ref, true
+		}
+	}
+	return Origin{}, false
+}
+
+// SetBuffered sets the time the metric was added to the buffer of an output,
+// if its origin is known.
+func SetBuffered(m telegraf.Metric, t time.Time) {
+	if om, ok := m.(originMetric); ok {
+		if ref := om.originRef(); ref != nil && *ref != nil {
+			(*ref).Buffered = t
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package metric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrigin(t *testing.T) {
+	now := time.Now()
+	m := mustMetric("cpu", nil, map[string]interface{}{"value": 42}, now)
+
+	_, ok := GetOrigin(m)
+	require.False(t, ok)
+	SetBuffered(m, now)
+	_, ok = GetOrigin(m)
+	require.False(t, ok)
+
+	SetOrigin(m, Origin{Input: "cpu", InputAlias: "a", Gathered: now})
+	tm, _ := WithTracking(m, func(telegraf.DeliveryInfo) {})
+	copied := tm.Copy()
+	SetBuffered(copied, now.Add(time.Second))
+
+	origin, ok := GetOrigin(tm)
+	require.True(t, ok)
+	require.Equal(t, Origin{Input: "cpu", InputAlias: "a", Gathered: now}, origin)
+
+	origin, ok = GetOrigin(copied)
+	require.True(t, ok)
+	require.Equal(t, now.Add(time.Second), origin.Buffered)
+
+	origin, ok = GetOrigin(FromMetric(copied))
+	require.True(t, ok)
+	require.Equal(t, "cpu", origin.Input)
+}
@@ -12,18 +12,44 @@ var (
 	AgentMetricsDropped = selfstat.Register("agent", "metrics_dropped", map[string]string{})
 )
 
-// Buffer stores metrics in a circular buffer.
-type Buffer struct {
-	sync.Mutex
-	buf   []telegraf.Metric
-	first int // index of the first/oldest metric
-	last  int // one after the index of the last/newest metric
-	size  int // number of metrics currently in the buffer
-	cap   int // the capacity of the buffer
+const (
+	// BufferStrategyMemory keeps unwritten metrics in memory.
+	BufferStrategyMemory = "memory"
 
-	batchFirst int // index of the first metric in the batch
-	batchSize  int // number of metrics currently in the batch
+	// BufferStrategyDisk keeps unwritten metrics in segment files on disk.
+	BufferStrategyDisk = "disk"
+)
+
+// OutputBuffer holds the metrics of an output until they are written.
+type OutputBuffer interface {
+	// Len returns the number of metrics currently in the buffer.
+	Len() int
+
+	// Add adds metrics to the buffer and returns number of dropped metrics.
+	Add(metrics ...telegraf.Metric) int
+
+	// Batch returns a slice containing up to batchSize of the oldest metrics
+	// not yet dropped.
+	Batch(batchSize int) []telegraf.Metric
+
+	// Accept marks the batch, acquired from Batch(), as successfully written.
+	Accept(batch []telegraf.Metric)
+
+	// Reject returns the batch, acquired from Batch(), to the buffer and
+	// marks it as unsent.
+	Reject(batch []telegraf.Metric)
 
+	// Drain removes and returns all metrics in the buffer without marking
+	// them as written, so that they can be moved to another buffer.  It must
+	// not be called while a batch is outstanding.
+	Drain() []telegraf.Metric
+
+	// Close releases any resources held by the buffer.
+	Close() error
+}
+
+// bufferStats are the selfstat statistics shared by all buffer types.
+type bufferStats struct {
 	MetricsAdded   selfstat.Stat
 	MetricsWritten selfstat.Stat
 	MetricsDropped selfstat.Stat
@@ -31,20 +57,8 @@ type Buffer struct {
 	BufferLimit    selfstat.Stat
 }
 
-// NewBuffer returns a new empty Buffer with the given capacity.
-func NewBuffer(name string, alias string, capacity int) *Buffer {
-	tags := map[string]string{"output": name}
-	if alias != "" {
-		tags["alias"] = alias
-	}
-
-	b := &Buffer{
-		buf:   make([]telegraf.Metric, capacity),
-		first: 0,
-		last:  0,
-		size:  0,
-		cap:   capacity,
-
+func newBufferStats(tags map[string]string, capacity int) bufferStats {
+	s := bufferStats{
 		MetricsAdded: selfstat.Register(
 			"write",
 			"metrics_added",
@@ -71,11 +85,112 @@ func NewBuffer(name string, alias string, capacity int) *Buffer {
 			tags,
 		),
 	}
-	b.BufferSize.Set(int64(0))
-	b.BufferLimit.Set(int64(capacity))
+	s.BufferSize.Set(int64(0))
+	s.BufferLimit.Set(int64(capacity))
+	return s
+}
+
+func bufferTags(name string, alias string) map[string]string {
+	tags := map[string]string{"output": name}
+	if alias != "" {
+		tags["alias"] = alias
+	}
+	return tags
+}
+
+// Buffer stores metrics in a circular buffer.  Several batches can be
+// outstanding at once, a rejected batch is returned to the front of the buffer
+// so metrics may be written out of order.
+type Buffer struct {
+	sync.Mutex
+	buf   []telegraf.Metric
+	first int // index of the first/oldest metric
+	last  int // one after the index of the last/newest metric
+	size  int // number of metrics currently in the buffer
+	cap   int // the capacity of the buffer
+
+	batchFirst int // index of the first metric in the batch
+	batchSize  int // number of metrics currently in outstanding batches
+
+	// memory limits the memory used by the buffers of all outputs.  bytes is
+	// the memory used by the queued metrics and batchBytes the memory used by
+	// the outstanding batches.
+	memory     *BufferMemory
+	priority   int
+	bytes      int64
+	batchBytes int64
+
+	bufferStats
+}
+
+// NewBuffer returns a new empty Buffer with the given capacity.
+func NewBuffer(name string, alias string, capacity int) *Buffer {
+	b := &Buffer{
+		buf:   make([]telegraf.Metric, capacity),
+		first: 0,
+		last:  0,
+		size:  0,
+		cap:   capacity,
+
+		bufferStats: newBufferStats(bufferTags(name, alias), capacity),
+	}
 	return b
 }
 
+// SetMemory makes the buffer share the memory limit with the other buffers,
+// buffers with a lower priority are dropped from first.
+func (b *Buffer) SetMemory(memory *BufferMemory, priority int) {
+	b.Lock()
+	b.memory = memory
+	b.priority = priority
+	for i := 0; i < b.size; i++ {
+		b.account(b.buf[b.nextby(b.first, i)], 1, 0)
+	}
+	b.Unlock()
+
+	memory.register(b)
+	memory.enforce()
+}
+
+// account adds the memory used by the metric to the queued metrics and to the
+// outstanding batches, multiplied by queued and batch respectively.  The
+// memory limit is updated with the sum.
+func (b *Buffer) account(m telegraf.Metric, queued, batch int64) {
+	if b.memory == nil {
+		return
+	}
+	size := metricSize(m)
+	b.bytes += queued * size
+	b.batchBytes += batch * size
+	b.memory.add((queued + batch) * size)
+}
+
+// queuedBytes returns the memory used by the metrics that are not part of an
+// outstanding batch.
+func (b *Buffer) queuedBytes() int64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.bytes
+}
+
+// evict drops the oldest metrics that are not part of an outstanding batch
+// until at least n bytes are released or the buffer is empty.
+func (b *Buffer) evict(n int64) {
+	b.Lock()
+	defer b.Unlock()
+
+	start := b.bytes
+	for start-b.bytes < n && b.size > 0 {
+		m := b.buf[b.first]
+		b.account(m, -1, 0)
+		b.metricDropped(m)
+		b.buf[b.first] = nil
+		b.first = b.next(b.first)
+		b.size--
+	}
+	b.BufferSize.Set(int64(b.length()))
+}
+
 // Len returns the number of metrics currently in the buffer.
 func (b *Buffer) Len() int {
 	b.Lock()
@@ -108,6 +223,7 @@ func (b *Buffer) add(m telegraf.Metric) int {
 	dropped := 0
 	// Check if Buffer is full
 	if b.size == b.cap {
+		b.account(b.buf[b.last], -1, 0)
 		b.metricDropped(b.buf[b.last])
 		dropped++
 
@@ -118,6 +234,7 @@ func (b *Buffer) add(m telegraf.Metric) int {
 	}
 
 	b.metricAdded()
+	b.account(m, 1, 0)
 
 	b.buf[b.last] = m
 	b.last = b.next(b.last)
@@ -133,8 +250,6 @@ func (b *Buffer) add(m telegraf.Metric) int {
 // Add adds metrics to the buffer and returns number of dropped metrics.
 func (b *Buffer) Add(metrics ...telegraf.Metric) int {
 	b.Lock()
-	defer b.Unlock()
-
 	dropped := 0
 	for i := range metrics {
 		if n := b.add(metrics[i]); n != 0 {
@@ -143,6 +258,12 @@ func (b *Buffer) Add(metrics ...telegraf.Metric) int {
 	}
 
 	b.BufferSize.Set(int64(b.length()))
+	memory := b.memory
+	b.Unlock()
+
+	if memory != nil {
+		memory.enforce()
+	}
 	return dropped
 }
 
@@ -160,16 +281,17 @@ func (b *Buffer) Batch(batchSize int) []telegraf.Metric {
 	}
 
 	b.batchFirst = b.first
-	b.batchSize = outLen
+	b.batchSize += outLen
 
 	batchIndex := b.batchFirst
 	for i := range out {
 		out[i] = b.buf[batchIndex]
+		b.account(out[i], -1, 1)
 		b.buf[batchIndex] = nil
 		batchIndex = b.next(batchIndex)
 	}
 
-	b.first = b.nextby(b.first, b.batchSize)
+	b.first = b.nextby(b.first, outLen)
 	b.size -= outLen
 	return out
 }
@@ -180,10 +302,11 @@ func (b *Buffer) Accept(batch []telegraf.Metric) {
 	defer b.Unlock()
 
 	for _, m := range batch {
+		b.account(m, 0, -1)
 		b.metricWritten(m)
 	}
 
-	b.resetBatch()
+	b.endBatch(len(batch))
 	b.BufferSize.Set(int64(b.length()))
 }
 
@@ -209,15 +332,56 @@ func (b *Buffer) Reject(batch []telegraf.Metric) {
 	// Copy metrics from the batch back into the buffer
 	for i := range batch {
 		if i < skip {
+			b.account(batch[i], 0, -1)
 			b.metricDropped(batch[i])
 		} else {
+			b.account(batch[i], 1, -1)
 			b.buf[re] = batch[i]
 			re = b.next(re)
 		}
 	}
 
+	b.endBatch(len(batch))
+	b.BufferSize.Set(int64(b.length()))
+}
+
+// Drain removes and returns all metrics in the buffer without marking them as
+// written.
+func (b *Buffer) Drain() []telegraf.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	out := make([]telegraf.Metric, 0, b.size)
+	for b.size > 0 {
+		b.account(b.buf[b.first], -1, 0)
+		out = append(out, b.buf[b.first])
+		b.buf[b.first] = nil
+		b.first = b.next(b.first)
+		b.size--
+	}
+
 	b.resetBatch()
 	b.BufferSize.Set(int64(b.length()))
+	return out
+}
+
+// Close releases the memory of the buffer from the memory limit, unwritten
+// metrics are lost.
+func (b *Buffer) Close() error {
+	b.Lock()
+	memory := b.memory
+	if memory != nil {
+		memory.add(-b.bytes - b.batchBytes)
+		b.bytes = 0
+		b.batchBytes = 0
+		b.memory = nil
+	}
+	b.Unlock()
+
+	if memory != nil {
+		memory.unregister(b)
+	}
+	return nil
 }
 
 // dist returns the distance between two indexes.  Because this data structure
@@ -267,6 +431,14 @@ func (b *Buffer) prevby(index, count int) int {
 	return index
 }
 
+// endBatch removes a batch of n metrics from the outstanding batches.
+func (b *Buffer) endBatch(n int) {
+	b.batchSize -= min(n, b.batchSize)
+	if b.batchSize == 0 {
+		b.resetBatch()
+	}
+}
+
 func (b *Buffer) resetBatch() {
 	b.batchFirst = 0
 	b.batchSize = 0
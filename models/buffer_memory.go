@@ -0,0 +1,119 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Approximate memory used by a metric, a tag and a field besides the length
+// of their strings.
+const (
+	metricOverhead = 128
+	tagOverhead    = 40
+	fieldOverhead  = 48
+)
+
+// metricSize returns the approximate memory used by the metric in bytes.
+func metricSize(m telegraf.Metric) int64 {
+	size := metricOverhead + len(m.Name())
+	for _, tag := range m.TagList() {
+		size += tagOverhead + len(tag.Key) + len(tag.Value)
+	}
+	for _, field := range m.FieldList() {
+		size += fieldOverhead + len(field.Key)
+		if s, ok := field.Value.(string); ok {
+			size += len(s)
+		}
+	}
+	return int64(size)
+}
+
+// BufferMemory limits the approximate memory used by the metrics in the memory
+// buffers of all outputs.  When the limit is exceeded the oldest metrics of the
+// buffers with the lowest priority are dropped, among buffers of the same
+// priority the largest buffer is dropped from first.  Metrics in outstanding
+// batches are not dropped.
+type BufferMemory struct {
+	// Must be 64-bit aligned
+	used int64
+
+	sync.Mutex
+	limit   int64
+	buffers []*Buffer
+
+	BufferMemory selfstat.Stat
+}
+
+// NewBufferMemory returns a BufferMemory limited to limit bytes.
+func NewBufferMemory(limit int64) *BufferMemory {
+	return &BufferMemory{
+		limit:        limit,
+		BufferMemory: selfstat.Register("agent", "buffer_memory_bytes", map[string]string{}),
+	}
+}
+
+// Used returns the approximate memory used by the buffers in bytes.
+func (bm *BufferMemory) Used() int64 {
+	return atomic.LoadInt64(&bm.used)
+}
+
+func (bm *BufferMemory) add(delta int64) {
+	bm.BufferMemory.Set(atomic.AddInt64(&bm.used, delta))
+}
+
+func (bm *BufferMemory) register(b *Buffer) {
+	bm.Lock()
+	defer bm.Unlock()
+	bm.buffers = append(bm.buffers, b)
+}
+
+func (bm *BufferMemory) unregister(b *Buffer) {
+	bm.Lock()
+	defer bm.Unlock()
+	for i, buffer := range bm.buffers {
+		if buffer == b {
+			bm.buffers = append(bm.buffers[:i], bm.buffers[i+1:]...)
+			return
+		}
+	}
+}
+
+// enforce drops metrics until the memory used is within the limit.  It must
+// not be called with a buffer locked.
+func (bm *BufferMemory) enforce() {
+	if bm.Used() <= bm.limit {
+		return
+	}
+
+	bm.Lock()
+	defer bm.Unlock()
+
+	type candidate struct {
+		buffer *Buffer
+		bytes  int64
+	}
+	candidates := make([]candidate, 0, len(bm.buffers))
+	for _, b := range bm.buffers {
+		if bytes := b.queuedBytes(); bytes > 0 {
+			candidates = append(candidates, candidate{b, bytes})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].buffer.priority != candidates[j].buffer.priority {
+			return candidates[i].buffer.priority < candidates[j].buffer.priority
+		}
+		return candidates[i].bytes > candidates[j].bytes
+	})
+
+	for _, c := range candidates {
+		excess := bm.Used() - bm.limit
+		if excess <= 0 {
+			return
+		}
+		c.buffer.evict(excess)
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/influxdata/telegraf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricSize(t *testing.T) {
+	m := Metric()
+	require.Equal(t, int64(metricOverhead+len("cpu")+fieldOverhead+len("value")), metricSize(m))
+
+	m.AddTag("host", "localhost")
+	m.AddField("status", "ok")
+	require.Equal(t, int64(metricOverhead+len("cpu")+
+		tagOverhead+len("host")+len("localhost")+
+		fieldOverhead+len("value")+
+		fieldOverhead+len("status")+len("ok")), metricSize(m))
+}
+
+func TestBufferMemory(t *testing.T) {
+	size := metricSize(Metric())
+	memory := NewBufferMemory(3 * size)
+
+	low := setup(NewBuffer("low", "", 10))
+	low.SetMemory(memory, 0)
+	high := setup(NewBuffer("high", "", 10))
+	high.SetMemory(memory, 1)
+
+	// The oldest metrics of the lowest priority buffer are dropped first.
+	high.Add(MetricTime(1), MetricTime(2))
+	low.Add(MetricTime(3), MetricTime(4))
+	require.Equal(t, 3*size, memory.Used())
+	require.Equal(t, 1, low.Len())
+	require.Equal(t, int64(1), low.MetricsDropped.Get())
+	require.Equal(t, 2, high.Len())
+
+	high.Add(MetricTime(5), MetricTime(6))
+	require.Equal(t, 3*size, memory.Used())
+	require.Equal(t, 0, low.Len())
+	require.Equal(t, int64(2), low.MetricsDropped.Get())
+	require.Equal(t, 3, high.Len())
+	require.Equal(t, int64(1), high.MetricsDropped.Get())
+
+	// Metrics of outstanding batches are not dropped and released once
+	// written.
+	batch := high.Batch(3)
+	require.Equal(t, []telegraf.Metric{MetricTime(2), MetricTime(5), MetricTime(6)}, batch)
+	high.Add(MetricTime(7))
+	require.Equal(t, 3*size, memory.Used())
+	require.Equal(t, int64(2), high.MetricsDropped.Get())
+
+	high.Reject(batch)
+	require.Equal(t, 3*size, memory.Used())
+	batch = high.Batch(3)
+	high.Accept(batch)
+	require.Equal(t, int64(0), memory.Used())
+	require.Equal(t, 0, high.Len())
+
+	high.Add(MetricTime(8))
+	require.Equal(t, size, memory.Used())
+
+	// Closing a buffer releases its memory.
+	require.NoError(t, high.Close())
+	require.NoError(t, low.Close())
+	require.Equal(t, int64(0), memory.Used())
+	require.Empty(t, memory.buffers)
+}
+
+func TestBufferMemoryLargestFirst(t *testing.T) {
+	size := metricSize(Metric())
+	memory := NewBufferMemory(3 * size)
+
+	a := setup(NewBuffer("a", "", 10))
+	a.SetMemory(memory, 0)
+	b := setup(NewBuffer("b", "", 10))
+	b.SetMemory(memory, 0)
+
+	// Among buffers of the same priority the largest is dropped from.
+	a.Add(MetricTime(1))
+	b.Add(MetricTime(2), MetricTime(3), MetricTime(4))
+	require.Equal(t, 3*size, memory.Used())
+	require.Equal(t, 1, a.Len())
+	require.Equal(t, 2, b.Len())
+
+	batch := b.Batch(2)
+	require.Equal(t, []telegraf.Metric{MetricTime(3), MetricTime(4)}, batch)
+}
@@ -726,3 +726,46 @@ func TestBuffer_RejectEmptyBatch(t *testing.T) {
 		require.NotNil(t, m)
 	}
 }
+
+func TestBuffer_Drain(t *testing.T) {
+	var accept int
+	mm := &MockMetric{
+		Metric: Metric(),
+		AcceptF: func() {
+			accept++
+		},
+	}
+	b := setup(NewBuffer("test", "", 5))
+	b.Add(MetricTime(1), MetricTime(2), MetricTime(3), MetricTime(4), MetricTime(5), MetricTime(6))
+	b.Add(mm)
+
+	drained := b.Drain()
+	require.Equal(t, 0, b.Len())
+	require.Equal(t, 5, len(drained))
+	require.Equal(t, []telegraf.Metric{MetricTime(4), MetricTime(5), MetricTime(6)}, drained[1:4])
+	require.Equal(t, 0, accept)
+	require.Equal(t, int64(0), b.MetricsWritten.Get())
+
+	b.Add(MetricTime(7))
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{MetricTime(7)}, b.Batch(5))
+}
+
+func TestBuffer_ConcurrentBatches(t *testing.T) {
+	b := setup(NewBuffer("test", "", 10))
+	b.Add(MetricTime(1), MetricTime(2), MetricTime(3), MetricTime(4), MetricTime(5))
+
+	first := b.Batch(2)
+	second := b.Batch(2)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{MetricTime(1), MetricTime(2)}, first)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{MetricTime(3), MetricTime(4)}, second)
+	require.Equal(t, 5, b.Len())
+
+	b.Accept(second)
+	require.Equal(t, 3, b.Len())
+	require.Equal(t, int64(2), b.MetricsWritten.Get())
+
+	b.Reject(first)
+	require.Equal(t, 3, b.Len())
+	testutil.RequireMetricsEqual(t,
+		[]telegraf.Metric{MetricTime(1), MetricTime(2), MetricTime(5)}, b.Batch(5))
+}
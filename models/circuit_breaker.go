@@ -0,0 +1,197 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+const (
+	// Default maximum delay between retries of a failing output.
+	DEFAULT_RETRY_MAX_BACKOFF = 5 * time.Minute
+)
+
+// Circuit breaker states, reported by the breaker_state selfstat.
+const (
+	BreakerClosed = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// CircuitBreaker limits how often writes are attempted on a failing output.
+//
+// After each failed write the next write is delayed, starting with the
+// initial backoff and doubling on each consecutive failure up to the maximum
+// backoff.  Once the number of consecutive failures reaches the threshold the
+// breaker opens and no writes are attempted for the open timeout, after which
+// a single probe write is allowed in the half-open state.  A successful write
+// closes the breaker.
+type CircuitBreaker struct {
+	sync.Mutex
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	jitter         time.Duration
+	threshold      int
+	openTimeout    time.Duration
+
+	state       int
+	failures    int
+	nextAttempt time.Time
+
+	now func() time.Time
+
+	BreakerState        selfstat.Stat
+	BreakerTrips        selfstat.Stat
+	ConsecutiveFailures selfstat.Stat
+	WritesSkipped       selfstat.Stat
+}
+
+// NewCircuitBreaker creates a breaker for the output.  When the initial backoff
+// and the failure threshold are both zero the breaker never delays writes.
+func NewCircuitBreaker(config *OutputConfig, tags map[string]string) *CircuitBreaker {
+	maxBackoff := config.RetryMaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DEFAULT_RETRY_MAX_BACKOFF
+	}
+	if maxBackoff < config.RetryInitialBackoff {
+		maxBackoff = config.RetryInitialBackoff
+	}
+
+	openTimeout := config.BreakerOpenTimeout
+	if openTimeout == 0 {
+		openTimeout = maxBackoff
+	}
+
+	return &CircuitBreaker{
+		initialBackoff: config.RetryInitialBackoff,
+		maxBackoff:     maxBackoff,
+		jitter:         config.RetryJitter,
+		threshold:      config.BreakerFailureThreshold,
+		openTimeout:    openTimeout,
+		now:            time.Now,
+		BreakerState: selfstat.Register(
+			"write",
+			"breaker_state",
+			tags,
+		),
+		BreakerTrips: selfstat.Register(
+			"write",
+			"breaker_trips",
+			tags,
+		),
+		ConsecutiveFailures: selfstat.Register(
+			"write",
+			"consecutive_failures",
+			tags,
+		),
+		WritesSkipped: selfstat.Register(
+			"write",
+			"writes_skipped",
+			tags,
+		),
+	}
+}
+
+// Allow returns true if a write should be attempted now.  When the breaker is
+// open and the open timeout has elapsed a probe is allowed, the breaker moves
+// to the half-open state once the probe is sent, see Attempt.
+func (b *CircuitBreaker) Allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		// Only a single probe is allowed until its result is known.
+		b.WritesSkipped.Incr(1)
+		return false
+	default:
+		if b.now().Before(b.nextAttempt) {
+			b.WritesSkipped.Incr(1)
+			return false
+		}
+		return true
+	}
+}
+
+// Attempt records that a write is sent.  A write sent while the breaker is
+// open and the open timeout has elapsed is the probe, the breaker moves to the
+// half-open state until its result is recorded.  The breaker stays open while
+// no write is sent, such as when the batch is empty.
+func (b *CircuitBreaker) Attempt() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == BreakerOpen && !b.now().Before(b.nextAttempt) {
+		b.setState(BreakerHalfOpen)
+	}
+}
+
+// Success records a successful write and closes the breaker.  It returns true
+// if the breaker was not closed before.
+func (b *CircuitBreaker) Success() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	recovered := b.state != BreakerClosed
+	b.failures = 0
+	b.nextAttempt = time.Time{}
+	b.ConsecutiveFailures.Set(0)
+	b.setState(BreakerClosed)
+	return recovered
+}
+
+// Failure records a failed write and returns the delay until the next write
+// is allowed.  It returns true if the breaker opened due to this failure.
+func (b *CircuitBreaker) Failure() (time.Duration, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.failures++
+	b.ConsecutiveFailures.Set(int64(b.failures))
+
+	now := b.now()
+	if b.state == BreakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		opened := b.state != BreakerOpen
+		if opened {
+			b.BreakerTrips.Incr(1)
+		}
+		b.setState(BreakerOpen)
+		b.nextAttempt = now.Add(b.openTimeout)
+		return b.openTimeout, opened
+	}
+
+	delay := b.backoff()
+	b.nextAttempt = now.Add(delay)
+	return delay, false
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
+
+// backoff returns the delay after the current number of consecutive failures.
+func (b *CircuitBreaker) backoff() time.Duration {
+	if b.initialBackoff == 0 {
+		return 0
+	}
+
+	delay := b.initialBackoff
+	for i := 1; i < b.failures && delay < b.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > b.maxBackoff {
+		delay = b.maxBackoff
+	}
+	return delay + internal.RandomDuration(b.jitter)
+}
+
+func (b *CircuitBreaker) setState(state int) {
+	b.state = state
+	b.BreakerState.Set(int64(state))
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestCircuitBreaker(config *OutputConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := NewCircuitBreaker(config, map[string]string{"output": "test"})
+	b.now = clock.Now
+	b.BreakerTrips.Set(0)
+	b.WritesSkipped.Set(0)
+	return b, clock
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b, _ := newTestCircuitBreaker(&OutputConfig{})
+
+	for i := 0; i < 10; i++ {
+		require.True(t, b.Allow())
+		delay, opened := b.Failure()
+		require.Equal(t, time.Duration(0), delay)
+		require.False(t, opened)
+	}
+	require.Equal(t, BreakerClosed, b.State())
+	require.Equal(t, int64(10), b.ConsecutiveFailures.Get())
+}
+
+func TestCircuitBreaker_ExponentialBackoff(t *testing.T) {
+	b, clock := newTestCircuitBreaker(&OutputConfig{
+		RetryInitialBackoff: time.Second,
+		RetryMaxBackoff:     5 * time.Second,
+	})
+
+	expected := []time.Duration{
+		1 * time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for _, e := range expected {
+		require.True(t, b.Allow())
+		delay, opened := b.Failure()
+		require.False(t, opened)
+		require.Equal(t, e, delay)
+
+		clock.Add(delay - time.Millisecond)
+		require.False(t, b.Allow())
+		clock.Add(time.Millisecond)
+	}
+
+	require.True(t, b.Allow())
+	require.False(t, b.Success())
+	require.Equal(t, int64(0), b.ConsecutiveFailures.Get())
+
+	delay, _ := b.Failure()
+	require.Equal(t, time.Second, delay)
+}
+
+func TestCircuitBreaker_Jitter(t *testing.T) {
+	b, _ := newTestCircuitBreaker(&OutputConfig{
+		RetryInitialBackoff: time.Second,
+		RetryJitter:         time.Second,
+	})
+
+	delay, _ := b.Failure()
+	require.True(t, delay >= time.Second && delay < 2*time.Second)
+}
+
+func TestCircuitBreaker_OpenHalfOpenClosed(t *testing.T) {
+	b, clock := newTestCircuitBreaker(&OutputConfig{
+		BreakerFailureThreshold: 3,
+		BreakerOpenTimeout:      time.Minute,
+	})
+
+	b.Failure()
+	b.Failure()
+	require.Equal(t, BreakerClosed, b.State())
+
+	delay, opened := b.Failure()
+	require.True(t, opened)
+	require.Equal(t, time.Minute, delay)
+	require.Equal(t, BreakerOpen, b.State())
+	require.Equal(t, int64(BreakerOpen), b.BreakerState.Get())
+	require.Equal(t, int64(1), b.BreakerTrips.Get())
+
+	clock.Add(30 * time.Second)
+	require.False(t, b.Allow())
+
+	// The breaker stays open until a probe is sent.
+	clock.Add(30 * time.Second)
+	require.True(t, b.Allow())
+	require.Equal(t, BreakerOpen, b.State())
+	require.True(t, b.Allow())
+
+	// A failed probe opens the breaker again.
+	b.Attempt()
+	require.Equal(t, BreakerHalfOpen, b.State())
+	require.False(t, b.Allow())
+	_, opened = b.Failure()
+	require.True(t, opened)
+	require.Equal(t, BreakerOpen, b.State())
+	require.Equal(t, int64(2), b.BreakerTrips.Get())
+
+	// A successful probe closes the breaker.
+	clock.Add(time.Minute)
+	require.True(t, b.Allow())
+	b.Attempt()
+	require.True(t, b.Success())
+	require.Equal(t, BreakerClosed, b.State())
+	require.Equal(t, int64(BreakerClosed), b.BreakerState.Get())
+	require.True(t, b.Allow())
+	require.Equal(t, int64(2), b.WritesSkipped.Get())
+}
+
+func TestRunningOutput_EmptyProbe(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:                  Filter{},
+		BreakerFailureThreshold: 1,
+		BreakerOpenTimeout:      time.Minute,
+	}
+
+	m := &mockOutput{}
+	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro.log = testutil.Logger{}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	ro.breaker.now = clock.Now
+
+	m.failWrite = true
+	ro.AddMetric(testutil.TestMetric(1, "metric"))
+	require.Error(t, ro.Write())
+	require.Equal(t, BreakerOpen, ro.BreakerState())
+
+	// The probe is allowed, but no batch is sent, as when the buffer was
+	// emptied by another output of the group.
+	clock.Add(time.Minute)
+	require.True(t, ro.allowWrite())
+	require.Equal(t, BreakerOpen, ro.BreakerState())
+
+	m.failWrite = false
+	require.NoError(t, ro.WriteBatch())
+	require.Len(t, m.Metrics(), 1)
+	require.Equal(t, BreakerClosed, ro.BreakerState())
+}
+
+func TestRunningOutput_SkipsWriteWhileBackingOff(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:                  Filter{},
+		BreakerFailureThreshold: 1,
+		BreakerOpenTimeout:      time.Hour,
+	}
+
+	m := &mockOutput{}
+	m.failWrite = true
+	ro := NewRunningOutput("test", m, conf, 1000, 10000)
+	ro.log = testutil.Logger{}
+
+	for _, metric := range first5 {
+		ro.AddMetric(metric)
+	}
+
+	require.Error(t, ro.Write())
+	require.Equal(t, BreakerOpen, ro.breaker.State())
+
+	// Writes are skipped without calling the output while the breaker is open.
+	m.failWrite = false
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 0)
+	require.Equal(t, 5, ro.BufferLength())
+}
@@ -0,0 +1,677 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+const (
+	// Maximum size of a single segment file of a DiskBuffer.
+	diskBufferSegmentSize = 8 * 1024 * 1024
+
+	// Minimum size of a segment file when the size cap is small.
+	diskBufferMinSegmentSize = 64 * 1024
+
+	// Size of the record header: length and crc32 of the record data.
+	diskRecordHeaderSize = 8
+
+	segmentSuffix = ".seg"
+	headFilename  = "head"
+	lockFilename  = "lock"
+)
+
+// segment is a single file of the DiskBuffer.  Records are numbered
+// sequentially across all segments and the file is named after the number of
+// its first record.
+type segment struct {
+	path    string
+	first   int64   // number of the first record in the segment
+	offsets []int64 // file offset of each record
+	size    int64   // size of the file in bytes
+}
+
+// end returns one after the number of the last record in the segment.
+func (s *segment) end() int64 {
+	return s.first + int64(len(s.offsets))
+}
+
+// diskMetric is the on-disk representation of a metric.
+type diskMetric struct {
+	Name      string
+	Tags      map[string]string
+	Fields    map[string]interface{}
+	Time      time.Time
+	Type      telegraf.ValueType
+	Aggregate bool
+}
+
+// DiskBuffer stores metrics in append-only segment files so that unwritten
+// metrics survive a restart of the agent.  Metrics are replayed in the order
+// they were added.
+//
+// Once a metric is persisted it is accepted, tracking metrics are considered
+// delivered as soon as they are stored on disk.  Segment files are synced when
+// they are rotated and when the buffer is closed.
+type DiskBuffer struct {
+	sync.Mutex
+	dir         string
+	lock        *os.File // locked while the buffer is open
+	cap         int      // maximum number of metrics in the buffer
+	maxSize     int64    // maximum size of all segments in bytes, 0 is unlimited
+	segmentSize int64
+
+	segments []*segment
+	file     *os.File // last segment, opened for appending
+	size     int64    // size of all segments in bytes
+
+	head     int64 // number of the oldest record not yet written
+	tail     int64 // one after the number of the newest record
+	batchEnd int64 // one after the number of the last record in the batch
+	batching bool  // true while a batch is out for writing
+
+	log telegraf.Logger
+
+	bufferStats
+	DiskSize     selfstat.Stat
+	DiskSegments selfstat.Stat
+}
+
+// NewDiskBuffer opens the disk buffer stored in dir, creating it if it does not
+// exist.  Metrics left over from a previous run are available immediately.
+// The directory is locked until the buffer is closed, it cannot be opened by
+// another process meanwhile.
+func NewDiskBuffer(
+	name string,
+	alias string,
+	capacity int,
+	dir string,
+	maxSize int64,
+	log telegraf.Logger,
+) (*DiskBuffer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentSize := int64(diskBufferSegmentSize)
+	if maxSize > 0 && maxSize/4 < segmentSize {
+		segmentSize = maxSize / 4
+	}
+	if segmentSize < diskBufferMinSegmentSize {
+		segmentSize = diskBufferMinSegmentSize
+	}
+
+	tags := bufferTags(name, alias)
+	b := &DiskBuffer{
+		dir:         dir,
+		lock:        lock,
+		cap:         capacity,
+		maxSize:     maxSize,
+		segmentSize: segmentSize,
+		log:         log,
+
+		bufferStats: newBufferStats(tags, capacity),
+		DiskSize: selfstat.Register(
+			"write",
+			"buffer_disk_bytes",
+			tags,
+		),
+		DiskSegments: selfstat.Register(
+			"write",
+			"buffer_disk_segments",
+			tags,
+		),
+	}
+
+	if err := b.load(); err != nil {
+		b.closeFile()
+		lock.Close()
+		return nil, err
+	}
+
+	if n := b.length(); n > 0 {
+		b.log.Infof("Loaded %d metrics from disk buffer %s", n, dir)
+	}
+	b.updateStats()
+	return b, nil
+}
+
+// load scans the segment files in the buffer directory and restores the
+// position of the oldest unwritten record.
+func (b *DiskBuffer) load() error {
+	files, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range files {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+
+		first, err := strconv.ParseInt(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			b.log.Warnf("Ignoring unexpected file %q in disk buffer", name)
+			continue
+		}
+
+		s, err := b.scanSegment(filepath.Join(b.dir, name), first)
+		if err != nil {
+			return err
+		}
+		b.segments = append(b.segments, s)
+		b.size += s.size
+	}
+
+	sort.Slice(b.segments, func(i, j int) bool {
+		return b.segments[i].first < b.segments[j].first
+	})
+
+	head, err := b.readHead()
+	if err != nil {
+		return err
+	}
+	b.head = head
+
+	if len(b.segments) > 0 {
+		last := b.segments[len(b.segments)-1]
+		if b.head < b.segments[0].first {
+			b.head = b.segments[0].first
+		}
+		b.tail = last.end()
+		if b.head > b.tail {
+			b.tail = b.head
+		}
+
+		b.file, err = os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+	} else {
+		b.tail = b.head
+	}
+
+	b.removeWritten()
+	return nil
+}
+
+// scanSegment indexes the records of a segment file.  A partially written
+// record at the end of the file, as left by a crash, is truncated.
+func (b *DiskBuffer) scanSegment(path string, first int64) (*segment, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &segment{path: path, first: first}
+
+	header := make([]byte, diskRecordHeaderSize)
+	for {
+		_, err := io.ReadFull(f, header)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			length := int64(binary.BigEndian.Uint32(header[0:4]))
+			data := make([]byte, length)
+			if _, err = io.ReadFull(f, data); err == nil {
+				if crc32.ChecksumIEEE(data) == binary.BigEndian.Uint32(header[4:8]) {
+					s.offsets = append(s.offsets, s.size)
+					s.size += diskRecordHeaderSize + length
+					continue
+				}
+			}
+		}
+
+		b.log.Warnf("Truncating corrupt disk buffer segment %q after %d records",
+			path, len(s.offsets))
+		if err := f.Truncate(s.size); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	return s, nil
+}
+
+func (b *DiskBuffer) readHead() (int64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(b.dir, headFilename))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	head, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		b.log.Warnf("Ignoring corrupt disk buffer position: %v", err)
+		return 0, nil
+	}
+	return head, nil
+}
+
+// writeHead persists the position of the oldest unwritten record.
+func (b *DiskBuffer) writeHead() {
+	path := filepath.Join(b.dir, headFilename)
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(b.head, 10)+"\n"), 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		b.log.Errorf("Error saving disk buffer position: %v", err)
+	}
+}
+
+// Len returns the number of metrics currently in the buffer.
+func (b *DiskBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.length()
+}
+
+func (b *DiskBuffer) length() int {
+	n := int64(0)
+	for _, s := range b.segments {
+		if s.end() <= b.head {
+			continue
+		}
+		if s.first >= b.head {
+			n += int64(len(s.offsets))
+		} else {
+			n += s.end() - b.head
+		}
+	}
+	return int(n)
+}
+
+func (b *DiskBuffer) metricAdded() {
+	b.MetricsAdded.Incr(1)
+}
+
+func (b *DiskBuffer) metricWritten(metric telegraf.Metric) {
+	AgentMetricsWritten.Incr(1)
+	b.MetricsWritten.Incr(1)
+	metric.Accept()
+}
+
+func (b *DiskBuffer) metricDropped() {
+	AgentMetricsDropped.Incr(1)
+	b.MetricsDropped.Incr(1)
+}
+
+// Add adds metrics to the buffer and returns number of dropped metrics.
+func (b *DiskBuffer) Add(metrics ...telegraf.Metric) int {
+	b.Lock()
+	defer b.Unlock()
+
+	dropped := 0
+	for _, m := range metrics {
+		dropped += b.add(m)
+	}
+
+	b.updateStats()
+	return dropped
+}
+
+func (b *DiskBuffer) add(m telegraf.Metric) int {
+	data, err := encodeDiskMetric(m)
+	if err != nil {
+		b.log.Errorf("Error encoding metric for disk buffer: %v", err)
+		b.metricDropped()
+		m.Reject()
+		return 1
+	}
+
+	dropped := 0
+	recordSize := int64(diskRecordHeaderSize + len(data))
+	for b.maxSize > 0 && b.size+recordSize > b.maxSize && b.size > 0 {
+		// Segments are dropped as a whole, the last segment is rotated
+		// first so that it can be dropped.
+		if len(b.segments) == 1 {
+			if err := b.rotate(); err != nil {
+				b.log.Errorf("Error rotating disk buffer segment: %v", err)
+				break
+			}
+		}
+		dropped += b.dropSegment()
+	}
+
+	if b.length() >= b.cap {
+		b.dropOldest()
+		dropped++
+	}
+
+	if err := b.write(data); err != nil {
+		b.log.Errorf("Error writing metric to disk buffer: %v", err)
+		b.metricDropped()
+		m.Reject()
+		return dropped + 1
+	}
+
+	b.metricAdded()
+	m.Accept()
+	return dropped
+}
+
+// write appends a record to the last segment, starting a new segment when the
+// last one is full.
+func (b *DiskBuffer) write(data []byte) error {
+	if b.file == nil || b.segments[len(b.segments)-1].size >= b.segmentSize {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+	s := b.segments[len(b.segments)-1]
+
+	record := make([]byte, diskRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[diskRecordHeaderSize:], data)
+
+	n, err := b.file.Write(record)
+	if err != nil {
+		// Remove any partial record so the segment stays readable.
+		if n > 0 {
+			b.file.Truncate(s.size)
+		}
+		return err
+	}
+
+	s.offsets = append(s.offsets, s.size)
+	s.size += int64(n)
+	b.size += int64(n)
+	b.tail++
+	return nil
+}
+
+// rotate closes the last segment and starts a new one.
+func (b *DiskBuffer) rotate() error {
+	if err := b.closeFile(); err != nil {
+		return err
+	}
+
+	// An empty last segment is replaced instead of leaving it behind.
+	if n := len(b.segments); n > 0 && len(b.segments[n-1].offsets) == 0 {
+		b.segments = b.segments[:n-1]
+	}
+
+	path := filepath.Join(b.dir, fmt.Sprintf("%020d%s", b.tail, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	b.file = f
+	b.segments = append(b.segments, &segment{path: path, first: b.tail})
+	return nil
+}
+
+func (b *DiskBuffer) closeFile() error {
+	if b.file == nil {
+		return nil
+	}
+
+	err := b.file.Sync()
+	if cerr := b.file.Close(); err == nil {
+		err = cerr
+	}
+	b.file = nil
+	return err
+}
+
+// dropOldest drops the oldest record in the buffer, which may be part of
+// the current batch.
+func (b *DiskBuffer) dropOldest() {
+	for _, s := range b.segments {
+		if b.head < s.first {
+			b.head = s.first
+		}
+		if b.head < s.end() {
+			b.head++
+			break
+		}
+	}
+	b.metricDropped()
+	b.removeWritten()
+}
+
+// dropSegment drops all records in the oldest segment and returns the number
+// of dropped records.
+func (b *DiskBuffer) dropSegment() int {
+	s := b.segments[0]
+	dropped := 0
+	if s.end() > b.head {
+		dropped = int(s.end() - b.head)
+		if s.first > b.head {
+			dropped = len(s.offsets)
+		}
+	}
+	for i := 0; i < dropped; i++ {
+		b.metricDropped()
+	}
+
+	b.head = s.end()
+	b.removeWritten()
+	return dropped
+}
+
+// removeWritten deletes the segment files that only contain records that
+// have been written, the last segment is kept for appending.
+func (b *DiskBuffer) removeWritten() {
+	for len(b.segments) > 1 && b.segments[0].end() <= b.head {
+		s := b.segments[0]
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			b.log.Errorf("Error removing disk buffer segment: %v", err)
+		}
+		b.size -= s.size
+		b.segments = b.segments[1:]
+	}
+}
+
+// Batch returns a slice containing up to batchSize of the oldest metrics not
+// yet dropped.  Metrics are ordered from oldest to newest in the batch.
+func (b *DiskBuffer) Batch(batchSize int) []telegraf.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.batch(batchSize)
+}
+
+func (b *DiskBuffer) batch(batchSize int) []telegraf.Metric {
+	out := make([]telegraf.Metric, 0, min(b.length(), batchSize))
+	index := b.head
+	stop := false
+	for _, s := range b.segments {
+		if len(out) >= batchSize || stop {
+			break
+		}
+		if index < s.first {
+			index = s.first
+		}
+		if index >= s.end() {
+			continue
+		}
+
+		f, err := os.Open(s.path)
+		if err != nil {
+			b.log.Errorf("Error opening disk buffer segment: %v", err)
+			break
+		}
+		for ; index < s.end() && len(out) < batchSize; index++ {
+			m, err := readDiskMetric(f, s.offsets[index-s.first])
+			if err != nil {
+				// An unreadable record is dropped by moving the head past
+				// it, so that it is counted once.  Records before it must
+				// be written first, the batch ends before it.
+				if index != b.head {
+					stop = true
+					break
+				}
+				b.log.Errorf("Error reading metric from disk buffer, dropping: %v", err)
+				b.head++
+				b.metricDropped()
+				continue
+			}
+			out = append(out, m)
+		}
+		f.Close()
+	}
+
+	b.batchEnd = index
+	b.batching = true
+	return out
+}
+
+// Accept marks the batch, acquired from Batch(), as successfully written.
+func (b *DiskBuffer) Accept(batch []telegraf.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, m := range batch {
+		b.metricWritten(m)
+	}
+
+	if b.batching && b.batchEnd > b.head {
+		b.head = b.batchEnd
+	}
+	b.batching = false
+	b.removeWritten()
+	b.writeHead()
+	b.updateStats()
+}
+
+// Reject returns the batch, acquired from Batch(), to the buffer and marks it
+// as unsent.  The metrics remain on disk and are read again by the next call
+// to Batch().
+func (b *DiskBuffer) Reject(batch []telegraf.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.batching = false
+	b.removeWritten()
+	b.updateStats()
+}
+
+// Drain removes and returns all metrics in the buffer without marking them as
+// written.
+func (b *DiskBuffer) Drain() []telegraf.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	// A batch ends before an unreadable record that is not the oldest, the
+	// record is dropped by the next batch.
+	var out []telegraf.Metric
+	for b.length() > 0 {
+		out = append(out, b.batch(b.length())...)
+		if b.batchEnd > b.head {
+			b.head = b.batchEnd
+		}
+	}
+	b.batching = false
+	b.removeWritten()
+	b.writeHead()
+	b.updateStats()
+	return out
+}
+
+// Close syncs the segment files and saves the position in the buffer.
+func (b *DiskBuffer) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.writeHead()
+	err := b.closeFile()
+	if cerr := b.lock.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// lockDir takes the lock of the buffer directory, the lock is released when
+// the returned file is closed.
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFilename), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("disk buffer %s is in use by another process: %v", dir, err)
+	}
+	return f, nil
+}
+
+func (b *DiskBuffer) updateStats() {
+	b.BufferSize.Set(int64(b.length()))
+	b.DiskSize.Set(b.size)
+	b.DiskSegments.Set(int64(len(b.segments)))
+}
+
+func encodeDiskMetric(m telegraf.Metric) ([]byte, error) {
+	dm := diskMetric{
+		Name:      m.Name(),
+		Tags:      m.Tags(),
+		Fields:    m.Fields(),
+		Time:      m.Time(),
+		Type:      m.Type(),
+		Aggregate: m.IsAggregate(),
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&dm); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readDiskMetric(r io.ReaderAt, offset int64) (telegraf.Metric, error) {
+	header := make([]byte, diskRecordHeaderSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := r.ReadAt(data, offset+diskRecordHeaderSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	var dm diskMetric
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&dm); err != nil {
+		return nil, err
+	}
+
+	m, err := metric.New(dm.Name, dm.Tags, dm.Fields, dm.Time, dm.Type)
+	if err != nil {
+		return nil, err
+	}
+	m.SetAggregate(dm.Aggregate)
+	return m, nil
+}
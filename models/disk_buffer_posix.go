@@ -0,0 +1,13 @@
+// +build !windows
+
+package models
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the file without waiting for it.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskBuffer(t *testing.T, dir string, capacity int, maxSize int64) *DiskBuffer {
+	b, err := NewDiskBuffer("test", "", capacity, dir, maxSize, testutil.Logger{})
+	require.NoError(t, err)
+	b.MetricsAdded.Set(0)
+	b.MetricsWritten.Set(0)
+	b.MetricsDropped.Set(0)
+	return b
+}
+
+func diskTestMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"value": 42.0, "count": int64(1)},
+			time.Unix(1, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": uint64(8), "ok": true, "state": "idle"},
+			time.Unix(2, 0),
+			telegraf.Gauge),
+		testutil.MustMetric("disk",
+			map[string]string{"path": "/"},
+			map[string]interface{}{"used": int64(3)},
+			time.Unix(3, 0)),
+	}
+}
+
+func TestDiskBuffer_BatchAccept(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+
+	metrics := diskTestMetrics()
+	require.Equal(t, 0, b.Add(metrics...))
+	require.Equal(t, 3, b.Len())
+
+	batch := b.Batch(2)
+	testutil.RequireMetricsEqual(t, metrics[:2], batch)
+	b.Accept(batch)
+	require.Equal(t, 1, b.Len())
+
+	batch = b.Batch(2)
+	testutil.RequireMetricsEqual(t, metrics[2:], batch)
+	b.Accept(batch)
+	require.Equal(t, 0, b.Len())
+
+	require.Equal(t, int64(3), b.MetricsAdded.Get())
+	require.Equal(t, int64(3), b.MetricsWritten.Get())
+	require.Equal(t, int64(0), b.MetricsDropped.Get())
+}
+
+func TestDiskBuffer_RejectKeepsMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+
+	metrics := diskTestMetrics()
+	b.Add(metrics...)
+
+	batch := b.Batch(2)
+	b.Reject(batch)
+	require.Equal(t, 3, b.Len())
+
+	batch = b.Batch(5)
+	testutil.RequireMetricsEqual(t, metrics, batch)
+}
+
+func TestDiskBuffer_ReplayAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	metrics := diskTestMetrics()
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	b.Add(metrics...)
+	b.Accept(b.Batch(1))
+	require.NoError(t, b.Close())
+
+	b = newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+	require.Equal(t, 2, b.Len())
+
+	batch := b.Batch(5)
+	testutil.RequireMetricsEqual(t, metrics[1:], batch)
+}
+
+func TestDiskBuffer_Locked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	_, err = NewDiskBuffer("test", "", 100, dir, 0, testutil.Logger{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disk buffer "+dir+" is in use by another process")
+
+	// The lock is released when the buffer is closed.
+	require.NoError(t, b.Close())
+	b = newTestDiskBuffer(t, dir, 100, 0)
+	require.NoError(t, b.Close())
+}
+
+func TestDiskBuffer_TruncatedRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	metrics := diskTestMetrics()
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	b.Add(metrics...)
+	require.NoError(t, b.Close())
+
+	// Simulate a crash in the middle of writing the last record.
+	path := b.segments[0].path
+	require.NoError(t, os.Truncate(path, b.segments[0].size-3))
+
+	b = newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+	require.Equal(t, 2, b.Len())
+
+	b.Add(metrics[2])
+	batch := b.Batch(5)
+	testutil.RequireMetricsEqual(t, metrics, batch)
+}
+
+func TestDiskBuffer_CapacityDropsOldest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 2, 0)
+	defer b.Close()
+
+	metrics := diskTestMetrics()
+	require.Equal(t, 1, b.Add(metrics...))
+	require.Equal(t, 2, b.Len())
+	require.Equal(t, int64(1), b.MetricsDropped.Get())
+
+	batch := b.Batch(5)
+	testutil.RequireMetricsEqual(t, metrics[1:], batch)
+}
+
+func TestDiskBuffer_MaxSizeDropsSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	maxSize := int64(4 * diskBufferMinSegmentSize)
+	b := newTestDiskBuffer(t, dir, 1000000, maxSize)
+	defer b.Close()
+
+	for i := 0; i < 10000; i++ {
+		b.Add(MetricTime(int64(i)))
+	}
+
+	require.True(t, b.size <= maxSize, "size %d exceeds %d", b.size, maxSize)
+	require.True(t, b.MetricsDropped.Get() > 0)
+	require.Equal(t, int64(10000), int64(b.Len())+b.MetricsDropped.Get())
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	require.NoError(t, err)
+	require.Equal(t, len(b.segments), len(files))
+	require.Equal(t, int64(len(files)), b.DiskSegments.Get())
+}
+
+func TestDiskBuffer_MaxSizeSingleSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The limit is below the minimum segment size, all records fit in one
+	// segment.
+	maxSize := int64(1000)
+	b := newTestDiskBuffer(t, dir, 1000000, maxSize)
+	defer b.Close()
+
+	for i := 0; i < 100; i++ {
+		b.Add(MetricTime(int64(i)))
+		require.True(t, b.size <= maxSize, "size %d exceeds %d", b.size, maxSize)
+	}
+	require.True(t, b.MetricsDropped.Get() > 0)
+	require.Equal(t, int64(100), int64(b.Len())+b.MetricsDropped.Get())
+}
+
+func TestDiskBuffer_UnreadableRecordDroppedOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+
+	metrics := diskTestMetrics()
+	b.Add(metrics...)
+
+	// Corrupt the data of the second record.
+	s := b.segments[0]
+	f, err := os.OpenFile(s.path, os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff}, s.offsets[1]+diskRecordHeaderSize+2)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// The batch ends before the unreadable record.
+	for i := 0; i < 2; i++ {
+		batch := b.Batch(5)
+		testutil.RequireMetricsEqual(t, metrics[:1], batch)
+		require.Equal(t, int64(0), b.MetricsDropped.Get())
+		b.Reject(batch)
+	}
+	b.Accept(b.Batch(5))
+
+	// Once it is the oldest record it is dropped, rejecting the batch does
+	// not count it again.
+	for i := 0; i < 2; i++ {
+		batch := b.Batch(5)
+		testutil.RequireMetricsEqual(t, metrics[2:], batch)
+		require.Equal(t, int64(1), b.MetricsDropped.Get())
+		b.Reject(batch)
+	}
+	require.Equal(t, 1, b.Len())
+}
+
+func TestDiskBuffer_AcceptsTrackingMetricOnAdd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+
+	var accept int
+	mm := &MockMetric{
+		Metric: Metric(),
+		AcceptF: func() {
+			accept++
+		},
+	}
+	b.Add(mm)
+	require.Equal(t, 1, accept)
+}
+
+func TestDiskBuffer_Drain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disk-buffer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestDiskBuffer(t, dir, 100, 0)
+	defer b.Close()
+
+	metrics := diskTestMetrics()
+	b.Add(metrics...)
+
+	testutil.RequireMetricsEqual(t, metrics, b.Drain())
+	require.Equal(t, 0, b.Len())
+	require.Equal(t, int64(0), b.MetricsWritten.Get())
+
+	b.Add(metrics[0])
+	testutil.RequireMetricsEqual(t, metrics[:1], b.Batch(5))
+}
@@ -2,9 +2,12 @@ package models
 
 import (
 	"fmt"
+	"log"
+	"sync/atomic"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal/expr"
 )
 
 // TagFilter is the name of a tag, and the values on which to filter
@@ -34,6 +37,13 @@ type Filter struct {
 	TagInclude []string
 	tagInclude filter.Filter
 
+	// MetricPass is an expression on the name, tags and fields of the
+	// metric, only metrics for which it is true pass.
+	MetricPass string
+	metricPass *expr.Expression
+	// evalErrorLogged is set once an error evaluating metricpass is logged.
+	evalErrorLogged int32
+
 	isActive bool
 }
 
@@ -46,7 +56,8 @@ func (f *Filter) Compile() error {
 		len(f.TagInclude) == 0 &&
 		len(f.TagExclude) == 0 &&
 		len(f.TagPass) == 0 &&
-		len(f.TagDrop) == 0 {
+		len(f.TagDrop) == 0 &&
+		f.MetricPass == "" {
 		return nil
 	}
 
@@ -91,11 +102,19 @@ func (f *Filter) Compile() error {
 			return fmt.Errorf("Error compiling 'tagpass', %s", err)
 		}
 	}
+
+	if f.MetricPass != "" {
+		f.metricPass, err = expr.Compile(f.MetricPass)
+		if err != nil {
+			return fmt.Errorf("Error compiling 'metricpass', %s", err)
+		}
+	}
 	return nil
 }
 
 // Select returns true if the metric matches according to the
-// namepass/namedrop and tagpass/tagdrop filters.  The metric is not modified.
+// namepass/namedrop, tagpass/tagdrop and metricpass filters.  The metric is
+// not modified.
 func (f *Filter) Select(metric telegraf.Metric) bool {
 	if !f.isActive {
 		return true
@@ -109,6 +128,23 @@ func (f *Filter) Select(metric telegraf.Metric) bool {
 		return false
 	}
 
+	// Metrics on which the expression cannot be evaluated, such as a string
+	// field compared to a number, do not pass.  Only the first error is
+	// logged as it likely applies to every metric.
+	if f.metricPass != nil {
+		pass, err := f.metricPass.Eval(metric)
+		if err != nil {
+			if atomic.CompareAndSwapInt32(&f.evalErrorLogged, 0, 1) {
+				log.Printf("W! [filter] Metrics on which metricpass %q cannot be evaluated do not pass, metric %s: %v",
+					f.MetricPass, metric.Name(), err)
+			}
+			return false
+		}
+		if !pass {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -523,3 +527,72 @@ func BenchmarkFilter(b *testing.B) {
 		})
 	}
 }
+
+func TestFilter_MetricPass(t *testing.T) {
+	f := Filter{
+		MetricPass: `fields.status != 200 && tags.host startsWith 'db'`,
+	}
+	require.NoError(t, f.Compile())
+	require.True(t, f.IsActive())
+
+	passes := []telegraf.Metric{
+		testutil.MustMetric("http",
+			map[string]string{"host": "db-01"},
+			map[string]interface{}{"status": int64(503)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("http",
+			map[string]string{"host": "db-02"},
+			map[string]interface{}{"value": int64(1)},
+			time.Unix(0, 0)),
+	}
+
+	drops := []telegraf.Metric{
+		testutil.MustMetric("http",
+			map[string]string{"host": "db-01"},
+			map[string]interface{}{"status": int64(200)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("http",
+			map[string]string{"host": "web-01"},
+			map[string]interface{}{"status": int64(503)},
+			time.Unix(0, 0)),
+		testutil.MustMetric("http",
+			map[string]string{"host": "db-01"},
+			map[string]interface{}{"status": "unknown"},
+			time.Unix(0, 0)),
+	}
+
+	for _, m := range passes {
+		require.True(t, f.Select(m), "expected %v to pass", m)
+	}
+	for _, m := range drops {
+		require.False(t, f.Select(m), "expected %v to drop", m)
+	}
+}
+
+func TestFilter_MetricPassInvalid(t *testing.T) {
+	f := Filter{
+		MetricPass: `fields.status >`,
+	}
+	require.EqualError(t, f.Compile(),
+		"Error compiling 'metricpass', unexpected end of expression at offset 15")
+}
+
+func TestFilter_MetricPassEvalErrorLoggedOnce(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	f := Filter{
+		MetricPass: `fields.status > 200`,
+	}
+	require.NoError(t, f.Compile())
+
+	m := testutil.MustMetric("http",
+		map[string]string{},
+		map[string]interface{}{"status": "unknown"},
+		time.Unix(0, 0))
+	require.False(t, f.Select(m))
+	require.False(t, f.Select(m))
+	require.Equal(t, 1, strings.Count(buf.String(), "W! [filter]"))
+	require.Contains(t, buf.String(), `metricpass "fields.status > 200"`)
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// latencyStats are the latencies of the metrics of one input written by one
+// output.
+type latencyStats struct {
+	// GatherToWrite is the time from the gather to the write.
+	GatherToWrite selfstat.Stat
+	// Pipeline is the time from the gather to the output buffer, which is
+	// spent in the processors and aggregators.
+	Pipeline selfstat.Stat
+	// Buffer is the time spent in the output buffer.
+	Buffer selfstat.Stat
+}
+
+type latencyKey struct {
+	input string
+	alias string
+}
+
+// latencyTracker records the latency of the metrics written by an output, per
+// input.  Metrics created by processors or aggregators, and metrics restored
+// from a disk buffer, have no known origin and are not recorded.
+type latencyTracker struct {
+	sync.Mutex
+	output string
+	alias  string
+	stats  map[latencyKey]*latencyStats
+}
+
+func newLatencyTracker(output, alias string) *latencyTracker {
+	return &latencyTracker{
+		output: output,
+		alias:  alias,
+		stats:  make(map[latencyKey]*latencyStats),
+	}
+}
+
+// record records the latency of metrics written at the time.
+func (t *latencyTracker) record(metrics []telegraf.Metric, now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	for _, m := range metrics {
+		origin, ok := metric.GetOrigin(m)
+		if !ok || origin.Gathered.IsZero() {
+			continue
+		}
+		stats := t.get(latencyKey{input: origin.Input, alias: origin.InputAlias})
+		stats.GatherToWrite.Incr(now.Sub(origin.Gathered).Nanoseconds())
+		if !origin.Buffered.IsZero() {
+			stats.Pipeline.Incr(origin.Buffered.Sub(origin.Gathered).Nanoseconds())
+			stats.Buffer.Incr(now.Sub(origin.Buffered).Nanoseconds())
+		}
+	}
+}
+
+func (t *latencyTracker) get(key latencyKey) *latencyStats {
+	if stats, ok := t.stats[key]; ok {
+		return stats
+	}
+
+	tags := map[string]string{"input": key.input, "output": t.output}
+	if key.alias != "" {
+		tags["input_alias"] = key.alias
+	}
+	if t.alias != "" {
+		tags["output_alias"] = t.alias
+	}
+	stats := &latencyStats{
+		GatherToWrite: selfstat.RegisterTiming("latency", "gather_to_write_ns", tags),
+		Pipeline:      selfstat.RegisterTiming("latency", "pipeline_ns", tags),
+		Buffer:        selfstat.RegisterTiming("latency", "buffer_ns", tags),
+	}
+	t.stats[key] = stats
+	return stats
+}
+
+// setBuffered records that the metric was added to an output buffer now.
+func setBuffered(m telegraf.Metric) {
+	metric.SetBuffered(m, time.Now())
+}
@@ -1,16 +1,23 @@
 package models
 
 import (
+	"fmt"
 	"log"
 	"reflect"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/logger"
+	"github.com/influxdata/wlog"
 )
 
 // Logger defines a logging structure for plugins.
 type Logger struct {
 	OnErrs []func()
 	Name   string // Name is the plugin name, will be printed in the `[]`.
+
+	// level is the log level of the plugin, the global log level applies
+	// when not set.
+	level wlog.Level
 }
 
 // NewLogger creates a new logger instance
@@ -20,17 +27,44 @@ func NewLogger(pluginType, name, alias string) *Logger {
 	}
 }
 
+// SetLevel sets the log level of the plugin, overriding the global log level.
+// Invalid levels are ignored, they are rejected when loading the config.
+func (l *Logger) SetLevel(level string) {
+	if level == "" {
+		l.level = 0
+		return
+	}
+	if lvl, err := logger.ParseLevel(level); err == nil {
+		l.level = lvl
+	}
+}
+
 // OnErr defines a callback that triggers only when errors are about to be written to the log
 func (l *Logger) OnErr(f func()) {
 	l.OnErrs = append(l.OnErrs, f)
 }
 
+// enabled reports whether messages of the level are logged.
+func (l *Logger) enabled(level wlog.Level) bool {
+	return l.level == 0 || level >= l.level
+}
+
+// print writes a message, when the plugin has its own log level the message
+// is already filtered and skips the global log level.
+func (l *Logger) print(msg string) {
+	if l.level == 0 {
+		log.Print(msg)
+		return
+	}
+	logger.PrintUnfiltered(msg)
+}
+
 // Errorf logs an error message, patterned after log.Printf.
 func (l *Logger) Errorf(format string, args ...interface{}) {
 	for _, f := range l.OnErrs {
 		f()
 	}
-	log.Printf("E! ["+l.Name+"] "+format, args...)
+	l.print(fmt.Sprintf("E! ["+l.Name+"] "+format, args...))
 }
 
 // Error logs an error message, patterned after log.Print.
@@ -38,37 +72,49 @@ func (l *Logger) Error(args ...interface{}) {
 	for _, f := range l.OnErrs {
 		f()
 	}
-	log.Print(append([]interface{}{"E! [" + l.Name + "] "}, args...)...)
+	l.print(fmt.Sprint(append([]interface{}{"E! [" + l.Name + "] "}, args...)...))
 }
 
 // Debugf logs a debug message, patterned after log.Printf.
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	log.Printf("D! ["+l.Name+"] "+format, args...)
+	if l.enabled(wlog.DEBUG) {
+		l.print(fmt.Sprintf("D! ["+l.Name+"] "+format, args...))
+	}
 }
 
 // Debug logs a debug message, patterned after log.Print.
 func (l *Logger) Debug(args ...interface{}) {
-	log.Print(append([]interface{}{"D! [" + l.Name + "] "}, args...)...)
+	if l.enabled(wlog.DEBUG) {
+		l.print(fmt.Sprint(append([]interface{}{"D! [" + l.Name + "] "}, args...)...))
+	}
 }
 
 // Warnf logs a warning message, patterned after log.Printf.
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	log.Printf("W! ["+l.Name+"] "+format, args...)
+	if l.enabled(wlog.WARN) {
+		l.print(fmt.Sprintf("W! ["+l.Name+"] "+format, args...))
+	}
 }
 
 // Warn logs a warning message, patterned after log.Print.
 func (l *Logger) Warn(args ...interface{}) {
-	log.Print(append([]interface{}{"W! [" + l.Name + "] "}, args...)...)
+	if l.enabled(wlog.WARN) {
+		l.print(fmt.Sprint(append([]interface{}{"W! [" + l.Name + "] "}, args...)...))
+	}
 }
 
 // Infof logs an information message, patterned after log.Printf.
 func (l *Logger) Infof(format string, args ...interface{}) {
-	log.Printf("I! ["+l.Name+"] "+format, args...)
+	if l.enabled(wlog.INFO) {
+		l.print(fmt.Sprintf("I! ["+l.Name+"] "+format, args...))
+	}
 }
 
 // Info logs an information message, patterned after log.Print.
 func (l *Logger) Info(args ...interface{}) {
-	log.Print(append([]interface{}{"I! [" + l.Name + "] "}, args...)...)
+	if l.enabled(wlog.INFO) {
+		l.print(fmt.Sprint(append([]interface{}{"I! [" + l.Name + "] "}, args...)...))
+	}
 }
 
 // logName returns the log-friendly name/type.
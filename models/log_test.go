@@ -1,8 +1,12 @@
 package models
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/influxdata/telegraf/logger"
 	"github.com/influxdata/telegraf/selfstat"
 	"github.com/stretchr/testify/require"
 )
@@ -22,3 +26,43 @@ func TestErrorCounting(t *testing.T) {
 
 	require.Equal(t, int64(2), reg.Get())
 }
+
+func TestLoggerLevel(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	logger.SetupLogging(logger.LogConfig{
+		LogTarget:           logger.LogTargetFile,
+		Logfile:             tmpfile.Name(),
+		RotationMaxArchives: -1,
+	})
+	defer logger.SetupLogging(logger.LogConfig{})
+
+	debug := NewLogger("inputs", "snmp", "debug")
+	debug.SetLevel("debug")
+	quiet := NewLogger("inputs", "snmp", "quiet")
+	quiet.SetLevel("error")
+	global := NewLogger("inputs", "snmp", "")
+
+	for _, l := range []*Logger{debug, quiet, global} {
+		l.Debug("debug")
+		l.Infof("info")
+		l.Errorf("error")
+	}
+
+	data, err := ioutil.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		lines = append(lines, line[21:])
+	}
+	require.Equal(t, []string{
+		"D! [inputs.snmp::debug] debug",
+		"I! [inputs.snmp::debug] info",
+		"E! [inputs.snmp::debug] error",
+		"E! [inputs.snmp::quiet] error",
+		"I! [inputs.snmp] info",
+		"E! [inputs.snmp] error",
+	}, lines)
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Actions taken on metrics with a timestamp outside of the allowed range.
+const (
+	// MetricTimeActionDrop drops the metric.
+	MetricTimeActionDrop = "drop"
+
+	// MetricTimeActionRestamp replaces the timestamp with the current time.
+	MetricTimeActionRestamp = "restamp"
+)
+
+// ValidateMetricTimeAction checks the action is one of the metric time
+// actions, the empty string selects the default drop action.
+func ValidateMetricTimeAction(action string) error {
+	switch action {
+	case "", MetricTimeActionDrop, MetricTimeActionRestamp:
+		return nil
+	}
+	return fmt.Errorf("invalid metric_time_action %q, must be %q or %q",
+		action, MetricTimeActionDrop, MetricTimeActionRestamp)
+}
+
+// MetricTimeGuard drops or restamps metrics whose timestamp is older than the
+// maximum age or further ahead of the current time than the maximum future
+// skew, such as metrics from devices with a broken clock.
+type MetricTimeGuard struct {
+	maxAge        time.Duration
+	maxFutureSkew time.Duration
+	restamp       bool
+
+	now func() time.Time
+
+	MetricsTooOld selfstat.Stat
+	MetricsTooNew selfstat.Stat
+}
+
+// NewMetricTimeGuard creates a guard reporting its stats in the measurement,
+// it returns nil when neither limit is set.
+func NewMetricTimeGuard(
+	maxAge time.Duration,
+	maxFutureSkew time.Duration,
+	action string,
+	measurement string,
+	tags map[string]string,
+) *MetricTimeGuard {
+	if maxAge <= 0 && maxFutureSkew <= 0 {
+		return nil
+	}
+
+	return &MetricTimeGuard{
+		maxAge:        maxAge,
+		maxFutureSkew: maxFutureSkew,
+		restamp:       action == MetricTimeActionRestamp,
+		now:           time.Now,
+		MetricsTooOld: selfstat.Register(
+			measurement,
+			"metrics_too_old",
+			tags,
+		),
+		MetricsTooNew: selfstat.Register(
+			measurement,
+			"metrics_too_new",
+			tags,
+		),
+	}
+}
+
+// Check returns true if the metric is kept.  A metric outside of the allowed
+// range is either restamped with the current time and kept, or must be
+// dropped by the caller.  A nil guard keeps all metrics.
+func (g *MetricTimeGuard) Check(m telegraf.Metric) bool {
+	if g == nil {
+		return true
+	}
+
+	now := g.now()
+	switch {
+	case g.maxAge > 0 && m.Time().Before(now.Add(-g.maxAge)):
+		g.MetricsTooOld.Incr(1)
+	case g.maxFutureSkew > 0 && m.Time().After(now.Add(g.maxFutureSkew)):
+		g.MetricsTooNew.Incr(1)
+	default:
+		return true
+	}
+
+	if g.restamp {
+		m.SetTime(now)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func timeMetric(tm time.Time) telegraf.Metric {
+	return testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 1}, tm)
+}
+
+func TestMetricTimeGuard(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tags := map[string]string{"input": "test_time_guard"}
+
+	require.Nil(t, NewMetricTimeGuard(0, 0, MetricTimeActionDrop, "gather", tags))
+
+	g := NewMetricTimeGuard(time.Hour, time.Minute, MetricTimeActionDrop, "gather", tags)
+	g.now = func() time.Time { return now }
+
+	require.True(t, g.Check(timeMetric(now.Add(-time.Minute))))
+	require.True(t, g.Check(timeMetric(now.Add(30*time.Second))))
+	require.False(t, g.Check(timeMetric(now.Add(-2*time.Hour))))
+	require.False(t, g.Check(timeMetric(now.Add(time.Hour))))
+	require.False(t, g.Check(timeMetric(now.Add(time.Hour))))
+	require.Equal(t, int64(1), g.MetricsTooOld.Get())
+	require.Equal(t, int64(2), g.MetricsTooNew.Get())
+}
+
+func TestMetricTimeGuard_Restamp(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tags := map[string]string{"input": "test_time_guard_restamp"}
+
+	g := NewMetricTimeGuard(time.Hour, 0, MetricTimeActionRestamp, "gather", tags)
+	g.now = func() time.Time { return now }
+
+	m := timeMetric(now.Add(-2 * time.Hour))
+	require.True(t, g.Check(m))
+	require.Equal(t, now, m.Time())
+	require.Equal(t, int64(1), g.MetricsTooOld.Get())
+
+	m = timeMetric(now.Add(24 * time.Hour))
+	require.True(t, g.Check(m))
+	require.Equal(t, now.Add(24*time.Hour), m.Time())
+}
+
+func TestMetricTimeGuard_Nil(t *testing.T) {
+	var g *MetricTimeGuard
+	require.True(t, g.Check(timeMetric(time.Unix(0, 0))))
+}
+
+func TestValidateMetricTimeAction(t *testing.T) {
+	require.NoError(t, ValidateMetricTimeAction(""))
+	require.NoError(t, ValidateMetricTimeAction(MetricTimeActionDrop))
+	require.NoError(t, ValidateMetricTimeAction(MetricTimeActionRestamp))
+	require.Error(t, ValidateMetricTimeAction("keep"))
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// OutputGroupFailover sends metrics to the first healthy member.
+	OutputGroupFailover = "failover"
+
+	// OutputGroupRoundRobin spreads metrics across the healthy members.
+	OutputGroupRoundRobin = "round_robin"
+
+	// OutputGroupBroadcast sends metrics to all members.
+	OutputGroupBroadcast = "broadcast"
+
+	// Default time a failed member is avoided before it is used again.
+	DEFAULT_FAILBACK_INTERVAL = time.Minute
+)
+
+// OutputGroupConfig is the configuration of a group of outputs that share the
+// metrics sent to the group.
+type OutputGroupConfig struct {
+	Name string
+	Mode string
+
+	// Outputs are the members of the group in order of preference.  Members
+	// are referenced by alias, or by plugin name if they have no alias.
+	Outputs []string
+
+	// FailbackInterval is how long a member is avoided after a failed write.
+	FailbackInterval time.Duration
+}
+
+// Validate checks the group settings, it does not check that the members
+// exist.
+func (c *OutputGroupConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("output group name is required")
+	}
+
+	switch c.Mode {
+	case OutputGroupFailover, OutputGroupRoundRobin, OutputGroupBroadcast:
+	default:
+		return fmt.Errorf("output group %q: invalid mode %q", c.Name, c.Mode)
+	}
+
+	if len(c.Outputs) == 0 {
+		return fmt.Errorf("output group %q: no outputs", c.Name)
+	}
+
+	seen := make(map[string]bool, len(c.Outputs))
+	for _, member := range c.Outputs {
+		if seen[member] {
+			return fmt.Errorf("output group %q: duplicate output %q", c.Name, member)
+		}
+		seen[member] = true
+	}
+	return nil
+}
+
+// OutputGroupMembers resolves the members of each group, the result is in the
+// order of the configs.  Unknown outputs are an error unless the outputs were
+// filtered, in which case they are skipped.
+func OutputGroupMembers(
+	configs []*OutputGroupConfig,
+	outputs []*RunningOutput,
+	filtered bool,
+) ([][]*RunningOutput, error) {
+	byName := make(map[string]*RunningOutput, len(outputs))
+	for _, output := range outputs {
+		name := output.GroupMemberName()
+		if _, ok := byName[name]; ok {
+			byName[name] = nil
+			continue
+		}
+		byName[name] = output
+	}
+
+	grouped := make(map[*RunningOutput]string)
+	members := make([][]*RunningOutput, 0, len(configs))
+	for _, config := range configs {
+		var group []*RunningOutput
+		for _, name := range config.Outputs {
+			output, ok := byName[name]
+			if !ok {
+				if filtered {
+					continue
+				}
+				return nil, fmt.Errorf("output group %q: unknown output %q", config.Name, name)
+			}
+			if output == nil {
+				return nil, fmt.Errorf("output group %q: output %q is ambiguous, set a unique alias", config.Name, name)
+			}
+			if other, ok := grouped[output]; ok {
+				return nil, fmt.Errorf("output group %q: output %q is already in group %q", config.Name, name, other)
+			}
+			if len(group) != 0 && !samePipelines(group[0].Config.Pipelines, output.Config.Pipelines) {
+				return nil, fmt.Errorf("output group %q: output %q receives different pipelines than %q",
+					config.Name, name, group[0].GroupMemberName())
+			}
+			grouped[output] = config.Name
+			group = append(group, output)
+		}
+		members = append(members, group)
+	}
+	return members, nil
+}
+
+func samePipelines(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, name := range a {
+		set[PipelineName(name)] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, name := range b {
+		if !set[PipelineName(name)] {
+			return false
+		}
+		other[PipelineName(name)] = true
+	}
+	return len(set) == len(other)
+}
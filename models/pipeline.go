@@ -0,0 +1,26 @@
+package models
+
+// DefaultPipeline is the pipeline of the plugins without a pipeline setting.
+const DefaultPipeline = "default"
+
+// PipelineName returns the name of the pipeline set on a plugin.
+func PipelineName(name string) string {
+	if name == "" {
+		return DefaultPipeline
+	}
+	return name
+}
+
+// ReceivesPipeline returns true if the output receives the metrics of the
+// pipeline.
+func (c *OutputConfig) ReceivesPipeline(pipeline string) bool {
+	if len(c.Pipelines) == 0 {
+		return true
+	}
+	for _, name := range c.Pipelines {
+		if PipelineName(name) == pipeline {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -13,13 +14,29 @@ type RunningAggregator struct {
 	sync.Mutex
 	Aggregator  telegraf.Aggregator
 	Config      *AggregatorConfig
+	Secrets     SecretStores
 	periodStart time.Time
 	periodEnd   time.Time
 	log         telegraf.Logger
+	tap         Tap
+
+	// NewAggregator creates an instance of the aggregator for each event
+	// time window, it must be set when EventTime is enabled.
+	NewAggregator func() (telegraf.Aggregator, error)
+
+	// windows are the open event time windows by their start, latest is
+	// the newest metric time seen and latestAt the wall clock time it was
+	// last advanced.  windowEnd is the end of the window being pushed.
+	windows   map[time.Time]telegraf.Aggregator
+	latest    time.Time
+	latestAt  time.Time
+	windowEnd time.Time
+	now       func() time.Time
 
 	MetricsPushed   selfstat.Stat
 	MetricsFiltered selfstat.Stat
 	MetricsDropped  selfstat.Stat
+	MetricsTooLate  selfstat.Stat
 	PushTime        selfstat.Stat
 }
 
@@ -31,6 +48,7 @@ func NewRunningAggregator(aggregator telegraf.Aggregator, config *AggregatorConf
 
 	aggErrorsRegister := selfstat.Register("aggregate", "errors", tags)
 	logger := NewLogger("aggregators", config.Name, config.Alias)
+	logger.SetLevel(config.LogLevel)
 	logger.OnErr(func() {
 		aggErrorsRegister.Incr(1)
 	})
@@ -55,12 +73,19 @@ func NewRunningAggregator(aggregator telegraf.Aggregator, config *AggregatorConf
 			"metrics_dropped",
 			tags,
 		),
+		MetricsTooLate: selfstat.Register(
+			"aggregate",
+			"metrics_too_late",
+			tags,
+		),
 		PushTime: selfstat.Register(
 			"aggregate",
 			"push_time_ns",
 			tags,
 		),
-		log: logger,
+		windows: make(map[time.Time]telegraf.Aggregator),
+		log:     logger,
+		now:     time.Now,
 	}
 }
 
@@ -73,11 +98,28 @@ type AggregatorConfig struct {
 	Delay        time.Duration
 	Grace        time.Duration
 
+	// EventTime adds metrics to the window of their timestamp, past windows
+	// are kept open until the watermark, the newest metric time minus
+	// Watermark, passes their end.
+	EventTime bool
+	Watermark time.Duration
+
 	NameOverride      string
 	MeasurementPrefix string
 	MeasurementSuffix string
 	Tags              map[string]string
 	Filter            Filter
+
+	// Pipeline is the name of the processor chain the aggregator is part of.
+	Pipeline string
+
+	// LogLevel is the log level of the plugin, the global log level applies
+	// when empty.
+	LogLevel string
+
+	// Fingerprint identifies the plugin's configuration table, it is used to
+	// detect changed plugins on reload.
+	Fingerprint string
 }
 
 func (r *RunningAggregator) LogName() string {
@@ -85,6 +127,9 @@ func (r *RunningAggregator) LogName() string {
 }
 
 func (r *RunningAggregator) Init() error {
+	if err := r.Secrets.Resolve(r.Aggregator, r.log); err != nil {
+		return err
+	}
 	if p, ok := r.Aggregator.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -119,6 +164,9 @@ func (r *RunningAggregator) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 
 	if m != nil {
 		m.SetAggregate(true)
+		if !r.windowEnd.IsZero() {
+			m.SetTime(r.windowEnd)
+		}
 	}
 
 	r.MetricsPushed.Incr(1)
@@ -148,6 +196,11 @@ func (r *RunningAggregator) Add(m telegraf.Metric) bool {
 	r.Lock()
 	defer r.Unlock()
 
+	if r.Config.EventTime {
+		r.addEventTime(m)
+		return r.Config.DropOriginal
+	}
+
 	if m.Time().Before(r.periodStart.Add(-r.Config.Grace)) || m.Time().After(r.periodEnd.Add(r.Config.Delay)) {
 		r.log.Debugf("Metric is outside aggregation window; discarding. %s: m: %s e: %s g: %s",
 			m.Time(), r.periodStart, r.periodEnd, r.Config.Grace)
@@ -167,17 +220,135 @@ func (r *RunningAggregator) Push(acc telegraf.Accumulator) {
 	until := r.periodEnd.Add(r.Config.Period)
 	r.UpdateWindow(since, until)
 
-	r.push(acc)
+	if r.Config.EventTime {
+		// The watermark also moves with the wall clock, so that the windows
+		// are pushed when no more metrics arrive.
+		if !r.latest.IsZero() {
+			now := r.now()
+			r.latest = r.latest.Add(now.Sub(r.latestAt))
+			r.latestAt = now
+		}
+		r.pushWindows(acc, false)
+		return
+	}
+
+	r.push(acc, r.Aggregator)
 	r.Aggregator.Reset()
 }
 
-func (r *RunningAggregator) push(acc telegraf.Accumulator) {
+// PushAll pushes the aggregates, including all open event time windows.  It
+// is called when the aggregator is stopped.
+func (r *RunningAggregator) PushAll(acc telegraf.Accumulator) {
+	if !r.Config.EventTime {
+		r.Push(acc)
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.pushWindows(acc, true)
+}
+
+func (r *RunningAggregator) push(acc telegraf.Accumulator, aggregator telegraf.Aggregator) {
 	start := time.Now()
-	r.Aggregator.Push(acc)
+	aggregator.Push(acc)
 	elapsed := time.Since(start)
 	r.PushTime.Incr(elapsed.Nanoseconds())
 }
 
+// watermark returns the time before which windows are complete.
+func (r *RunningAggregator) watermark() time.Time {
+	if r.latest.IsZero() {
+		return time.Time{}
+	}
+	return r.latest.Add(-r.Config.Watermark)
+}
+
+// addEventTime adds the metric to the window of its timestamp, metrics of a
+// window that ended before the watermark are dropped.  The aggregator must be
+// locked.
+func (r *RunningAggregator) addEventTime(m telegraf.Metric) {
+	// Metrics from the future, such as from a host with a wrong clock, do
+	// not move the watermark past the current time.
+	now := r.now()
+	latest := m.Time()
+	if limit := now.Add(r.Config.Watermark); latest.After(limit) {
+		latest = limit
+	}
+	if latest.After(r.latest) {
+		r.latest = latest
+		r.latestAt = now
+	}
+
+	start := m.Time().Truncate(r.Config.Period)
+	if !start.Add(r.Config.Period).After(r.watermark()) {
+		r.log.Debugf("Metric is older than the watermark; discarding. %s: m: %s w: %s",
+			m.Name(), m.Time(), r.watermark())
+		r.MetricsTooLate.Incr(1)
+		return
+	}
+
+	aggregator, ok := r.windows[start]
+	if !ok {
+		var err error
+		aggregator, err = r.newWindow()
+		if err != nil {
+			r.log.Errorf("Error creating aggregation window: %v", err)
+			r.MetricsDropped.Incr(1)
+			return
+		}
+		r.windows[start] = aggregator
+	}
+	aggregator.Add(m)
+}
+
+// newWindow returns an initialized instance of the aggregator.
+func (r *RunningAggregator) newWindow() (telegraf.Aggregator, error) {
+	aggregator, err := r.NewAggregator()
+	if err != nil {
+		return nil, err
+	}
+	SetLoggerOnPlugin(aggregator, r.log)
+	// Unknown secret stores were already logged by Init.
+	if err := r.Secrets.Resolve(aggregator, nil); err != nil {
+		return nil, err
+	}
+	if p, ok := aggregator.(telegraf.Initializer); ok {
+		if err := p.Init(); err != nil {
+			return nil, err
+		}
+	}
+	return aggregator, nil
+}
+
+// pushWindows pushes the windows that ended before the watermark, or all
+// windows, in time order.  The aggregates are timestamped with the end of
+// their window.  The aggregator must be locked.
+func (r *RunningAggregator) pushWindows(acc telegraf.Accumulator, all bool) {
+	watermark := r.watermark()
+	starts := make([]time.Time, 0, len(r.windows))
+	for start := range r.windows {
+		if all || !start.Add(r.Config.Period).After(watermark) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+
+	for _, start := range starts {
+		r.windowEnd = start.Add(r.Config.Period)
+		r.push(acc, r.windows[start])
+		delete(r.windows, start)
+	}
+	r.windowEnd = time.Time{}
+}
+
 func (r *RunningAggregator) Log() telegraf.Logger {
 	return r.log
 }
+
+// Tap returns the tap of the metrics pushed by the aggregator.
+func (r *RunningAggregator) Tap() *Tap {
+	return &r.tap
+}
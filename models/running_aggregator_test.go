@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
 )
@@ -238,6 +239,129 @@ func TestAddDoesNotModifyMetric(t *testing.T) {
 	testutil.RequireMetricEqual(t, expected, m)
 }
 
+// makeMetricAccumulator passes the metrics through the aggregator like the
+// accumulator of the agent.
+type makeMetricAccumulator struct {
+	testutil.Accumulator
+	ra *RunningAggregator
+}
+
+func (a *makeMetricAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	m, err := metric.New(measurement, tags, fields, time.Now())
+	if err != nil {
+		panic(err)
+	}
+	a.AddMetric(a.ra.MakeMetric(m))
+}
+
+func TestAddEventTime(t *testing.T) {
+	ra := NewRunningAggregator(&TestAggregator{}, &AggregatorConfig{
+		Name:      "TestRunningAggregator",
+		Period:    10 * time.Second,
+		EventTime: true,
+		Watermark: 15 * time.Second,
+	})
+	ra.NewAggregator = func() (telegraf.Aggregator, error) {
+		return &TestAggregator{}, nil
+	}
+	require.NoError(t, ra.Config.Filter.Compile())
+	acc := &makeMetricAccumulator{ra: ra}
+
+	now := time.Now()
+	ra.UpdateWindow(now, now.Add(ra.Config.Period))
+
+	add := func(value int64, sec int64) {
+		m := testutil.MustMetric("RITest",
+			map[string]string{},
+			map[string]interface{}{"value": value},
+			time.Unix(sec, 0))
+		require.False(t, ra.Add(m))
+	}
+	sum := func(value int64, sec int64) telegraf.Metric {
+		return testutil.MustMetric("TestMetric",
+			map[string]string{},
+			map[string]interface{}{"sum": value},
+			time.Unix(sec, 0))
+	}
+
+	// Late metrics are added to their own window while it is open.
+	add(1, 1001)
+	add(2, 1012)
+	add(4, 1005)
+	ra.Push(acc)
+	require.Empty(t, acc.GetTelegrafMetrics())
+
+	// The watermark moves to 1015, the first window is complete and metrics
+	// of it are too late.
+	add(8, 1030)
+	add(16, 1003)
+	require.Equal(t, int64(1), ra.MetricsTooLate.Get())
+
+	ra.Push(acc)
+	testutil.RequireMetricsEqual(t,
+		[]telegraf.Metric{sum(5, 1010)},
+		acc.GetTelegrafMetrics())
+
+	// All windows are pushed when stopping.
+	acc.ClearMetrics()
+	ra.PushAll(acc)
+	testutil.RequireMetricsEqual(t,
+		[]telegraf.Metric{sum(2, 1020), sum(8, 1040)},
+		acc.GetTelegrafMetrics())
+}
+
+func TestAddEventTimeWallClock(t *testing.T) {
+	ra := NewRunningAggregator(&TestAggregator{}, &AggregatorConfig{
+		Name:      "TestWallClockAggregator",
+		Period:    10 * time.Second,
+		EventTime: true,
+		Watermark: 15 * time.Second,
+	})
+	ra.NewAggregator = func() (telegraf.Aggregator, error) {
+		return &TestAggregator{}, nil
+	}
+	require.NoError(t, ra.Config.Filter.Compile())
+	acc := &makeMetricAccumulator{ra: ra}
+
+	now := time.Unix(1000, 0)
+	ra.now = func() time.Time { return now }
+
+	add := func(value int64, sec int64) {
+		m := testutil.MustMetric("RITest",
+			map[string]string{},
+			map[string]interface{}{"value": value},
+			time.Unix(sec, 0))
+		require.False(t, ra.Add(m))
+	}
+
+	// A metric from the future moves the watermark only up to the current
+	// time, so metrics of the open window are not too late.
+	add(1, 1001)
+	add(2, 5000)
+	add(4, 1002)
+	require.Equal(t, int64(0), ra.MetricsTooLate.Get())
+	ra.Push(acc)
+	require.Empty(t, acc.GetTelegrafMetrics())
+
+	// Without new metrics the watermark advances with the wall clock and the
+	// window is pushed.
+	now = now.Add(20 * time.Second)
+	ra.Push(acc)
+	testutil.RequireMetricsEqual(t,
+		[]telegraf.Metric{
+			testutil.MustMetric("TestMetric",
+				map[string]string{},
+				map[string]interface{}{"sum": int64(5)},
+				time.Unix(1010, 0)),
+		},
+		acc.GetTelegrafMetrics())
+}
+
 type TestAggregator struct {
 	sum int64
 }
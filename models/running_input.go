@@ -1,26 +1,57 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/cron"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/selfstat"
 )
 
+// ErrGatherSkipped is returned by Gather when the gather is skipped because a
+// previous gather timed out and has not returned, the caller counts it as an
+// overrun.
+var ErrGatherSkipped = errors.New("gather skipped, a previous gather timed out and has not returned")
+
 var (
 	GlobalMetricsGathered = selfstat.Register("agent", "metrics_gathered", map[string]string{})
 	GlobalGatherErrors    = selfstat.Register("agent", "gather_errors", map[string]string{})
 )
 
 type RunningInput struct {
-	Input  telegraf.Input
-	Config *InputConfig
+	Input   telegraf.Input
+	Config  *InputConfig
+	Secrets SecretStores
 
 	log         telegraf.Logger
 	defaultTags map[string]string
+	timeGuard   *MetricTimeGuard
+	tap         Tap
 
 	MetricsGathered selfstat.Stat
 	GatherTime      selfstat.Stat
+	GatherTimeouts  selfstat.Stat
+	GatherOverruns  selfstat.Stat
+
+	// hung is closed once the last gather that timed out returns.
+	hung chan struct{}
+
+	paused   int32
+	statusMu sync.Mutex
+	status   GatherStatus
+}
+
+// GatherStatus is the result of the latest gather of an input.
+type GatherStatus struct {
+	LastGather         time.Time
+	LastGatherDuration time.Duration
+	LastError          string
+	LastErrorTime      time.Time
 }
 
 func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
@@ -31,6 +62,7 @@ func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
 
 	inputErrorsRegister := selfstat.Register("gather", "errors", tags)
 	logger := NewLogger("inputs", config.Name, config.Alias)
+	logger.SetLevel(config.LogLevel)
 	logger.OnErr(func() {
 		inputErrorsRegister.Incr(1)
 		GlobalGatherErrors.Incr(1)
@@ -50,6 +82,18 @@ func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
 			"gather_time_ns",
 			tags,
 		),
+		GatherTimeouts: selfstat.Register(
+			"gather",
+			"gather_timeouts",
+			tags,
+		),
+		GatherOverruns: selfstat.Register(
+			"gather",
+			"gather_overruns",
+			tags,
+		),
+		timeGuard: NewMetricTimeGuard(config.MetricMaxAge, config.MetricMaxFutureSkew,
+			config.MetricTimeAction, "gather", tags),
 		log: logger,
 	}
 }
@@ -61,12 +105,34 @@ type InputConfig struct {
 	Interval         time.Duration
 	CollectionJitter time.Duration
 	Precision        time.Duration
+	GatherTimeout    time.Duration
+
+	// Schedule runs the input at the times of a cron schedule instead of
+	// every interval.
+	Schedule *cron.Schedule
+
+	// Metrics older than MetricMaxAge or further in the future than
+	// MetricMaxFutureSkew are handled according to the MetricTimeAction.
+	MetricMaxAge        time.Duration
+	MetricMaxFutureSkew time.Duration
+	MetricTimeAction    string
 
 	NameOverride      string
 	MeasurementPrefix string
 	MeasurementSuffix string
 	Tags              map[string]string
 	Filter            Filter
+
+	// Pipeline is the name of the processor chain the metrics are sent to.
+	Pipeline string
+
+	// LogLevel is the log level of the plugin, the global log level applies
+	// when empty.
+	LogLevel string
+
+	// Fingerprint identifies the plugin's configuration table, it is used to
+	// detect changed plugins on reload.
+	Fingerprint string
 }
 
 func (r *RunningInput) metricFiltered(metric telegraf.Metric) {
@@ -78,6 +144,9 @@ func (r *RunningInput) LogName() string {
 }
 
 func (r *RunningInput) Init() error {
+	if err := r.Secrets.Resolve(r.Input, r.log); err != nil {
+		return err
+	}
 	if p, ok := r.Input.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -88,6 +157,11 @@ func (r *RunningInput) Init() error {
 }
 
 func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
+	if r.Paused() {
+		metric.Drop()
+		return nil
+	}
+
 	if ok := r.Config.Filter.Select(metric); !ok {
 		r.metricFiltered(metric)
 		return nil
@@ -107,19 +181,112 @@ func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 		return nil
 	}
 
+	if !r.timeGuard.Check(m) {
+		m.Drop()
+		return nil
+	}
+
 	r.MetricsGathered.Incr(1)
 	GlobalMetricsGathered.Incr(1)
 	return m
 }
 
+// SetOrigin records that the metric was gathered now by the input, to measure
+// its latency until it is written.
+func (r *RunningInput) SetOrigin(m telegraf.Metric) {
+	metric.SetOrigin(m, metric.Origin{
+		Input:      r.Config.Name,
+		InputAlias: r.Config.Alias,
+		Gathered:   time.Now(),
+	})
+}
+
+// Gather calls Gather on the input.  If the gather_timeout is set and the
+// input does not return in time, the gather is abandoned: an error is
+// returned, any metrics added later are dropped and the following gathers are
+// skipped with ErrGatherSkipped until the abandoned gather returns.  It must
+// not be called concurrently.
 func (r *RunningInput) Gather(acc telegraf.Accumulator) error {
+	timeout := r.Config.GatherTimeout
+	if timeout <= 0 {
+		return r.gather(acc)
+	}
+
+	if r.hung != nil {
+		select {
+		case <-r.hung:
+			r.hung = nil
+		default:
+			return ErrGatherSkipped
+		}
+	}
+
+	tacc := &timeoutAccumulator{Accumulator: acc}
+	errC := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		errC <- r.gather(tacc)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errC:
+		return err
+	case <-timer.C:
+		tacc.expire()
+		r.hung = done
+		r.GatherTimeouts.Incr(1)
+		return fmt.Errorf("gather timed out after %s", timeout)
+	}
+}
+
+func (r *RunningInput) gather(acc telegraf.Accumulator) error {
 	start := time.Now()
 	err := r.Input.Gather(acc)
 	elapsed := time.Since(start)
 	r.GatherTime.Incr(elapsed.Nanoseconds())
+
+	r.statusMu.Lock()
+	r.status.LastGather = start
+	r.status.LastGatherDuration = elapsed
+	r.statusMu.Unlock()
 	return err
 }
 
+// RecordError keeps the error as the latest error of the input.
+func (r *RunningInput) RecordError(err error) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.status.LastError = err.Error()
+	r.status.LastErrorTime = time.Now()
+}
+
+// GatherStatus returns the result of the latest gather.
+func (r *RunningInput) GatherStatus() GatherStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	return r.status
+}
+
+// Pause stops the input from producing metrics until it is resumed.  Gathers
+// are skipped and metrics from service inputs are dropped.
+func (r *RunningInput) Pause() {
+	atomic.StoreInt32(&r.paused, 1)
+}
+
+// Resume undoes Pause.
+func (r *RunningInput) Resume() {
+	atomic.StoreInt32(&r.paused, 0)
+}
+
+// Paused returns true if the input is paused.
+func (r *RunningInput) Paused() bool {
+	return atomic.LoadInt32(&r.paused) == 1
+}
+
 func (r *RunningInput) SetDefaultTags(tags map[string]string) {
 	r.defaultTags = tags
 }
@@ -127,3 +294,103 @@ func (r *RunningInput) SetDefaultTags(tags map[string]string) {
 func (r *RunningInput) Log() telegraf.Logger {
 	return r.log
 }
+
+// Tap returns the tap of the metrics gathered by the input.
+func (r *RunningInput) Tap() *Tap {
+	return &r.tap
+}
+
+// timeoutAccumulator drops the metrics added after the gather timed out.
+type timeoutAccumulator struct {
+	telegraf.Accumulator
+	expired int32
+}
+
+func (a *timeoutAccumulator) expire() {
+	atomic.StoreInt32(&a.expired, 1)
+}
+
+func (a *timeoutAccumulator) active() bool {
+	return atomic.LoadInt32(&a.expired) == 0
+}
+
+func (a *timeoutAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	if a.active() {
+		a.Accumulator.AddFields(measurement, fields, tags, t...)
+	}
+}
+
+func (a *timeoutAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	if a.active() {
+		a.Accumulator.AddGauge(measurement, fields, tags, t...)
+	}
+}
+
+func (a *timeoutAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	if a.active() {
+		a.Accumulator.AddCounter(measurement, fields, tags, t...)
+	}
+}
+
+func (a *timeoutAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	if a.active() {
+		a.Accumulator.AddSummary(measurement, fields, tags, t...)
+	}
+}
+
+func (a *timeoutAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	if a.active() {
+		a.Accumulator.AddHistogram(measurement, fields, tags, t...)
+	}
+}
+
+func (a *timeoutAccumulator) AddMetric(m telegraf.Metric) {
+	if a.active() {
+		a.Accumulator.AddMetric(m)
+		return
+	}
+	// Tracking metrics are reported as not delivered.
+	m.Reject()
+}
+
+func (a *timeoutAccumulator) WithTracking(maxTracked int) telegraf.TrackingAccumulator {
+	return &timeoutTrackingAccumulator{
+		timeoutAccumulator: a,
+		delivered:          make(chan telegraf.DeliveryInfo, maxTracked),
+	}
+}
+
+// timeoutTrackingAccumulator tracks the metrics added to a timeoutAccumulator,
+// the metrics dropped after the timeout are reported as not delivered.
+type timeoutTrackingAccumulator struct {
+	*timeoutAccumulator
+	delivered chan telegraf.DeliveryInfo
+}
+
+func (a *timeoutTrackingAccumulator) AddTrackingMetric(m telegraf.Metric) telegraf.TrackingID {
+	dm, id := metric.WithTracking(m, a.onDelivery)
+	a.AddMetric(dm)
+	return id
+}
+
+func (a *timeoutTrackingAccumulator) AddTrackingMetricGroup(group []telegraf.Metric) telegraf.TrackingID {
+	db, id := metric.WithGroupTracking(group, a.onDelivery)
+	for _, m := range db {
+		a.AddMetric(m)
+	}
+	return id
+}
+
+func (a *timeoutTrackingAccumulator) Delivered() <-chan telegraf.DeliveryInfo {
+	return a.delivered
+}
+
+func (a *timeoutTrackingAccumulator) onDelivery(info telegraf.DeliveryInfo) {
+	select {
+	case a.delivered <- info:
+	default:
+		// This is a programming error in the input.  More items were sent for
+		// tracking than space requested.
+		panic("channel is full")
+	}
+}
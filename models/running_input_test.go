@@ -147,6 +147,27 @@ func TestMakeMetricFilteredOut(t *testing.T) {
 	assert.Nil(t, m)
 }
 
+func TestMakeMetricTooOld(t *testing.T) {
+	now := time.Now()
+	ri := NewRunningInput(&testInput{}, &InputConfig{
+		Name:         "TestRunningInputTooOld",
+		MetricMaxAge: time.Hour,
+	})
+
+	m := ri.MakeMetric(testutil.MustMetric("RITest",
+		map[string]string{},
+		map[string]interface{}{"value": int64(101)},
+		now.Add(-2*time.Hour)))
+	require.Nil(t, m)
+	require.Equal(t, int64(1), ri.timeGuard.MetricsTooOld.Get())
+
+	m = ri.MakeMetric(testutil.MustMetric("RITest",
+		map[string]string{},
+		map[string]interface{}{"value": int64(101)},
+		now))
+	require.NotNil(t, m)
+}
+
 func TestMakeMetricWithDaemonTags(t *testing.T) {
 	now := time.Now()
 	ri := NewRunningInput(&testInput{}, &InputConfig{
@@ -292,3 +313,94 @@ type testInput struct{}
 func (t *testInput) Description() string                   { return "" }
 func (t *testInput) SampleConfig() string                  { return "" }
 func (t *testInput) Gather(acc telegraf.Accumulator) error { return nil }
+
+type hungInput struct {
+	release chan struct{}
+}
+
+func (h *hungInput) Description() string  { return "" }
+func (h *hungInput) SampleConfig() string { return "" }
+func (h *hungInput) Gather(acc telegraf.Accumulator) error {
+	<-h.release
+	acc.AddFields("hung", map[string]interface{}{"value": 1}, nil)
+	return nil
+}
+
+func TestRunningInput_GatherTimeout(t *testing.T) {
+	input := &hungInput{release: make(chan struct{})}
+	ri := NewRunningInput(input, &InputConfig{
+		Name:          "TestRunningInput_GatherTimeout",
+		GatherTimeout: 10 * time.Millisecond,
+	})
+
+	timeouts := ri.GatherTimeouts.Get()
+
+	var acc testutil.Accumulator
+	require.EqualError(t, ri.Gather(&acc), "gather timed out after 10ms")
+	require.Equal(t, timeouts+1, ri.GatherTimeouts.Get())
+
+	// The input is not called again until the hung gather returns.
+	require.Equal(t, ErrGatherSkipped, ri.Gather(&acc))
+
+	// Metrics added after the timeout are dropped.
+	input.release <- struct{}{}
+	require.Eventually(t, func() bool {
+		select {
+		case <-ri.hung:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	require.Empty(t, acc.GetTelegrafMetrics())
+
+	close(input.release)
+	require.NoError(t, ri.Gather(&acc))
+	require.Len(t, acc.GetTelegrafMetrics(), 1)
+	require.Equal(t, timeouts+1, ri.GatherTimeouts.Get())
+}
+
+type hungTrackingInput struct {
+	release chan struct{}
+	acc     chan telegraf.TrackingAccumulator
+}
+
+func (h *hungTrackingInput) Description() string  { return "" }
+func (h *hungTrackingInput) SampleConfig() string { return "" }
+func (h *hungTrackingInput) Gather(acc telegraf.Accumulator) error {
+	tacc := acc.WithTracking(1)
+	h.acc <- tacc
+	<-h.release
+	m, err := metric.New("hung", map[string]string{}, map[string]interface{}{"value": 1}, time.Now())
+	if err != nil {
+		return err
+	}
+	tacc.AddTrackingMetric(m)
+	return nil
+}
+
+func TestRunningInput_GatherTimeoutTracking(t *testing.T) {
+	input := &hungTrackingInput{
+		release: make(chan struct{}),
+		acc:     make(chan telegraf.TrackingAccumulator, 1),
+	}
+	ri := NewRunningInput(input, &InputConfig{
+		Name:          "TestRunningInput_GatherTimeoutTracking",
+		GatherTimeout: 10 * time.Millisecond,
+	})
+
+	var acc testutil.Accumulator
+	require.Error(t, ri.Gather(&acc))
+	tacc := <-input.acc
+
+	// Tracking metrics added after the timeout are dropped and reported as
+	// not delivered.
+	close(input.release)
+	select {
+	case info := <-tacc.Delivered():
+		require.False(t, info.Delivered())
+	case <-time.After(time.Second):
+		t.Fatal("delivery not reported")
+	}
+	require.Empty(t, acc.GetTelegrafMetrics())
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,9 +30,48 @@ type OutputConfig struct {
 	MetricBufferLimit int
 	MetricBatchSize   int
 
+	// BufferStrategy selects where unwritten metrics are stored, either
+	// "memory" or "disk".
+	BufferStrategy  string
+	BufferDirectory string
+	BufferMaxSize   int64
+
+	// BufferPriority orders the memory buffers when the agent wide memory
+	// limit is exceeded, metrics of lower priority buffers are dropped first.
+	BufferPriority int
+
+	// Retry policy of failing writes, see CircuitBreaker.
+	RetryInitialBackoff     time.Duration
+	RetryMaxBackoff         time.Duration
+	RetryJitter             time.Duration
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+
+	// Metrics older than MetricMaxAge or further in the future than
+	// MetricMaxFutureSkew are handled according to the MetricTimeAction.
+	MetricMaxAge        time.Duration
+	MetricMaxFutureSkew time.Duration
+	MetricTimeAction    string
+
+	// MaxConcurrentWrites is the number of batches written at the same time
+	// by Write, batches are written one at a time when less than 2.
+	MaxConcurrentWrites int
+
 	NameOverride string
 	NamePrefix   string
 	NameSuffix   string
+
+	// Pipelines are the names of the pipelines the output receives metrics
+	// from, all pipelines when empty.
+	Pipelines []string
+
+	// LogLevel is the log level of the plugin, the global log level applies
+	// when empty.
+	LogLevel string
+
+	// Fingerprint identifies the plugin's configuration table, it is used to
+	// detect changed plugins on reload.
+	Fingerprint string
 }
 
 // RunningOutput contains the output configuration
@@ -41,6 +82,7 @@ type RunningOutput struct {
 
 	Output            telegraf.Output
 	Config            *OutputConfig
+	Secrets           SecretStores
 	MetricBufferLimit int
 	MetricBatchSize   int
 
@@ -49,8 +91,12 @@ type RunningOutput struct {
 
 	BatchReady chan time.Time
 
-	buffer *Buffer
-	log    telegraf.Logger
+	buffer    OutputBuffer
+	breaker   *CircuitBreaker
+	timeGuard *MetricTimeGuard
+	latency   *latencyTracker
+	tap       Tap
+	log       telegraf.Logger
 
 	aggMutex sync.Mutex
 }
@@ -69,6 +115,7 @@ func NewRunningOutput(
 
 	writeErrorsRegister := selfstat.Register("write", "errors", tags)
 	logger := NewLogger("outputs", config.Name, config.Alias)
+	logger.SetLevel(config.LogLevel)
 	logger.OnErr(func() {
 		writeErrorsRegister.Incr(1)
 	})
@@ -87,8 +134,14 @@ func NewRunningOutput(
 		batchSize = DEFAULT_METRIC_BATCH_SIZE
 	}
 
+	timeGuard := NewMetricTimeGuard(config.MetricMaxAge, config.MetricMaxFutureSkew,
+		config.MetricTimeAction, "write", tags)
+
 	ro := &RunningOutput{
 		buffer:            NewBuffer(config.Name, config.Alias, bufferLimit),
+		breaker:           NewCircuitBreaker(config, tags),
+		timeGuard:         timeGuard,
+		latency:           newLatencyTracker(config.Name, config.Alias),
 		BatchReady:        make(chan time.Time, 1),
 		Output:            output,
 		Config:            config,
@@ -119,7 +172,64 @@ func (ro *RunningOutput) metricFiltered(metric telegraf.Metric) {
 	metric.Drop()
 }
 
+// BufferPath returns the directory used by the disk buffer of the output.
+func (c *OutputConfig) BufferPath() string {
+	name := c.Name
+	if c.Alias != "" {
+		name += "-" + c.Alias
+	}
+	return filepath.Join(c.BufferDirectory, name)
+}
+
+// Validate checks the buffer settings of the output.
+func (c *OutputConfig) Validate() error {
+	switch c.BufferStrategy {
+	case "", BufferStrategyMemory:
+	case BufferStrategyDisk:
+		if c.BufferDirectory == "" {
+			return fmt.Errorf("buffer_directory is required with the %q buffer strategy", BufferStrategyDisk)
+		}
+	default:
+		return fmt.Errorf("invalid buffer_strategy %q", c.BufferStrategy)
+	}
+
+	if err := ValidateMetricTimeAction(c.MetricTimeAction); err != nil {
+		return err
+	}
+
+	if c.MaxConcurrentWrites < 0 {
+		return fmt.Errorf("max_concurrent_writes must not be negative, found %d", c.MaxConcurrentWrites)
+	}
+	// The disk buffer reads each batch from the oldest unwritten metric, so
+	// only one batch can be outstanding.
+	if c.MaxConcurrentWrites > 1 && c.BufferStrategy == BufferStrategyDisk {
+		return fmt.Errorf("max_concurrent_writes is not supported with the %q buffer strategy", BufferStrategyDisk)
+	}
+	return nil
+}
+
 func (r *RunningOutput) Init() error {
+	if err := r.InitOutput(); err != nil {
+		return err
+	}
+	return r.OpenBuffer()
+}
+
+// InitOutput validates the configuration and initializes the output plugin,
+// the disk buffer is not opened.
+func (r *RunningOutput) InitOutput() error {
+	if err := r.Config.Validate(); err != nil {
+		return err
+	}
+	if r.Config.MaxConcurrentWrites > 1 {
+		if p, ok := r.Output.(telegraf.ConcurrentOutput); !ok || !p.ConcurrentWrites() {
+			return fmt.Errorf("max_concurrent_writes is not supported by the plugin")
+		}
+	}
+	if err := r.Secrets.Resolve(r.Output, r.log); err != nil {
+		return err
+	}
+
 	if p, ok := r.Output.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -130,6 +240,20 @@ func (r *RunningOutput) Init() error {
 	return nil
 }
 
+// OpenBuffer opens the disk buffer of outputs using the disk buffer strategy.
+func (r *RunningOutput) OpenBuffer() error {
+	if r.Config.BufferStrategy != BufferStrategyDisk {
+		return nil
+	}
+	buffer, err := NewDiskBuffer(r.Config.Name, r.Config.Alias, r.MetricBufferLimit,
+		r.Config.BufferPath(), r.Config.BufferMaxSize, r.log)
+	if err != nil {
+		return fmt.Errorf("opening disk buffer: %w", err)
+	}
+	r.buffer = buffer
+	return nil
+}
+
 // AddMetric adds a metric to the output.
 //
 // Takes ownership of metric
@@ -145,7 +269,13 @@ func (ro *RunningOutput) AddMetric(metric telegraf.Metric) {
 		return
 	}
 
+	if !ro.timeGuard.Check(metric) {
+		metric.Drop()
+		return
+	}
+
 	if output, ok := ro.Output.(telegraf.AggregatingOutput); ok {
+		ro.tap.Publish(metric)
 		ro.aggMutex.Lock()
 		output.Add(metric)
 		ro.aggMutex.Unlock()
@@ -164,6 +294,8 @@ func (ro *RunningOutput) AddMetric(metric telegraf.Metric) {
 		metric.AddSuffix(ro.Config.NameSuffix)
 	}
 
+	ro.tap.Publish(metric)
+	setBuffered(metric)
 	dropped := ro.buffer.Add(metric)
 	atomic.AddInt64(&ro.droppedMetrics, int64(dropped))
 
@@ -177,6 +309,41 @@ func (ro *RunningOutput) AddMetric(metric telegraf.Metric) {
 	}
 }
 
+// Preview returns the metric as it would be added to the buffer of the output,
+// or nil if the output would not receive it.  Aggregating outputs receive the
+// metric unmodified.
+//
+// Takes ownership of metric
+func (ro *RunningOutput) Preview(metric telegraf.Metric) telegraf.Metric {
+	if ok := ro.Config.Filter.Select(metric); !ok {
+		metric.Drop()
+		return nil
+	}
+
+	ro.Config.Filter.Modify(metric)
+	if len(metric.FieldList()) == 0 || !ro.timeGuard.Check(metric) {
+		metric.Drop()
+		return nil
+	}
+
+	if _, ok := ro.Output.(telegraf.AggregatingOutput); ok {
+		return metric
+	}
+
+	if len(ro.Config.NameOverride) > 0 {
+		metric.SetName(ro.Config.NameOverride)
+	}
+
+	if len(ro.Config.NamePrefix) > 0 {
+		metric.AddPrefix(ro.Config.NamePrefix)
+	}
+
+	if len(ro.Config.NameSuffix) > 0 {
+		metric.AddSuffix(ro.Config.NameSuffix)
+	}
+	return metric
+}
+
 // Write writes all metrics to the output, stopping when all have been sent on
 // or error.
 func (ro *RunningOutput) Write() error {
@@ -193,7 +360,16 @@ func (ro *RunningOutput) Write() error {
 	// Only process the metrics in the buffer now.  Metrics added while we are
 	// writing will be sent on the next call.
 	nBuffer := ro.buffer.Len()
+	if nBuffer == 0 || !ro.allowWrite() {
+		return nil
+	}
+
+	// An open breaker allows a single probe, the batches are written one at a
+	// time until the probe succeeds.
 	nBatches := nBuffer/ro.MetricBatchSize + 1
+	if ro.Config.MaxConcurrentWrites > 1 && ro.BreakerState() == BreakerClosed {
+		return ro.writeConcurrent(nBatches, ro.Config.MaxConcurrentWrites)
+	}
 	for i := 0; i < nBatches; i++ {
 		batch := ro.buffer.Batch(ro.MetricBatchSize)
 		if len(batch) == 0 {
@@ -210,8 +386,65 @@ func (ro *RunningOutput) Write() error {
 	return nil
 }
 
+// writeConcurrent writes up to nBatches batches with at most limit writes in
+// progress.  No further batches are started once a write fails, the first
+// error is returned after all writes in progress have finished.
+func (ro *RunningOutput) writeConcurrent(nBatches int, limit int) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	slots := make(chan struct{}, limit)
+	for i := 0; i < nBatches; i++ {
+		slots <- struct{}{}
+		if failed() {
+			<-slots
+			break
+		}
+
+		batch := ro.buffer.Batch(ro.MetricBatchSize)
+		if len(batch) == 0 {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func(batch []telegraf.Metric) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			err := ro.write(batch)
+			if err != nil {
+				ro.buffer.Reject(batch)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			ro.buffer.Accept(batch)
+		}(batch)
+	}
+	wg.Wait()
+	return firstErr
+}
+
 // WriteBatch writes a single batch of metrics to the output.
 func (ro *RunningOutput) WriteBatch() error {
+	if ro.buffer.Len() == 0 || !ro.allowWrite() {
+		return nil
+	}
+
 	batch := ro.buffer.Batch(ro.MetricBatchSize)
 	if len(batch) == 0 {
 		return nil
@@ -227,12 +460,25 @@ func (ro *RunningOutput) WriteBatch() error {
 	return nil
 }
 
-// Close closes the output
+// SetBufferMemory makes the memory buffer of the output share the memory
+// limit, it has no effect on a disk buffer.
+func (r *RunningOutput) SetBufferMemory(memory *BufferMemory) {
+	if b, ok := r.buffer.(*Buffer); ok {
+		b.SetMemory(memory, r.Config.BufferPriority)
+	}
+}
+
+// Close closes the output and its buffer
 func (r *RunningOutput) Close() {
 	err := r.Output.Close()
 	if err != nil {
 		r.log.Errorf("Error closing output: %v", err)
 	}
+
+	err = r.buffer.Close()
+	if err != nil {
+		r.log.Errorf("Error closing buffer: %v", err)
+	}
 }
 
 func (r *RunningOutput) write(metrics []telegraf.Metric) error {
@@ -242,15 +488,64 @@ func (r *RunningOutput) write(metrics []telegraf.Metric) error {
 		atomic.StoreInt64(&r.droppedMetrics, 0)
 	}
 
+	r.breaker.Attempt()
 	start := time.Now()
 	err := r.Output.Write(metrics)
 	elapsed := time.Since(start)
 	r.WriteTime.Incr(elapsed.Nanoseconds())
 
-	if err == nil {
-		r.log.Debugf("Wrote batch of %d metrics in %s", len(metrics), elapsed)
+	if err != nil {
+		delay, opened := r.breaker.Failure()
+		if opened {
+			r.log.Warnf("Circuit breaker opened, next write attempt in %s", delay)
+		} else if delay > 0 {
+			r.log.Debugf("Write failed, next write attempt in %s", delay)
+		}
+		return err
+	}
+
+	if r.breaker.Success() {
+		r.log.Infof("Circuit breaker closed, write succeeded")
+	}
+	r.latency.record(metrics, time.Now())
+	r.log.Debugf("Wrote batch of %d metrics in %s", len(metrics), elapsed)
+	return nil
+}
+
+// allowWrite returns true if the retry policy allows a write now.
+func (r *RunningOutput) allowWrite() bool {
+	if r.breaker.Allow() {
+		return true
 	}
-	return err
+	r.log.Debugf("Skipping write while backing off")
+	return false
+}
+
+// GroupMemberName returns the name used to reference the output in an output
+// group.
+func (r *RunningOutput) GroupMemberName() string {
+	if r.Config.Alias != "" {
+		return r.Config.Alias
+	}
+	return r.Config.Name
+}
+
+// Drain removes and returns all metrics in the buffer, it must not be called
+// while the output is writing.
+func (r *RunningOutput) Drain() []telegraf.Metric {
+	return r.buffer.Drain()
+}
+
+// AddBuffered adds metrics taken from the buffer of another output.  Filters
+// and modifiers are not applied again.
+func (r *RunningOutput) AddBuffered(metrics []telegraf.Metric) {
+	dropped := r.buffer.Add(metrics...)
+	atomic.AddInt64(&r.droppedMetrics, int64(dropped))
+}
+
+// BreakerState returns the state of the circuit breaker of the output.
+func (r *RunningOutput) BreakerState() int {
+	return r.breaker.State()
 }
 
 func (r *RunningOutput) LogBufferStatus() {
@@ -262,6 +557,12 @@ func (r *RunningOutput) Log() telegraf.Logger {
 	return r.log
 }
 
+// Tap returns the tap of the metrics added to the buffer of the output, as
+// they are serialized and written.
+func (r *RunningOutput) Tap() *Tap {
+	return &r.tap
+}
+
 func (r *RunningOutput) BufferLength() int {
 	return r.buffer.Len()
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
 	"github.com/influxdata/telegraf/selfstat"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
@@ -488,14 +489,18 @@ func TestInternalMetrics(t *testing.T) {
 				"alias":  "test_alias",
 			},
 			map[string]interface{}{
-				"buffer_limit":     10,
-				"buffer_size":      0,
-				"errors":           0,
-				"metrics_added":    0,
-				"metrics_dropped":  0,
-				"metrics_filtered": 0,
-				"metrics_written":  0,
-				"write_time_ns":    0,
+				"breaker_state":        0,
+				"breaker_trips":        0,
+				"buffer_limit":         10,
+				"buffer_size":          0,
+				"consecutive_failures": 0,
+				"errors":               0,
+				"metrics_added":        0,
+				"metrics_dropped":      0,
+				"metrics_filtered":     0,
+				"metrics_written":      0,
+				"write_time_ns":        0,
+				"writes_skipped":       0,
 			},
 			time.Unix(0, 0),
 		),
@@ -512,6 +517,133 @@ func TestInternalMetrics(t *testing.T) {
 	testutil.RequireMetricsEqual(t, expected, actual, testutil.IgnoreTime())
 }
 
+func TestLatencyMetrics(t *testing.T) {
+	ro := NewRunningOutput(
+		"test_latency",
+		&mockOutput{},
+		&OutputConfig{
+			Filter: Filter{},
+			Name:   "test_latency",
+		},
+		5,
+		10)
+
+	m := testutil.TestMetric(101, "metric1")
+	metric.SetOrigin(m, metric.Origin{
+		Input:      "cpu",
+		InputAlias: "a",
+		Gathered:   time.Now().Add(-time.Minute),
+	})
+	ro.AddMetric(m)
+	ro.AddMetric(testutil.TestMetric(101, "metric2"))
+	require.NoError(t, ro.Write())
+
+	var actual []telegraf.Metric
+	for _, m := range selfstat.Metrics() {
+		output, _ := m.GetTag("output")
+		if m.Name() == "internal_latency" && output == "test_latency" {
+			actual = append(actual, m)
+		}
+	}
+	require.Len(t, actual, 1)
+	require.Equal(t, map[string]string{
+		"input":       "cpu",
+		"input_alias": "a",
+		"output":      "test_latency",
+	}, actual[0].Tags())
+
+	fields := actual[0].Fields()
+	require.GreaterOrEqual(t, fields["gather_to_write_ns"], time.Minute.Nanoseconds())
+	require.GreaterOrEqual(t, fields["pipeline_ns"], time.Minute.Nanoseconds())
+	require.Contains(t, fields, "buffer_ns")
+}
+
+func TestRunningOutputConcurrentWrites(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		MaxConcurrentWrites: 2,
+	}
+
+	m := &concurrentOutput{limit: 2, reached: make(chan struct{})}
+	ro := NewRunningOutput("test", m, conf, 2, 100)
+	for i := 0; i < 9; i++ {
+		ro.AddMetric(testutil.TestMetric(i, "metric"))
+	}
+
+	require.NoError(t, ro.Write())
+	require.Equal(t, 2, m.maxInFlight)
+	require.Equal(t, 5, m.writes)
+	require.Equal(t, 0, ro.BufferLength())
+}
+
+func TestRunningOutputConcurrentWritesHalfOpen(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		MaxConcurrentWrites: 2,
+	}
+
+	m := &concurrentOutput{limit: 2, reached: make(chan struct{})}
+	ro := NewRunningOutput("test", m, conf, 2, 100)
+	for i := 0; i < 3; i++ {
+		ro.AddMetric(testutil.TestMetric(i, "metric"))
+	}
+
+	// The probe of a half-open breaker is a single batch.
+	ro.breaker.Lock()
+	ro.breaker.setState(BreakerOpen)
+	ro.breaker.Unlock()
+	close(m.reached)
+	require.NoError(t, ro.Write())
+	require.Equal(t, 1, m.maxInFlight)
+	require.Equal(t, 2, m.writes)
+	require.Equal(t, BreakerClosed, ro.BreakerState())
+}
+
+func TestRunningOutputConcurrentWritesUnsupported(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		MaxConcurrentWrites: 2,
+	}
+	ro := NewRunningOutput("test", &mockOutput{}, conf, 2, 100)
+	require.EqualError(t, ro.Init(), "max_concurrent_writes is not supported by the plugin")
+
+	ro = NewRunningOutput("test", &concurrentOutput{}, conf, 2, 100)
+	require.NoError(t, ro.Init())
+}
+
+func TestRunningOutputConcurrentWritesFail(t *testing.T) {
+	conf := &OutputConfig{
+		Filter:              Filter{},
+		MaxConcurrentWrites: 2,
+	}
+
+	m := &mockOutput{failWrite: true}
+	ro := NewRunningOutput("test", m, conf, 2, 100)
+	for i := 0; i < 9; i++ {
+		ro.AddMetric(testutil.TestMetric(i, "metric"))
+	}
+
+	require.Error(t, ro.Write())
+	require.Equal(t, 9, ro.BufferLength())
+
+	m.failWrite = false
+	require.NoError(t, ro.Write())
+	require.Len(t, m.Metrics(), 9)
+	require.Equal(t, 0, ro.BufferLength())
+}
+
+func TestOutputConfigValidateConcurrentWrites(t *testing.T) {
+	conf := &OutputConfig{MaxConcurrentWrites: -1}
+	require.Error(t, conf.Validate())
+
+	conf = &OutputConfig{
+		MaxConcurrentWrites: 2,
+		BufferStrategy:      BufferStrategyDisk,
+		BufferDirectory:     t.TempDir(),
+	}
+	require.Error(t, conf.Validate())
+}
+
 type mockOutput struct {
 	sync.Mutex
 
@@ -587,3 +719,57 @@ func (m *perfOutput) Write(metrics []telegraf.Metric) error {
 	}
 	return nil
 }
+
+// concurrentOutput records the number of writes in progress, each write waits
+// until limit writes are in progress.
+type concurrentOutput struct {
+	sync.Mutex
+	limit       int
+	inFlight    int
+	maxInFlight int
+	writes      int
+	reached     chan struct{}
+}
+
+func (m *concurrentOutput) Connect() error {
+	return nil
+}
+
+func (m *concurrentOutput) Close() error {
+	return nil
+}
+
+func (m *concurrentOutput) Description() string {
+	return ""
+}
+
+func (m *concurrentOutput) SampleConfig() string {
+	return ""
+}
+
+func (m *concurrentOutput) ConcurrentWrites() bool {
+	return true
+}
+
+func (m *concurrentOutput) Write(metrics []telegraf.Metric) error {
+	m.Lock()
+	m.inFlight++
+	m.writes++
+	if m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+	if m.inFlight == m.limit && m.writes == m.limit {
+		close(m.reached)
+	}
+	m.Unlock()
+
+	select {
+	case <-m.reached:
+	case <-time.After(time.Second):
+	}
+
+	m.Lock()
+	m.inFlight--
+	m.Unlock()
+	return nil
+}
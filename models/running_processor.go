@@ -12,6 +12,8 @@ type RunningProcessor struct {
 	log       telegraf.Logger
 	Processor telegraf.StreamingProcessor
 	Config    *ProcessorConfig
+	Secrets   SecretStores
+	tap       Tap
 }
 
 type RunningProcessors []*RunningProcessor
@@ -26,6 +28,17 @@ type ProcessorConfig struct {
 	Alias  string
 	Order  int64
 	Filter Filter
+
+	// Pipeline is the name of the processor chain the processor is part of.
+	Pipeline string
+
+	// LogLevel is the log level of the plugin, the global log level applies
+	// when empty.
+	LogLevel string
+
+	// Fingerprint identifies the plugin's configuration table, it is used to
+	// detect changed plugins on reload.
+	Fingerprint string
 }
 
 func NewRunningProcessor(processor telegraf.StreamingProcessor, config *ProcessorConfig) *RunningProcessor {
@@ -36,6 +49,7 @@ func NewRunningProcessor(processor telegraf.StreamingProcessor, config *Processo
 
 	processErrorsRegister := selfstat.Register("process", "errors", tags)
 	logger := NewLogger("processors", config.Name, config.Alias)
+	logger.SetLevel(config.LogLevel)
 	logger.OnErr(func() {
 		processErrorsRegister.Incr(1)
 	})
@@ -53,6 +67,9 @@ func (rp *RunningProcessor) metricFiltered(metric telegraf.Metric) {
 }
 
 func (r *RunningProcessor) Init() error {
+	if err := r.Secrets.Resolve(r.Processor, r.log); err != nil {
+		return err
+	}
 	if p, ok := r.Processor.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -98,3 +115,9 @@ func (r *RunningProcessor) Add(m telegraf.Metric, acc telegraf.Accumulator) erro
 func (r *RunningProcessor) Stop() {
 	r.Processor.Stop()
 }
+
+// Tap returns the tap of the metrics emitted by the processor, including the
+// metrics it does not select.
+func (r *RunningProcessor) Tap() *Tap {
+	return &r.tap
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/influxdata/telegraf"
+)
+
+// secretRefRe matches a reference to a secret, @{id:key}.
+var secretRefRe = regexp.MustCompile(`@\{(\w+):([^{}]+)\}`)
+
+// SecretStores are the secret stores by id.
+type SecretStores map[string]telegraf.SecretStore
+
+// Resolve replaces the secret references in the string settings of the plugin
+// with the secrets.  It is called right before the plugin is initialized, so
+// that the secrets are not part of the loaded configuration.  References to
+// unknown stores are kept as they are and logged as warnings if log is set.
+func (s SecretStores) Resolve(plugin interface{}, log telegraf.Logger) error {
+	return s.walk(plugin, func(value string) (string, error) {
+		if log != nil {
+			for _, ref := range s.unknown(value) {
+				log.Warnf("Secret store of %s does not exist, the text is used as it is", ref)
+			}
+		}
+		return s.expand(value)
+	})
+}
+
+// Unknown returns the references in the string settings of the plugin to
+// stores that do not exist.
+func (s SecretStores) Unknown(plugin interface{}) []string {
+	var refs []string
+	s.walk(plugin, func(value string) (string, error) {
+		refs = append(refs, s.unknown(value)...)
+		return value, nil
+	})
+	return refs
+}
+
+// walk replaces the string settings of the plugin with the result of fn.
+func (s SecretStores) walk(plugin interface{}, fn func(string) (string, error)) error {
+	if p, ok := plugin.(interface{ Unwrap() telegraf.Processor }); ok {
+		plugin = p.Unwrap()
+	}
+	v := reflect.ValueOf(plugin)
+	if v.Kind() != reflect.Ptr {
+		return nil
+	}
+	return walkValue(v, make(map[uintptr]bool), fn)
+}
+
+func walkValue(v reflect.Value, seen map[uintptr]bool, fn func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return nil
+		}
+		seen[v.Pointer()] = true
+		return walkValue(v.Elem(), seen, fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			// Only exported fields are set from the configuration, including
+			// the fields promoted from embedded structs.
+			if f := v.Type().Field(i); f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			if err := walkValue(v.Field(i), seen, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkValue(v.Index(i), seen, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String || !v.CanInterface() {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := fn(iter.Value().String())
+			if err != nil {
+				return err
+			}
+			if value != iter.Value().String() {
+				v.SetMapIndex(iter.Key(), reflect.ValueOf(value).Convert(v.Type().Elem()))
+			}
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		value, err := fn(v.String())
+		if err != nil {
+			return err
+		}
+		if value != v.String() {
+			v.SetString(value)
+		}
+	}
+	return nil
+}
+
+// expand replaces the secret references in the value.  Only the ids of the
+// stores are references, other text of the same form is kept as is.  Errors
+// name the reference and never contain a secret.
+func (s SecretStores) expand(value string) (string, error) {
+	var err error
+	result := secretRefRe.ReplaceAllStringFunc(value, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		m := secretRefRe.FindStringSubmatch(ref)
+		store, ok := s[m[1]]
+		if !ok {
+			return ref
+		}
+		secret, e := store.Get(m[2])
+		if e != nil {
+			err = fmt.Errorf("secret %s: %w", ref, e)
+			return ref
+		}
+		return secret
+	})
+	return result, err
+}
+
+// unknown returns the references in the value to stores that do not exist.
+func (s SecretStores) unknown(value string) []string {
+	var refs []string
+	for _, m := range secretRefRe.FindAllStringSubmatch(value, -1) {
+		if _, ok := s[m[1]]; !ok {
+			refs = append(refs, m[0])
+		}
+	}
+	return refs
+}
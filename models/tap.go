@@ -0,0 +1,138 @@
+package models
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/expr"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// Tap passes copies of the metrics emitted by a plugin to the subscribers
+// attached to it.  Publishing costs nothing while no subscriber is attached
+// and never blocks, metrics are dropped for subscribers that do not keep up.
+// The zero value is ready to use.
+type Tap struct {
+	attached int32
+
+	sync.Mutex
+	subscribers []*TapSubscriber
+	closed      bool
+	done        chan struct{}
+}
+
+// Attach adds the subscriber to the tap, it returns false if the tap is
+// closed.
+func (t *Tap) Attach(s *TapSubscriber) bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.closed {
+		return false
+	}
+	t.subscribers = append(t.subscribers, s)
+	atomic.StoreInt32(&t.attached, int32(len(t.subscribers)))
+	return true
+}
+
+// Detach removes the subscriber from the tap.
+func (t *Tap) Detach(s *TapSubscriber) {
+	t.Lock()
+	defer t.Unlock()
+	for i, subscriber := range t.subscribers {
+		if subscriber == s {
+			t.subscribers = append(t.subscribers[:i], t.subscribers[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&t.attached, int32(len(t.subscribers)))
+}
+
+// Publish passes a copy of the metric to the subscribers whose filter it
+// matches.  The metric is not modified and remains owned by the caller.
+func (t *Tap) Publish(m telegraf.Metric) {
+	if atomic.LoadInt32(&t.attached) == 0 {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	for _, s := range t.subscribers {
+		s.add(m)
+	}
+}
+
+// Close detaches all subscribers once the plugin is stopped, Done is closed
+// and no subscriber can be attached after.
+func (t *Tap) Close() {
+	t.Lock()
+	defer t.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	t.subscribers = nil
+	atomic.StoreInt32(&t.attached, 0)
+	if t.done != nil {
+		close(t.done)
+	}
+}
+
+// Done returns a channel that is closed when the tap is closed.
+func (t *Tap) Done() <-chan struct{} {
+	t.Lock()
+	defer t.Unlock()
+	if t.done == nil {
+		t.done = make(chan struct{})
+		if t.closed {
+			close(t.done)
+		}
+	}
+	return t.done
+}
+
+// TapSubscriber receives the metrics of the taps it is attached to that match
+// its filter.
+type TapSubscriber struct {
+	// Must be 64-bit aligned
+	dropped int64
+
+	C      <-chan telegraf.Metric
+	c      chan telegraf.Metric
+	filter *expr.Expression
+}
+
+// NewTapSubscriber returns a subscriber buffering up to size metrics, all
+// metrics are received when the filter is nil.
+func NewTapSubscriber(filter *expr.Expression, size int) *TapSubscriber {
+	c := make(chan telegraf.Metric, size)
+	return &TapSubscriber{
+		C:      c,
+		c:      c,
+		filter: filter,
+	}
+}
+
+// Dropped returns the number of metrics dropped since the last call because
+// the buffer was full.
+func (s *TapSubscriber) Dropped() int64 {
+	return atomic.SwapInt64(&s.dropped, 0)
+}
+
+func (s *TapSubscriber) add(m telegraf.Metric) {
+	if s.filter != nil && !s.filter.Match(m) {
+		return
+	}
+
+	// The copy is not tracked, so that the delivery of the metric does not
+	// wait for the subscriber.
+	c, err := metric.New(m.Name(), m.Tags(), m.Fields(), m.Time(), m.Type())
+	if err != nil {
+		return
+	}
+	select {
+	case s.c <- c:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
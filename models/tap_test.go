@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal/expr"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTap(t *testing.T) {
+	filter, err := expr.Compile(`tags.host == 'a'`)
+	require.NoError(t, err)
+
+	var tap Tap
+	s := NewTapSubscriber(filter, 1)
+	require.True(t, tap.Attach(s))
+
+	a := testutil.MustMetric("cpu", map[string]string{"host": "a"},
+		map[string]interface{}{"value": 1}, time.Unix(0, 0))
+	b := testutil.MustMetric("cpu", map[string]string{"host": "b"},
+		map[string]interface{}{"value": 2}, time.Unix(0, 0))
+
+	tap.Publish(a)
+	tap.Publish(b)
+	tap.Publish(a)
+
+	// The second matching metric does not fit in the buffer.
+	require.Len(t, s.C, 1)
+	testutil.RequireMetricEqual(t, a, <-s.C)
+	require.Equal(t, int64(1), s.Dropped())
+	require.Equal(t, int64(0), s.Dropped())
+
+	tap.Detach(s)
+	tap.Publish(a)
+	require.Len(t, s.C, 0)
+}
+
+func TestTapUntracked(t *testing.T) {
+	var tap Tap
+	s := NewTapSubscriber(nil, 1)
+	require.True(t, tap.Attach(s))
+
+	delivered := false
+	m, _ := metric.WithTracking(Metric(), func(telegraf.DeliveryInfo) {
+		delivered = true
+	})
+	tap.Publish(m)
+	m.Accept()
+
+	// The delivery does not wait for the copy held by the subscriber.
+	require.True(t, delivered)
+	require.Len(t, s.C, 1)
+}
+
+func TestTapClose(t *testing.T) {
+	var tap Tap
+	s := NewTapSubscriber(nil, 1)
+	require.True(t, tap.Attach(s))
+
+	done := tap.Done()
+	tap.Close()
+	<-done
+	<-tap.Done()
+
+	tap.Publish(Metric())
+	require.Len(t, s.C, 0)
+	require.False(t, tap.Attach(s))
+}
@@ -27,3 +27,13 @@ type AggregatingOutput interface {
 	// Reset signals the the aggregator period is completed.
 	Reset()
 }
+
+// ConcurrentOutput is an Output whose Write function may be called
+// concurrently, which is required to set max_concurrent_writes.
+type ConcurrentOutput interface {
+	Output
+
+	// ConcurrentWrites returns true if Write may be called concurrently with
+	// the current configuration.
+	ConcurrentWrites() bool
+}
@@ -11,6 +11,9 @@ func (d *Discard) Connect() error       { return nil }
 func (d *Discard) Close() error         { return nil }
 func (d *Discard) SampleConfig() string { return "" }
 func (d *Discard) Description() string  { return "Send metrics to nowhere at all" }
+
+func (d *Discard) ConcurrentWrites() bool { return true }
+
 func (d *Discard) Write(metrics []telegraf.Metric) error {
 	return nil
 }
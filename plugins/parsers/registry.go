@@ -150,6 +150,12 @@ type Config struct {
 	FormUrlencodedTagKeys []string `toml:"form_urlencoded_tag_keys"`
 }
 
+// DataFormats are the data formats supported by NewParser.
+var DataFormats = []string{
+	"collectd", "csv", "dropwizard", "form_urlencoded", "graphite", "grok",
+	"influx", "json", "logfmt", "nagios", "value", "wavefront",
+}
+
 // NewParser returns a Parser interface based on the given config.
 func NewParser(config *Config) (Parser, error) {
 	var err error
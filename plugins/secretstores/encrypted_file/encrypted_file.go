@@ -0,0 +1,139 @@
+package encrypted_file
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/secretstores"
+	"github.com/influxdata/toml"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var sampleConfig = `
+  ## Unique identifier of the store, secrets are referenced as @{id:key}.
+  id = "vault"
+
+  ## File of "key = value" secrets encrypted by:
+  ##   openssl enc -aes-256-cbc -pbkdf2 -pass file:<key_file> -in secrets.toml -out <path>
+  path = "/etc/telegraf/secrets.enc"
+
+  ## File containing the passphrase on its first line.
+  key_file = "/etc/telegraf/secrets.key"
+
+  ## PBKDF2 iterations used to derive the key, the -iter option of openssl.
+  # iterations = 10000
+`
+
+const saltHeader = "Salted__"
+
+var errDecrypt = errors.New("bad decrypt, check the key_file")
+
+type EncryptedFile struct {
+	Path       string `toml:"path"`
+	KeyFile    string `toml:"key_file"`
+	Iterations int    `toml:"iterations"`
+}
+
+func (e *EncryptedFile) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *EncryptedFile) Description() string {
+	return "Read secrets from a file encrypted with openssl"
+}
+
+func (e *EncryptedFile) Init() error {
+	if e.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if e.KeyFile == "" {
+		return fmt.Errorf("key_file is required")
+	}
+	if e.Iterations <= 0 {
+		e.Iterations = 10000
+	}
+	return nil
+}
+
+// Get decrypts the file on every call, so that the secrets are only held in
+// memory while they are resolved.
+func (e *EncryptedFile) Get(key string) (string, error) {
+	secrets, err := e.read()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[key]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", key)
+	}
+	return secret, nil
+}
+
+func (e *EncryptedFile) read() (map[string]string, error) {
+	passphrase, err := ioutil.ReadFile(e.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexAny(passphrase, "\r\n"); i >= 0 {
+		passphrase = passphrase[:i]
+	}
+
+	data, err := ioutil.ReadFile(e.Path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decrypt(data, passphrase, e.Iterations)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", e.Path, err)
+	}
+
+	secrets := make(map[string]string)
+	if err := toml.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", e.Path, err)
+	}
+	return secrets, nil
+}
+
+// decrypt decrypts the output of "openssl enc -aes-256-cbc -pbkdf2".
+func decrypt(data, passphrase []byte, iterations int) ([]byte, error) {
+	if len(data) < len(saltHeader)+8 || string(data[:len(saltHeader)]) != saltHeader {
+		return nil, errors.New("missing salt header, the file must be encrypted with -salt")
+	}
+	salt := data[len(saltHeader) : len(saltHeader)+8]
+	ciphertext := data[len(saltHeader)+8:]
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("ciphertext is not a multiple of the block size")
+	}
+
+	dk := pbkdf2.Key(passphrase, salt, iterations, 32+aes.BlockSize, sha256.New)
+	block, err := aes.NewCipher(dk[:32])
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, dk[32:]).CryptBlocks(plaintext, ciphertext)
+
+	// Remove the PKCS#7 padding, a wrong passphrase usually shows up here.
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errDecrypt
+	}
+	for _, b := range plaintext[len(plaintext)-pad:] {
+		if int(b) != pad {
+			return nil, errDecrypt
+		}
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+func init() {
+	secretstores.Add("encrypted_file", func() telegraf.SecretStore {
+		return &EncryptedFile{}
+	})
+}
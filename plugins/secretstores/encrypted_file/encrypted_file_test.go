@@ -0,0 +1,39 @@
+package encrypted_file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/secrets.enc was created with openssl enc -aes-256-cbc -pbkdf2.
+func TestGet(t *testing.T) {
+	e := &EncryptedFile{
+		Path:    "testdata/secrets.enc",
+		KeyFile: "testdata/secrets.key",
+	}
+	require.NoError(t, e.Init())
+
+	secret, err := e.Get("token")
+	require.NoError(t, err)
+	require.Equal(t, "abc123", secret)
+
+	secret, err = e.Get("password")
+	require.NoError(t, err)
+	require.Equal(t, `p@ss"word`, secret)
+
+	_, err = e.Get("missing")
+	require.EqualError(t, err, `secret "missing" not found`)
+}
+
+func TestGetWrongIterations(t *testing.T) {
+	e := &EncryptedFile{
+		Path:       "testdata/secrets.enc",
+		KeyFile:    "testdata/secrets.key",
+		Iterations: 1000,
+	}
+	require.NoError(t, e.Init())
+
+	_, err := e.Get("token")
+	require.Error(t, err)
+}
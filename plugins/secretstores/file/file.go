@@ -0,0 +1,65 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/secretstores"
+)
+
+var sampleConfig = `
+  ## Unique identifier of the store, secrets are referenced as @{id:key}.
+  id = "files"
+
+  ## Directory containing one file per secret, the key is the file name.
+  ## Trailing newlines are removed from the secrets.
+  directory = "/run/secrets"
+`
+
+type File struct {
+	Directory string `toml:"directory"`
+}
+
+func (f *File) SampleConfig() string {
+	return sampleConfig
+}
+
+func (f *File) Description() string {
+	return "Read secrets from files in a directory"
+}
+
+func (f *File) Init() error {
+	if f.Directory == "" {
+		return fmt.Errorf("directory is required")
+	}
+	info, err := os.Stat(f.Directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", f.Directory)
+	}
+	return nil
+}
+
+func (f *File) Get(key string) (string, error) {
+	// Keys are file names, do not allow reading outside of the directory.
+	if key != filepath.Base(key) || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(f.Directory, key))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func init() {
+	secretstores.Add("file", func() telegraf.SecretStore {
+		return &File{}
+	})
+}
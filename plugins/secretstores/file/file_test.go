@@ -0,0 +1,36 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "password"), []byte("s3cr3t\n"), 0600))
+
+	f := &File{Directory: dir}
+	require.NoError(t, f.Init())
+
+	secret, err := f.Get("password")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+
+	_, err = f.Get("missing")
+	require.Error(t, err)
+
+	_, err = f.Get("../password")
+	require.Error(t, err)
+}
+
+func TestInit(t *testing.T) {
+	require.Error(t, (&File{}).Init())
+	require.Error(t, (&File{Directory: "/nonexistent/secrets"}).Init())
+}
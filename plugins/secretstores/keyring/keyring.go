@@ -0,0 +1,74 @@
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/secretstores"
+)
+
+var sampleConfig = `
+  ## Unique identifier of the store, secrets are referenced as @{id:key}.
+  id = "keyring"
+
+  ## Service the secrets are stored under, the key is the account.
+  ##   Linux: secret-tool store --label=<key> service <service> account <key>
+  ##   macOS: security add-generic-password -s <service> -a <key> -w
+  # service = "telegraf"
+
+  ## Timeout for reading a secret from the keyring.
+  # timeout = "5s"
+`
+
+// lookup returns the command reading a secret, it is nil when the operating
+// system is not supported.
+var lookup func(service, key string) *exec.Cmd
+
+type Keyring struct {
+	Service string            `toml:"service"`
+	Timeout internal.Duration `toml:"timeout"`
+}
+
+func (k *Keyring) SampleConfig() string {
+	return sampleConfig
+}
+
+func (k *Keyring) Description() string {
+	return "Read secrets from the keyring of the operating system"
+}
+
+func (k *Keyring) Init() error {
+	if lookup == nil {
+		return fmt.Errorf("keyring is not supported on this operating system")
+	}
+	if k.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	return nil
+}
+
+func (k *Keyring) Get(key string) (string, error) {
+	cmd := lookup(k.Service, key)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := internal.RunTimeout(cmd, k.Timeout.Duration); err != nil {
+		return "", fmt.Errorf("reading %q from the keyring: %v: %s", key, err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+func init() {
+	secretstores.Add("keyring", func() telegraf.SecretStore {
+		return &Keyring{
+			Service: "telegraf",
+			Timeout: internal.Duration{Duration: 5 * time.Second},
+		}
+	})
+}
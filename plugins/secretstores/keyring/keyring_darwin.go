@@ -0,0 +1,11 @@
+// +build darwin
+
+package keyring
+
+import "os/exec"
+
+func init() {
+	lookup = func(service, key string) *exec.Cmd {
+		return exec.Command("security", "find-generic-password", "-s", service, "-a", key, "-w")
+	}
+}
@@ -0,0 +1,11 @@
+// +build linux
+
+package keyring
+
+import "os/exec"
+
+func init() {
+	lookup = func(service, key string) *exec.Cmd {
+		return exec.Command("secret-tool", "lookup", "service", service, "account", key)
+	}
+}
@@ -0,0 +1,37 @@
+package keyring
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on windows")
+	}
+
+	var args []string
+	lookup = func(service, key string) *exec.Cmd {
+		args = []string{service, key}
+		return exec.Command("echo", "s3cr3t")
+	}
+
+	k := &Keyring{Service: "telegraf", Timeout: internal.Duration{Duration: 5 * time.Second}}
+	require.NoError(t, k.Init())
+
+	secret, err := k.Get("password")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+	require.Equal(t, []string{"telegraf", "password"}, args)
+
+	lookup = func(service, key string) *exec.Cmd {
+		return exec.Command("false")
+	}
+	_, err = k.Get("password")
+	require.Error(t, err)
+}
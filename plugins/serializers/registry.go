@@ -105,6 +105,12 @@ type Config struct {
 	PrometheusStringAsLabel bool `toml:"prometheus_string_as_label"`
 }
 
+// DataFormats are the data formats supported by NewSerializer.
+var DataFormats = []string{
+	"carbon2", "graphite", "influx", "json", "nowmetric", "prometheus",
+	"splunkmetric", "wavefront",
+}
+
 // NewSerializer a Serializer interface based on the given config.
 func NewSerializer(config *Config) (Serializer, error) {
 	var err error
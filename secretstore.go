@@ -0,0 +1,10 @@
+package telegraf
+
+// SecretStore provides the secrets referenced in the plugin configuration as
+// @{id:key}, where id is the id of the store.
+type SecretStore interface {
+	PluginDescriber
+
+	// Get returns the secret stored under the key.
+	Get(key string) (string, error)
+}